@@ -12,13 +12,53 @@ type Config struct {
 	MongoDBURI   string
 	MongoDBName  string
 	JWTSecret    string
+	JWTAlgorithm string // HS256, RS256 or EdDSA
+	JWTPrivateKey string // PEM, or use JWTPrivateKeyFile
+	JWTPrivateKeyFile string
+	JWTKeyID     string // defaults to the key's RFC 7638 thumbprint
+	JWTVerificationKeyFiles string // comma-separated "path" or "kid=path" PEM public keys still accepted after rotation
 	JWTExpiration string
+	RefreshTokenExpiration string
 	UploadDir    string
 	MaxFileSize  int64
 	TwilioAccountSID string
 	TwilioAuthToken  string
 	TwilioPhoneNumber string
 	TwilioEnabled     bool
+	OTPProviders      string // comma-separated, tried in order: twilio, http_sms, smtp, dev
+	SMSGatewayURL     string
+	SMSGatewayAPIKey  string
+	SMSGatewayFrom    string
+	SMTPHost          string
+	SMTPPort          string
+	SMTPUsername      string
+	SMTPPassword      string
+	SMTPFrom          string
+	OTPDevSinkFile    string
+	OTPDevSinkEnabled bool // the dev provider only delivers when explicitly enabled, never in release mode
+	MailDriver        string // smtp or mailbox
+	MailboxDir        string
+	WebAuthnRPID      string // passkey relying party: the domain the clients are served from
+	WebAuthnRPName    string
+	WebAuthnOrigins   string // comma-separated origins allowed to use passkeys
+	ChatEventRetention string // how long admin actions stay in group and channel logs
+}
+
+// DefaultJWTSecret is the development fallback for JWT_SECRET.
+const DefaultJWTSecret = "your-secret-key"
+
+// placeholderJWTSecrets are well-known secrets that must never sign tokens in production.
+var placeholderJWTSecrets = map[string]bool{
+	DefaultJWTSecret: true,
+	"your-secret-key-change-this-in-production": true,
+	"": true,
+}
+
+// InsecureJWTSecret reports whether tokens would be signed with a
+// well-known HS256 secret.
+func (c *Config) InsecureJWTSecret() bool {
+	alg := strings.ToUpper(c.JWTAlgorithm)
+	return (alg == "" || alg == "HS256") && placeholderJWTSecrets[c.JWTSecret]
 }
 
 func Load() *Config {
@@ -91,6 +131,7 @@ func Load() *Config {
 	// Twilio configuration
 	twilioEnabled := getEnv("TWILIO_ENABLED", "false")
 	twilioEnabledBool := twilioEnabled == "true" || twilioEnabled == "1"
+	otpDevSink := getEnv("OTP_DEV_SINK", "false")
 	
 	mongoDBName := getEnv("MONGODB_DB", getEnv("MONGO_DATABASE", "chat_app"))
 	log.Printf("MongoDB Database: %s", mongoDBName)
@@ -99,14 +140,37 @@ func Load() *Config {
 		Port:          getEnv("PORT", "8080"),
 		MongoDBURI:    mongoURI,
 		MongoDBName:   mongoDBName,
-		JWTSecret:     getEnv("JWT_SECRET", "your-secret-key"),
-		JWTExpiration: getEnv("JWT_EXPIRATION", "24h"),
+		JWTSecret:     getEnv("JWT_SECRET", DefaultJWTSecret),
+		JWTAlgorithm:  getEnv("JWT_ALGORITHM", "HS256"),
+		JWTPrivateKey: getEnv("JWT_PRIVATE_KEY", ""),
+		JWTPrivateKeyFile: getEnv("JWT_PRIVATE_KEY_FILE", ""),
+		JWTKeyID:      getEnv("JWT_KEY_ID", ""),
+		JWTVerificationKeyFiles: getEnv("JWT_VERIFICATION_KEY_FILES", ""),
+		JWTExpiration: getEnv("JWT_EXPIRATION", "15m"),
+		RefreshTokenExpiration: getEnv("REFRESH_TOKEN_EXPIRATION", "720h"),
 		UploadDir:     getEnv("UPLOAD_DIR", "./uploads"),
 		MaxFileSize:   10485760, // 10MB
 		TwilioAccountSID:  getEnv("TWILIO_ACCOUNT_SID", ""),
 		TwilioAuthToken:   getEnv("TWILIO_AUTH_TOKEN", ""),
 		TwilioPhoneNumber: getEnv("TWILIO_PHONE_NUMBER", ""),
 		TwilioEnabled:      twilioEnabledBool,
+		OTPProviders:      getEnv("OTP_PROVIDERS", "twilio"),
+		SMSGatewayURL:     getEnv("SMS_GATEWAY_URL", ""),
+		SMSGatewayAPIKey:  getEnv("SMS_GATEWAY_API_KEY", ""),
+		SMSGatewayFrom:    getEnv("SMS_GATEWAY_FROM", ""),
+		SMTPHost:          getEnv("SMTP_HOST", ""),
+		SMTPPort:          getEnv("SMTP_PORT", "587"),
+		SMTPUsername:      getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:      getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:          getEnv("SMTP_FROM", ""),
+		OTPDevSinkFile:    getEnv("OTP_DEV_SINK_FILE", ""),
+		OTPDevSinkEnabled: otpDevSink == "true" || otpDevSink == "1",
+		MailDriver:        getEnv("MAIL_DRIVER", "smtp"),
+		MailboxDir:        getEnv("MAILBOX_DIR", ""),
+		WebAuthnRPID:      getEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:    getEnv("WEBAUTHN_RP_NAME", "ChatApp"),
+		WebAuthnOrigins:   getEnv("WEBAUTHN_ORIGINS", "http://localhost:3000"),
+		ChatEventRetention: getEnv("CHAT_EVENT_RETENTION", "48h"),
 	}
 }
 
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the indexes that enforce uniqueness constraints and
+// expire records.
+// Creating an index that already exists is a no-op.
+func (d *Database) EnsureIndexes(ctx context.Context) error {
+	_, err := d.MongoDB.Collection("usernames").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("name_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "owner_type", Value: 1}, {Key: "owner_id", Value: 1}},
+			Options: options.Index().SetName("owner"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.MongoDB.Collection("chat_restrictions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "chat_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("chat_user_unique"),
+		},
+		{
+			// Bans and restrictions with an until_date are removed once it passes
+			Keys:    bson.D{{Key: "until_date", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("until_date_ttl"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.MongoDB.Collection("invite_links").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("code_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "chat_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("chat"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// One pending join request per user and chat
+	_, err = d.MongoDB.Collection("join_requests").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "chat_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"status": "pending"}).
+			SetName("pending_unique"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.MongoDB.Collection("chat_events").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "chat_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("chat"),
+		},
+		{
+			// Retention is set per event, so changing it needs no index change
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("expires_at_ttl"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.MongoDB.Collection("passkeys").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// A credential belongs to one account only
+			Keys:    bson.D{{Key: "credential_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("credential_id_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+			Options: options.Index().SetName("user"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.MongoDB.Collection("webauthn_challenges").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0).SetName("expires_at_ttl"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Refresh tokens are looked up by the hash of the presented token
+	_, err = d.MongoDB.Collection("refresh_tokens").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "token_hash", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("token_hash_unique"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Active sessions of a user, listed and revoked together
+	_, err = d.MongoDB.Collection("sessions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "revoked", Value: 1}},
+		Options: options.Index().SetName("user_revoked"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.MongoDB.Collection("auth_challenges").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("token_hash_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("expires_at_ttl"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.MongoDB.Collection("qr_login_tokens").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("token_hash_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("expires_at_ttl"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Finds who blocked a user
+	_, err = d.MongoDB.Collection("user_settings").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "privacy.blocked_users", Value: 1}},
+		Options: options.Index().SetName("blocked_users"),
+	})
+	return err
+}
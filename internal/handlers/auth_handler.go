@@ -3,37 +3,51 @@ package handlers
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
+	"strconv"
 	"time"
 
 	"chat-backend/internal/database"
 	"chat-backend/internal/models"
 	"chat-backend/internal/utils"
+	"chat-backend/internal/websocket"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
-	db      *database.Database
-	twilio  *utils.TwilioService
+	db       *database.Database
+	otp      *utils.OTPService
+	mailer   utils.Mailer
+	sessions *utils.SessionService
+	hub      *websocket.Hub
+	guard    *utils.VerificationGuard
+	webauthn *utils.WebAuthn
 }
 
-func NewAuthHandler(db *database.Database, twilio *utils.TwilioService) *AuthHandler {
+func NewAuthHandler(db *database.Database, otp *utils.OTPService, mailer utils.Mailer, sessions *utils.SessionService, hub *websocket.Hub, webauthn *utils.WebAuthn) *AuthHandler {
 	return &AuthHandler{
-		db:     db,
-		twilio: twilio,
+		db:       db,
+		otp:      otp,
+		mailer:   mailer,
+		sessions: sessions,
+		hub:      hub,
+		guard:    utils.NewVerificationGuard(db),
+		webauthn: webauthn,
 	}
 }
 
 type RegisterRequest struct {
 	PhoneNumber string `json:"phone_number" binding:"required"`
+	Code        string `json:"code" binding:"required"` // SMS code proving the number belongs to the caller
 	Username    string `json:"username"`
 	Password    string `json:"password"`
 	UserType    string `json:"user_type"` // "normal" or "company"
@@ -43,11 +57,13 @@ type RegisterRequest struct {
 
 type LoginRequest struct {
 	PhoneNumber string `json:"phone_number" binding:"required"`
-	Password    string `json:"password"`
+	Password    string `json:"password" binding:"required"`
+	Code        string `json:"code"` // SMS code, required when two-step verification is enabled
 }
 
 type SendCodeRequest struct {
 	PhoneNumber string `json:"phone_number" binding:"required"`
+	Purpose     string `json:"purpose,omitempty"` // login (default), password_reset, ...
 }
 
 type VerifyCodeRequest struct {
@@ -55,10 +71,15 @@ type VerifyCodeRequest struct {
 	Code        string `json:"code" binding:"required"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 type RegisterWithCodeRequest struct {
 	PhoneNumber     string `json:"phone_number" binding:"required"`
 	Code            string `json:"code" binding:"required"`
 	Username        string `json:"username"`
+	Password        string `json:"password"`
 	UserType        string `json:"user_type"` // "normal" or "company"
 	CompanyName     string `json:"company_name,omitempty"`
 	CompanyCategory string `json:"company_category,omitempty"`
@@ -66,12 +87,17 @@ type RegisterWithCodeRequest struct {
 
 // verificationCodeDoc stores phone verification codes.
 type verificationCodeDoc struct {
-	PhoneNumber string    `bson:"phone_number"`
-	Code        string    `bson:"code"`
-	ExpiresAt   time.Time `bson:"expires_at"`
-	CreatedAt   time.Time `bson:"created_at"`
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	PhoneNumber string             `bson:"phone_number"`
+	Code        string             `bson:"code"`
+	Attempts    int                `bson:"attempts"`
+	ExpiresAt   time.Time          `bson:"expires_at"`
+	CreatedAt   time.Time          `bson:"created_at"`
 }
 
+// maxCodeAttempts is how many wrong guesses burn a verification code.
+const maxCodeAttempts = 5
+
 // qrCodeCacheDoc stores QR code to user ID mapping for quick lookup.
 type qrCodeCacheDoc struct {
 	QRData   string    `bson:"qr_data"`
@@ -80,6 +106,9 @@ type qrCodeCacheDoc struct {
 }
 
 func (h *AuthHandler) storeVerificationCode(ctx context.Context, phone, code string, ttl time.Duration) error {
+	// Only the newest code is valid, so requesting codes doesn't add guesses
+	_, _ = h.db.MongoDB.Collection("verification_codes").DeleteMany(ctx, bson.M{"phone_number": phone})
+
 	expiresAt := time.Now().Add(ttl)
 	// Store verification code in MongoDB
 	doc := verificationCodeDoc{
@@ -92,16 +121,30 @@ func (h *AuthHandler) storeVerificationCode(ctx context.Context, phone, code str
 	return err
 }
 
-func (h *AuthHandler) consumeVerificationCode(ctx context.Context, phone, code string) (bool, error) {
-	// Check MongoDB: must match + not expired
-	now := time.Now()
-	filter := bson.M{
-		"phone_number": phone,
-		"code":         code,
-		"expires_at":   bson.M{"$gt": now},
+// consumeVerificationCode checks a code for the phone number. Wrong guesses
+// count against the code (burned after maxCodeAttempts) and against the
+// phone number and IP, which are locked out after too many failures.
+func (h *AuthHandler) consumeVerificationCode(ctx context.Context, phone, code, ip string) (bool, error) {
+	if err := h.guard.CheckVerify(ctx, phone, ip); err != nil {
+		return false, err
 	}
-	err := h.db.MongoDB.Collection("verification_codes").FindOne(ctx, filter).Err()
+
+	// Latest code that has not expired. Every guess takes an attempt before
+	// it is compared, so parallel guesses cannot exceed maxCodeAttempts.
+	now := time.Now()
+	var doc verificationCodeDoc
+	err := h.db.MongoDB.Collection("verification_codes").FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"phone_number": phone,
+			"expires_at":   bson.M{"$gt": now},
+			"attempts":     bson.M{"$lt": maxCodeAttempts},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetSort(bson.M{"created_at": -1}).SetReturnDocument(options.After),
+	).Decode(&doc)
 	if err == mongo.ErrNoDocuments {
+		h.guard.RecordFailure(ctx, phone, ip, "no_code")
 		return false, nil
 	}
 	if err != nil {
@@ -109,21 +152,149 @@ func (h *AuthHandler) consumeVerificationCode(ctx context.Context, phone, code s
 		fmt.Printf("Error finding verification code in MongoDB: %v\n", err)
 		return false, err
 	}
-	// Consume: delete all codes for that phone (prevent reuse)
+
+	if subtle.ConstantTimeCompare([]byte(doc.Code), []byte(code)) != 1 {
+		reason := "wrong_code"
+		if doc.Attempts >= maxCodeAttempts {
+			reason = "code_burned"
+			_, _ = h.db.MongoDB.Collection("verification_codes").DeleteMany(ctx, bson.M{"phone_number": phone})
+		}
+		h.guard.RecordFailure(ctx, phone, ip, reason)
+		return false, nil
+	}
+
+	// Consume: only the request that deletes the code may use it, then drop
+	// every other code for the phone (prevent reuse)
+	deleted, err := h.db.MongoDB.Collection("verification_codes").DeleteOne(ctx, bson.M{"_id": doc.ID})
+	if err != nil {
+		return false, err
+	}
+	if deleted.DeletedCount == 0 {
+		return false, nil
+	}
 	_, _ = h.db.MongoDB.Collection("verification_codes").DeleteMany(ctx, bson.M{"phone_number": phone})
+	h.guard.RecordSuccess(ctx, phone)
 	return true, nil
 }
 
+// newNumericCode returns a random 6-digit code.
+func newNumericCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// respondVerificationError writes 429 for throttled callers and 500 otherwise.
+func respondVerificationError(c *gin.Context, err error) {
+	if throttled, ok := err.(*utils.ThrottleError); ok {
+		retryAfter := int(throttled.RetryAfter.Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many attempts, try again later",
+			"reason":      throttled.Reason,
+			"retry_after": retryAfter,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Verification lookup failed"})
+}
+
+// sessionInfo describes the requesting client for the session record.
+func sessionInfo(c *gin.Context) utils.SessionInfo {
+	deviceName := c.GetHeader("X-Device-Name")
+	if deviceName == "" {
+		deviceName = c.Request.UserAgent()
+	}
+	userAgent := c.Request.UserAgent()
+	return utils.SessionInfo{
+		DeviceID:     utils.DeviceID(c.GetHeader("X-Device-ID"), userAgent),
+		DeviceName:   deviceName,
+		DeviceType:   utils.DeviceType(c.GetHeader("X-Device-Type"), userAgent),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    userAgent,
+		DeviceSecret: c.GetHeader("X-Device-Secret"),
+	}
+}
+
+// errAccountDeleted refuses logins to deleted accounts.
+var errAccountDeleted = errors.New("account has been deleted")
+
+// openSession opens a session for a login that passed all its steps and
+// alerts the user when it comes from a device they have not used before.
+func (h *AuthHandler) openSession(ctx context.Context, user models.User, info utils.SessionInfo) (*utils.TokenPair, error) {
+	if user.AccountStatus == "deleted" {
+		return nil, errAccountDeleted
+	}
+
+	tokens, err := h.sessions.CreateSession(ctx, user.ID, info)
+	if err != nil {
+		return nil, err
+	}
+	// The first device of an account is not news to anyone
+	if len(user.ActiveDevices) > 0 && !utils.KnownDevice(user, info.DeviceID, info.DeviceSecret) {
+		h.sendLoginAlert(ctx, user.ID, info)
+	}
+	return tokens, nil
+}
+
+// respondWithTokens opens a session for the user and writes the login response.
+func (h *AuthHandler) respondWithTokens(c *gin.Context, status int, user models.User, extra gin.H) {
+	tokens, err := h.openSession(c.Request.Context(), user, sessionInfo(c))
+	if err == errAccountDeleted {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account has been deleted"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	response := gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+		"device_secret": tokens.DeviceSecret,
+		"user":          user,
+	}
+	for k, v := range extra {
+		response[k] = v
+	}
+	c.JSON(status, response)
+}
+
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !normalizeRequestPhone(c, &req.PhoneNumber) {
+		return
+	}
+	if req.Username != "" {
+		if err := utils.ValidateUsername("user", utils.NormalizeUsername(req.Username)); err != nil {
+			respondUsernameError(c, err)
+			return
+		}
+	}
+
+	// The number must be proven before an account (and its password) is
+	// attached to it
+	ok, err := h.consumeVerificationCode(context.Background(), req.PhoneNumber, req.Code, c.ClientIP())
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+		return
+	}
 
 	// Check if user exists
 	var existingUser models.User
-	err := h.db.MongoDB.Collection("users").FindOne(
+	err = h.db.MongoDB.Collection("users").FindOne(
 		context.Background(),
 		bson.M{"phone_number": req.PhoneNumber},
 	).Decode(&existingUser)
@@ -133,15 +304,18 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Hash password if provided (for future use)
-	// Note: Password field is not yet in User model
+	// Hash password if provided
+	var passwordHash string
 	if req.Password != "" {
-		_, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err := validatePassword(req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		passwordHash, err = hashPassword(req.Password)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 			return
 		}
-		// TODO: Add password field to User model and store hashedPassword
 	}
 
 	// Generate QR code
@@ -152,6 +326,15 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// Claim the username before the account exists so it cannot be taken twice
+	if req.Username != "" {
+		req.Username, err = utils.ClaimUsername(context.Background(), h.db, "user", userID, req.Username)
+		if err != nil {
+			respondUsernameError(c, err)
+			return
+		}
+	}
+
 	// Create user
 	userType := req.UserType
 	if userType == "" {
@@ -162,6 +345,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		PhoneNumber:     req.PhoneNumber,
 		QRCode:          qrBase64,
 		Username:        req.Username,
+		PasswordHash:    passwordHash,
 		UserType:        userType,
 		CompanyName:     req.CompanyName,
 		CompanyCategory: req.CompanyCategory,
@@ -174,6 +358,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	_, err = h.db.MongoDB.Collection("users").InsertOne(context.Background(), user)
 	if err != nil {
+		_ = utils.ReleaseUsername(context.Background(), h.db, "user", userID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
@@ -189,18 +374,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	update := bson.M{"$set": qrCacheDoc}
 	_, _ = h.db.MongoDB.Collection("qr_code_cache").UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
 
-	// Generate token
-	token, err := utils.GenerateToken(userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
-	}
-
-	c.JSON(http.StatusCreated, gin.H{
-		"token": token,
-		"user":  user,
-		"qr":    qrBase64,
-	})
+	// Open session
+	h.respondWithTokens(c, http.StatusCreated, user, gin.H{"qr": qrBase64})
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -209,31 +384,60 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !normalizeRequestPhone(c, &req.PhoneNumber) {
+		return
+	}
+
+	ctx := context.Background()
+	ip := c.ClientIP()
+	if err := h.guard.CheckVerify(ctx, req.PhoneNumber, ip); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
 
 	var user models.User
 	err := h.db.MongoDB.Collection("users").FindOne(
-		context.Background(),
+		ctx,
 		bson.M{"phone_number": req.PhoneNumber},
 	).Decode(&user)
 
 	if err == mongo.ErrNoDocuments {
+		h.guard.RecordFailure(ctx, req.PhoneNumber, ip, "wrong_password")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
-
-	// In a real app, verify password here
-	// For now, we'll just check if user exists
-
-	token, err := utils.GenerateToken(user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
-	})
+	// Accounts created through SMS only have no password to check against
+	if user.PasswordHash == "" || !checkPassword(user.PasswordHash, req.Password) {
+		h.guard.RecordFailure(ctx, req.PhoneNumber, ip, "wrong_password")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	h.guard.RecordSuccess(ctx, req.PhoneNumber)
+
+	// With two-step verification the password alone is not enough
+	if user.TwoStepEnabled {
+		if req.Code == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Verification code required", "code_required": true})
+			return
+		}
+		ok, err := h.consumeVerificationCode(ctx, req.PhoneNumber, req.Code, ip)
+		if err != nil {
+			respondVerificationError(c, err)
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+			return
+		}
+	}
+
+	// The password step is done; TOTP may still be required
+	h.finishLogin(c, user, "password")
 }
 
 func (h *AuthHandler) GetQRCode(c *gin.Context) {
@@ -244,6 +448,13 @@ func (h *AuthHandler) GetQRCode(c *gin.Context) {
 		return
 	}
 
+	// The code is what lets others add the user as a contact, so only its
+	// owner may fetch it
+	if callerID, _ := c.Get("user_id"); userID != callerID.(primitive.ObjectID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
 	var user models.User
 	err = h.db.MongoDB.Collection("users").FindOne(
 		context.Background(),
@@ -258,6 +469,19 @@ func (h *AuthHandler) GetQRCode(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"qr_code": user.QRCode})
 }
 
+// normalizeRequestPhone rewrites a phone number from a request in E.164 form
+// so that codes, throttling and accounts all key on the same string. It
+// answers 400 and returns false if the number is not valid.
+func normalizeRequestPhone(c *gin.Context, phone *string) bool {
+	normalized := utils.NormalizePhone(*phone)
+	if normalized == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number format"})
+		return false
+	}
+	*phone = normalized
+	return true
+}
+
 // SendCode sends a verification code to the phone number
 func (h *AuthHandler) SendCode(c *gin.Context) {
 	var req SendCodeRequest
@@ -265,26 +489,22 @@ func (h *AuthHandler) SendCode(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
 		return
 	}
-
-	// Validate phone number
-	if req.PhoneNumber == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Phone number is required"})
+	if !normalizeRequestPhone(c, &req.PhoneNumber) {
 		return
 	}
 
-	// Basic phone number validation (should start with + and have at least 10 digits)
-	if len(req.PhoneNumber) < 10 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number format"})
+	// Per-phone and per-IP send throttling (SMS pumping)
+	if err := h.guard.AllowSend(context.Background(), req.PhoneNumber, c.ClientIP()); err != nil {
+		respondVerificationError(c, err)
 		return
 	}
 
 	// Generate 6-digit code
-	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	code, err := newNumericCode()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate code"})
 		return
 	}
-	code := fmt.Sprintf("%06d", n.Int64())
 
 	// Store code with 5 minute expiration (Redis preferred, Mongo fallback)
 	if err := h.storeVerificationCode(context.Background(), req.PhoneNumber, code, 5*time.Minute); err != nil {
@@ -293,33 +513,50 @@ func (h *AuthHandler) SendCode(c *gin.Context) {
 		return
 	}
 
-	// Send SMS via Twilio
-	twilioSent := false
-	if h.twilio != nil && h.twilio.IsEnabled() {
-		err = h.twilio.SendVerificationCode(req.PhoneNumber, code)
-		if err != nil {
-			// Log error but don't fail the request - code is still stored in Redis
-			fmt.Printf("Failed to send SMS via Twilio: %v\n", err)
-		} else {
-			twilioSent = true
-		}
+	if req.Purpose == "" {
+		req.Purpose = "login"
+	}
+
+	delivery, err := h.otp.Send(context.Background(), h.otpRecipient(req.PhoneNumber), code, req.Purpose)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to deliver verification code", "delivery_id": delivery.ID})
+		return
 	}
 
 	// Response
 	response := gin.H{
-		"message": "Verification code sent",
-		"success": true,
+		"message":     "Verification code sent",
+		"success":     true,
+		"delivery_id": delivery.ID,
+		"channel":     delivery.Channel,
 	}
 
-	// Only return code in development mode (when Twilio is disabled or failed)
-	// In production with Twilio enabled, don't return the code
-	if h.twilio == nil || !h.twilio.IsEnabled() || !twilioSent {
-		response["code"] = code // Development mode or Twilio failed
+	// Only return the code when it went to the development sink
+	if devDelivery(delivery) {
+		response["code"] = code
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// devDelivery reports whether a code went to the development sink and may be
+// returned to the client. Release builds never return codes.
+func devDelivery(delivery *models.OTPDelivery) bool {
+	return delivery.Channel == utils.OTPChannelDev && gin.Mode() != gin.ReleaseMode
+}
+
+// otpRecipient adds the account's verified email address, if any, so email
+// providers can be used for existing users.
+func (h *AuthHandler) otpRecipient(phone string) utils.OTPRecipient {
+	recipient := utils.OTPRecipient{PhoneNumber: phone}
+
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(context.Background(), bson.M{"phone_number": phone}).Decode(&user); err == nil {
+		recipient.Email = user.Email
+	}
+	return recipient
+}
+
 // VerifyCode verifies the code for login
 func (h *AuthHandler) VerifyCode(c *gin.Context) {
 	var req VerifyCodeRequest
@@ -327,15 +564,18 @@ func (h *AuthHandler) VerifyCode(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !normalizeRequestPhone(c, &req.PhoneNumber) {
+		return
+	}
 
 	// Create context with timeout for database operations
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	ok, err := h.consumeVerificationCode(ctx, req.PhoneNumber, req.Code)
+	ok, err := h.consumeVerificationCode(ctx, req.PhoneNumber, req.Code, c.ClientIP())
 	if err != nil {
 		fmt.Printf("Error consuming verification code: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Verification lookup failed"})
+		respondVerificationError(c, err)
 		return
 	}
 	if !ok {
@@ -365,17 +605,8 @@ func (h *AuthHandler) VerifyCode(c *gin.Context) {
 		return
 	}
 
-	// Generate token
-	token, err := utils.GenerateToken(user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
-	})
+	// Issue tokens, or ask for the cloud password first
+	h.finishLogin(c, user)
 }
 
 // RegisterWithCode registers a new user after code verification
@@ -385,6 +616,15 @@ func (h *AuthHandler) RegisterWithCode(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !normalizeRequestPhone(c, &req.PhoneNumber) {
+		return
+	}
+	if req.Username != "" {
+		if err := utils.ValidateUsername("user", utils.NormalizeUsername(req.Username)); err != nil {
+			respondUsernameError(c, err)
+			return
+		}
+	}
 
 	// Validate user type
 	if req.UserType != "normal" && req.UserType != "company" {
@@ -405,9 +645,9 @@ func (h *AuthHandler) RegisterWithCode(c *gin.Context) {
 	}
 
 	// Verify code
-	ok, err := h.consumeVerificationCode(context.Background(), req.PhoneNumber, req.Code)
+	ok, err := h.consumeVerificationCode(context.Background(), req.PhoneNumber, req.Code, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Verification lookup failed"})
+		respondVerificationError(c, err)
 		return
 	}
 	if !ok {
@@ -427,6 +667,20 @@ func (h *AuthHandler) RegisterWithCode(c *gin.Context) {
 		return
 	}
 
+	// Hash password if provided
+	var passwordHash string
+	if req.Password != "" {
+		if err := validatePassword(req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		passwordHash, err = hashPassword(req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+	}
+
 	// Generate QR code
 	userID := primitive.NewObjectID()
 	qrData, qrBase64, err := utils.GenerateQRCode(userID.Hex())
@@ -435,12 +689,22 @@ func (h *AuthHandler) RegisterWithCode(c *gin.Context) {
 		return
 	}
 
+	// Claim the username before the account exists so it cannot be taken twice
+	if req.Username != "" {
+		req.Username, err = utils.ClaimUsername(context.Background(), h.db, "user", userID, req.Username)
+		if err != nil {
+			respondUsernameError(c, err)
+			return
+		}
+	}
+
 	// Create user
 	user := models.User{
 		ID:              userID,
 		PhoneNumber:     req.PhoneNumber,
 		QRCode:          qrBase64,
 		Username:        req.Username,
+		PasswordHash:    passwordHash,
 		UserType:        req.UserType,
 		CompanyName:     req.CompanyName,
 		CompanyCategory: req.CompanyCategory,
@@ -453,6 +717,7 @@ func (h *AuthHandler) RegisterWithCode(c *gin.Context) {
 
 	_, err = h.db.MongoDB.Collection("users").InsertOne(context.Background(), user)
 	if err != nil {
+		_ = utils.ReleaseUsername(context.Background(), h.db, "user", userID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
@@ -468,18 +733,8 @@ func (h *AuthHandler) RegisterWithCode(c *gin.Context) {
 	update := bson.M{"$set": qrCacheDoc}
 	_, _ = h.db.MongoDB.Collection("qr_code_cache").UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
 
-	// Generate token
-	token, err := utils.GenerateToken(userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
-	}
-
-	c.JSON(http.StatusCreated, gin.H{
-		"token": token,
-		"user":  user,
-		"qr":    qrBase64,
-	})
+	// Open session
+	h.respondWithTokens(c, http.StatusCreated, user, gin.H{"qr": qrBase64})
 }
 
 func (h *AuthHandler) VerifyPhone(c *gin.Context) {
@@ -487,7 +742,50 @@ func (h *AuthHandler) VerifyPhone(c *gin.Context) {
 	h.SendCode(c)
 }
 
+// Refresh exchanges a refresh token for a new token pair. The old refresh
+// token is consumed; presenting it again terminates the whole session.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.sessions.Refresh(c.Request.Context(), req.RefreshToken, sessionInfo(c))
+	switch err {
+	case nil:
+	case utils.ErrRefreshTokenReused:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, session terminated"})
+		return
+	case utils.ErrSessionIdle:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session ended after inactivity", "reason": "auto_logout"})
+		return
+	case utils.ErrInvalidRefreshToken, utils.ErrSessionRevoked:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+	})
+}
 
+// Logout terminates the current session.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+	sessionID, _ := c.Get("session_id")
+	sessionIDObj := sessionID.(primitive.ObjectID)
 
+	if err := h.sessions.Revoke(c.Request.Context(), userIDObj, sessionIDObj, "logout"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
 
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
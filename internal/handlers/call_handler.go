@@ -7,11 +7,13 @@ import (
 
 	"chat-backend/internal/database"
 	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
 	"chat-backend/internal/websocket"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type CallHandler struct {
@@ -45,10 +47,38 @@ func (h *CallHandler) InitiateCall(c *gin.Context) {
 		return
 	}
 
+	chat, ok := memberChat(c, h.db, chatID)
+	if !ok {
+		return
+	}
+	if (chat.Type == "group" || chat.Type == "channel") && !requireAdminPermission(c, chat, models.PermManageCalls) {
+		return
+	}
+
+	// In a direct chat blocks and the other member's calls privacy decide
+	// whether the call can be placed at all
+	viewer := utils.NewProfileViewer(h.db, userIDObj)
+	if chat.Type == "direct" {
+		for _, memberID := range chat.Members {
+			if memberID == userIDObj {
+				continue
+			}
+			if viewer.Blocked(c.Request.Context(), memberID) || !viewer.Allows(c.Request.Context(), memberID, utils.PrivacyCalls) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "This user does not accept calls from you"})
+				return
+			}
+		}
+	}
+
+	// Only members of the chat who accept calls from the caller, and are not
+	// separated from them by a block, can be called from it
 	members := []primitive.ObjectID{userIDObj}
 	for _, memberIDStr := range req.Members {
 		memberID, err := primitive.ObjectIDFromHex(memberIDStr)
-		if err != nil {
+		if err != nil || memberID == userIDObj || !utils.IsChatMember(chat, memberID) {
+			continue
+		}
+		if viewer.Blocked(c.Request.Context(), memberID) || !viewer.Allows(c.Request.Context(), memberID, utils.PrivacyCalls) {
 			continue
 		}
 		members = append(members, memberID)
@@ -76,6 +106,26 @@ func (h *CallHandler) InitiateCall(c *gin.Context) {
 	c.JSON(http.StatusCreated, call)
 }
 
+// callParticipant writes the error response and returns nil unless the
+// caller is one of the call's members.
+func (h *CallHandler) callParticipant(c *gin.Context, callID primitive.ObjectID) *models.Call {
+	userID, _ := c.Get("user_id")
+	var call models.Call
+	err := h.db.MongoDB.Collection("calls").FindOne(
+		c.Request.Context(),
+		bson.M{"_id": callID, "members": userID},
+	).Decode(&call)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant of this call"})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load call"})
+		return nil
+	}
+	return &call
+}
+
 func (h *CallHandler) AnswerCall(c *gin.Context) {
 	callIDStr := c.Param("call_id")
 	callID, err := primitive.ObjectIDFromHex(callIDStr)
@@ -83,6 +133,9 @@ func (h *CallHandler) AnswerCall(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid call ID"})
 		return
 	}
+	if h.callParticipant(c, callID) == nil {
+		return
+	}
 
 	_, err = h.db.MongoDB.Collection("calls").UpdateOne(
 		context.Background(),
@@ -105,6 +158,22 @@ func (h *CallHandler) EndCall(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid call ID"})
 		return
 	}
+	call := h.callParticipant(c, callID)
+	if call == nil {
+		return
+	}
+
+	// Group calls end for everyone, so only their starter or a call manager may end them
+	userID, _ := c.Get("user_id")
+	if call.CallerID != userID.(primitive.ObjectID) {
+		chat, ok := memberChat(c, h.db, call.ChatID)
+		if !ok {
+			return
+		}
+		if (chat.Type == "group" || chat.Type == "channel") && !requireAdminPermission(c, chat, models.PermManageCalls) {
+			return
+		}
+	}
 
 	now := time.Now()
 	_, err = h.db.MongoDB.Collection("calls").UpdateOne(
@@ -7,6 +7,8 @@ import (
 
 	"chat-backend/internal/database"
 	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+	"chat-backend/internal/websocket"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,11 +16,12 @@ import (
 )
 
 type ChannelHandler struct {
-	db *database.Database
+	db  *database.Database
+	hub *websocket.Hub
 }
 
-func NewChannelHandler(db *database.Database) *ChannelHandler {
-	return &ChannelHandler{db: db}
+func NewChannelHandler(db *database.Database, hub *websocket.Hub) *ChannelHandler {
+	return &ChannelHandler{db: db, hub: hub}
 }
 
 func (h *ChannelHandler) CreateChannel(c *gin.Context) {
@@ -29,22 +32,32 @@ func (h *ChannelHandler) CreateChannel(c *gin.Context) {
 		ChannelName string `json:"channel_name" binding:"required"`
 		Description string `json:"description,omitempty"`
 		IsPublic    bool   `json:"is_public"`
-		PublicLink  string `json:"public_link,omitempty"` // t.me/channelname
+		PublicLink  string `json:"public_link,omitempty"` // channel username, "@name" and "t.me/name" are accepted
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	channelID := primitive.NewObjectID()
+	if req.PublicLink != "" {
+		var err error
+		req.PublicLink, err = utils.ClaimUsername(context.Background(), h.db, "channel", channelID, req.PublicLink)
+		if err != nil {
+			respondUsernameError(c, err)
+			return
+		}
+	}
+
 	channel := models.Chat{
-		ID:          primitive.NewObjectID(),
+		ID:          channelID,
 		Type:        "channel",
 		Members:     []primitive.ObjectID{userIDObj},
 		Admins: []models.AdminRole{
 			{
 				UserID:      userIDObj,
 				Role:        "owner",
-				Permissions: []string{"all"},
+				Permissions: []models.AdminPermission{models.PermAll},
 				GrantedAt:   time.Now(),
 				GrantedBy:   userIDObj,
 			},
@@ -61,6 +74,7 @@ func (h *ChannelHandler) CreateChannel(c *gin.Context) {
 
 	_, err := h.db.MongoDB.Collection("chats").InsertOne(context.Background(), channel)
 	if err != nil {
+		_ = utils.ReleaseUsername(context.Background(), h.db, "channel", channelID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create channel"})
 		return
 	}
@@ -68,6 +82,11 @@ func (h *ChannelHandler) CreateChannel(c *gin.Context) {
 	c.JSON(http.StatusCreated, channel)
 }
 
+// UpdateUsername sets, changes or removes the channel's public username.
+func (h *ChannelHandler) UpdateUsername(c *gin.Context) {
+	changeChatUsername(c, h.db, "channel", "channel_id")
+}
+
 func (h *ChannelHandler) Subscribe(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userIDObj := userID.(primitive.ObjectID)
@@ -90,6 +109,25 @@ func (h *ChannelHandler) Subscribe(c *gin.Context) {
 		return
 	}
 
+	// Private channels can only be joined through an invite
+	if channel.PublicLink == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This channel is private"})
+		return
+	}
+	if utils.IsChatMember(&channel, userIDObj) {
+		c.JSON(http.StatusOK, gin.H{"message": "Subscribed to channel"})
+		return
+	}
+	ban, err := utils.ActiveBan(c.Request.Context(), h.db, channelID, userIDObj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check bans"})
+		return
+	}
+	if ban != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are banned from this channel", "until_date": ban.UntilDate})
+		return
+	}
+
 	// Add user to members
 	_, err = h.db.MongoDB.Collection("chats").UpdateOne(
 		context.Background(),
@@ -108,6 +146,7 @@ func (h *ChannelHandler) Subscribe(c *gin.Context) {
 		bson.M{"_id": channelID},
 		bson.M{"$inc": bson.M{"subscriber_count": 1}},
 	)
+	utils.LogMemberEvent(c.Request.Context(), h.db, channelID, userIDObj, models.EventMemberJoined, userIDObj)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Subscribed to channel"})
 }
@@ -134,6 +173,7 @@ func (h *ChannelHandler) Unsubscribe(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe"})
 		return
 	}
+	h.hub.LeaveRoom(userIDObj, channelID)
 
 	// Decrement subscriber count
 	_, err = h.db.MongoDB.Collection("chats").UpdateOne(
@@ -141,6 +181,7 @@ func (h *ChannelHandler) Unsubscribe(c *gin.Context) {
 		bson.M{"_id": channelID},
 		bson.M{"$inc": bson.M{"subscriber_count": -1}},
 	)
+	utils.LogMemberEvent(c.Request.Context(), h.db, channelID, userIDObj, models.EventMemberLeft, userIDObj)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed from channel"})
 }
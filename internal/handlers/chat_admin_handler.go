@@ -0,0 +1,833 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+	"chat-backend/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChatAdminHandler manages the admins, bans, invite links and join requests
+// of groups or channels, whose ID is taken from the param route parameter.
+type ChatAdminHandler struct {
+	db       *database.Database
+	hub      *websocket.Hub
+	chatType string
+	param    string
+}
+
+func NewChatAdminHandler(db *database.Database, hub *websocket.Hub, chatType, param string) *ChatAdminHandler {
+	return &ChatAdminHandler{db: db, hub: hub, chatType: chatType, param: param}
+}
+
+type PromoteAdminRequest struct {
+	UserID      string                   `json:"user_id" binding:"required"`
+	Permissions []models.AdminPermission `json:"permissions"`
+	Title       string                   `json:"title,omitempty"`
+}
+
+type BanUserRequest struct {
+	UserID    string     `json:"user_id" binding:"required"`
+	UntilDate *time.Time `json:"until_date,omitempty"` // unset bans until lifted
+}
+
+type CreateInviteLinkRequest struct {
+	Name             string     `json:"name,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	MemberLimit      int        `json:"member_limit,omitempty"` // 0 = unlimited
+	RequiresApproval bool       `json:"requires_approval"`
+}
+
+type TransferOwnershipRequest struct {
+	UserID   string `json:"user_id" binding:"required"`
+	Password string `json:"password,omitempty"` // required when the owner has a password
+}
+
+// requireAdminPermission writes a 403 and returns false unless the caller
+// holds the permission in the chat.
+func requireAdminPermission(c *gin.Context, chat *models.Chat, permission models.AdminPermission) bool {
+	userID, _ := c.Get("user_id")
+	if utils.HasAdminPermission(chat, userID.(primitive.ObjectID), permission) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":      "You need the " + string(permission) + " admin permission",
+		"permission": permission,
+	})
+	return false
+}
+
+// checkSendRights writes a 403 and returns false if the group's or the
+// member's restrictions forbid the message.
+func checkSendRights(c *gin.Context, db *database.Database, chat *models.Chat, userID primitive.ObjectID, message *models.Message) bool {
+	err := utils.CheckSendRights(c.Request.Context(), db, chat, userID, message)
+	if err == nil {
+		return true
+	}
+	var restricted *utils.RestrictedError
+	if !errors.As(err, &restricted) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check restrictions"})
+		return false
+	}
+	response := gin.H{"error": restrictedMessages[restricted.Right], "restriction": restricted.Right}
+	if restricted.UntilDate != nil {
+		response["until_date"] = restricted.UntilDate
+	}
+	c.JSON(http.StatusForbidden, response)
+	return false
+}
+
+var restrictedMessages = map[string]string{
+	utils.RightSendMessages: "You are not allowed to send messages in this group",
+	utils.RightSendMedia:    "You are not allowed to send media in this group",
+	utils.RightSendLinks:    "You are not allowed to send links in this group",
+	utils.RightSendPolls:    "You are not allowed to send polls in this group",
+}
+
+// chat returns the group or channel loaded by the route's membership
+// middleware, writing the error response if it is not of the handler's type.
+func (h *ChatAdminHandler) chat(c *gin.Context) (*models.Chat, bool) {
+	chatID, err := primitive.ObjectIDFromHex(c.Param(h.param))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		return nil, false
+	}
+	chat, ok := memberChat(c, h.db, chatID)
+	if !ok {
+		return nil, false
+	}
+	if chat.Type != h.chatType {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+		return nil, false
+	}
+	return chat, true
+}
+
+// GetAdmins lists the chat's owner and admins with their permissions.
+func (h *ChatAdminHandler) GetAdmins(c *gin.Context) {
+	chat, ok := h.chat(c)
+	if !ok {
+		return
+	}
+	admins := chat.Admins
+	if admins == nil {
+		admins = []models.AdminRole{}
+	}
+	c.JSON(http.StatusOK, admins)
+}
+
+// PromoteAdmin makes a member an admin, or changes an admin's permissions.
+// Admins other than the owner can only grant permissions they hold and only
+// edit admins they promoted themselves.
+func (h *ChatAdminHandler) PromoteAdmin(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	chat, ok := h.chat(c)
+	if !ok || !requireAdminPermission(c, chat, models.PermAddAdmins) {
+		return
+	}
+
+	var req PromoteAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	targetID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	permissions, err := utils.ValidateAdminPermissions(req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, p := range permissions {
+		if chat.Type != "channel" && (p == models.PermPostMessages || p == models.PermEditMessages) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": string(p) + " only applies to channels"})
+			return
+		}
+		if !utils.HasAdminPermission(chat, userIDObj, p) {
+			c.JSON(http.StatusForbidden, gin.H{"error": utils.ErrPermissionNotHeld.Error(), "permission": p})
+			return
+		}
+	}
+
+	if !utils.IsChatMember(chat, targetID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is not a member of this chat"})
+		return
+	}
+	existing := utils.ChatAdmin(chat, targetID)
+	if existing != nil && existing.Role == "owner" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The owner's permissions cannot be changed"})
+		return
+	}
+	if existing != nil && !utils.IsChatOwner(chat, userIDObj) && existing.GrantedBy != userIDObj {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit admins you promoted"})
+		return
+	}
+
+	role := models.AdminRole{
+		UserID:      targetID,
+		Role:        "admin",
+		Permissions: permissions,
+		Title:       req.Title,
+		GrantedAt:   time.Now(),
+		GrantedBy:   userIDObj,
+	}
+
+	chats := h.db.MongoDB.Collection("chats")
+	ctx := c.Request.Context()
+	if existing != nil {
+		_, err = chats.UpdateOne(
+			ctx,
+			bson.M{"_id": chat.ID, "admins": bson.M{"$elemMatch": bson.M{"user_id": targetID, "role": bson.M{"$ne": "owner"}}}},
+			bson.M{"$set": bson.M{"admins.$": role, "updated_at": time.Now()}},
+		)
+	} else {
+		_, err = chats.UpdateOne(
+			ctx,
+			bson.M{"_id": chat.ID, "members": targetID, "admins.user_id": bson.M{"$ne": targetID}},
+			bson.M{"$push": bson.M{"admins": role}, "$set": bson.M{"updated_at": time.Now()}},
+		)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update admin"})
+		return
+	}
+	event := models.ChatEvent{
+		ChatID:       chat.ID,
+		ActorID:      userIDObj,
+		Action:       models.EventAdminPromoted,
+		TargetUserID: &targetID,
+		NewValue:     role,
+	}
+	if existing != nil {
+		event.OldValue = *existing
+	}
+	utils.LogChatEvent(ctx, h.db, event)
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DemoteAdmin removes an admin's rights. Admins may always step down
+// themselves; the owner cannot be demoted.
+func (h *ChatAdminHandler) DemoteAdmin(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	chat, ok := h.chat(c)
+	if !ok {
+		return
+	}
+	targetID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	existing := utils.ChatAdmin(chat, targetID)
+	if existing == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not an admin"})
+		return
+	}
+	if existing.Role == "owner" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The owner cannot be demoted; transfer ownership instead"})
+		return
+	}
+	if targetID != userIDObj {
+		if !requireAdminPermission(c, chat, models.PermAddAdmins) {
+			return
+		}
+		if !utils.IsChatOwner(chat, userIDObj) && existing.GrantedBy != userIDObj {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only demote admins you promoted"})
+			return
+		}
+	}
+
+	_, err = h.db.MongoDB.Collection("chats").UpdateOne(
+		c.Request.Context(),
+		bson.M{"_id": chat.ID},
+		bson.M{
+			"$pull": bson.M{"admins": bson.M{"user_id": targetID, "role": bson.M{"$ne": "owner"}}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to demote admin"})
+		return
+	}
+	utils.LogChatEvent(c.Request.Context(), h.db, models.ChatEvent{
+		ChatID:       chat.ID,
+		ActorID:      userIDObj,
+		Action:       models.EventAdminDemoted,
+		TargetUserID: &targetID,
+		OldValue:     *existing,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Admin demoted"})
+}
+
+// TransferOwnership hands the chat to another member. The previous owner
+// stays on as an admin with every permission.
+func (h *ChatAdminHandler) TransferOwnership(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	chat, ok := h.chat(c)
+	if !ok {
+		return
+	}
+	if !utils.IsChatOwner(chat, userIDObj) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can transfer ownership"})
+		return
+	}
+
+	var req TransferOwnershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	targetID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if targetID == userIDObj {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already own this chat"})
+		return
+	}
+	if !utils.IsChatMember(chat, targetID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is not a member of this chat"})
+		return
+	}
+
+	// A stolen session alone must not be able to give the chat away
+	ctx := c.Request.Context()
+	var owner models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&owner); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if owner.PasswordHash != "" && !checkPassword(owner.PasswordHash, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	permissions := make([]models.AdminPermission, 0, len(utils.AdminPermissions))
+	for _, p := range utils.AdminPermissions {
+		if chat.Type == "channel" || (p != models.PermPostMessages && p != models.PermEditMessages) {
+			permissions = append(permissions, p)
+		}
+	}
+
+	now := time.Now()
+	admins := make([]models.AdminRole, 0, len(chat.Admins)+1)
+	for _, admin := range chat.Admins {
+		switch admin.UserID {
+		case targetID:
+			continue
+		case userIDObj:
+			admin.Role = "admin"
+			admin.Permissions = permissions
+			admin.GrantedAt = now
+			admin.GrantedBy = targetID
+		}
+		admins = append(admins, admin)
+	}
+	admins = append(admins, models.AdminRole{
+		UserID:      targetID,
+		Role:        "owner",
+		Permissions: []models.AdminPermission{models.PermAll},
+		GrantedAt:   now,
+		GrantedBy:   userIDObj,
+	})
+
+	result, err := h.db.MongoDB.Collection("chats").UpdateOne(
+		ctx,
+		bson.M{
+			"_id":     chat.ID,
+			"members": targetID,
+			"admins":  bson.M{"$elemMatch": bson.M{"user_id": userIDObj, "role": "owner"}},
+		},
+		bson.M{"$set": bson.M{"admins": admins, "updated_at": now}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Chat changed, try again"})
+		return
+	}
+	utils.LogMemberEvent(ctx, h.db, chat.ID, userIDObj, models.EventOwnershipTransferred, targetID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ownership transferred", "owner_id": targetID})
+}
+
+// BanUser removes the user from the chat and keeps them from rejoining until
+// the ban expires or is lifted. Users who are not members can be banned too.
+func (h *ChatAdminHandler) BanUser(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	chat, ok := h.chat(c)
+	if !ok || !requireAdminPermission(c, chat, models.PermBanUsers) {
+		return
+	}
+
+	var req BanUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	targetID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if req.UntilDate != nil && !req.UntilDate.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "until_date must be in the future"})
+		return
+	}
+	if targetID == userIDObj {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot ban yourself"})
+		return
+	}
+	target := utils.ChatAdmin(chat, targetID)
+	if target != nil && target.Role == "owner" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The owner cannot be banned"})
+		return
+	}
+	if target != nil && !utils.IsChatOwner(chat, userIDObj) && target.GrantedBy != userIDObj {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only ban admins you promoted"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	ban := models.MemberRestriction{
+		ChatID:       chat.ID,
+		UserID:       targetID,
+		Kind:         models.RestrictionBan,
+		UntilDate:    req.UntilDate,
+		RestrictedBy: userIDObj,
+		CreatedAt:    time.Now(),
+	}
+	if err := utils.SaveMemberRestriction(ctx, h.db, &ban); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ban user"})
+		return
+	}
+
+	update := bson.M{
+		"$pull": bson.M{
+			"members": targetID,
+			"admins":  bson.M{"user_id": targetID, "role": bson.M{"$ne": "owner"}},
+		},
+		"$set": bson.M{"updated_at": time.Now()},
+	}
+	if chat.Type == "channel" {
+		update["$inc"] = bson.M{"subscriber_count": -1}
+	}
+	_, err = h.db.MongoDB.Collection("chats").UpdateOne(ctx, bson.M{"_id": chat.ID, "members": targetID}, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove banned user"})
+		return
+	}
+	h.hub.LeaveRoom(targetID, chat.ID)
+	utils.LogChatEvent(ctx, h.db, models.ChatEvent{
+		ChatID:       chat.ID,
+		ActorID:      userIDObj,
+		Action:       models.EventMemberBanned,
+		TargetUserID: &targetID,
+		NewValue:     gin.H{"until_date": ban.UntilDate},
+	})
+
+	c.JSON(http.StatusOK, ban)
+}
+
+// UnbanUser lifts a ban. The user is not added back; they may rejoin.
+func (h *ChatAdminHandler) UnbanUser(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	chat, ok := h.chat(c)
+	if !ok || !requireAdminPermission(c, chat, models.PermBanUsers) {
+		return
+	}
+	targetID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	result, err := h.db.MongoDB.Collection("chat_restrictions").DeleteOne(
+		c.Request.Context(),
+		bson.M{"chat_id": chat.ID, "user_id": targetID, "kind": models.RestrictionBan},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unban user"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not banned"})
+		return
+	}
+	utils.LogMemberEvent(c.Request.Context(), h.db, chat.ID, userID.(primitive.ObjectID), models.EventMemberUnbanned, targetID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unbanned"})
+}
+
+// GetBans lists the chat's active bans, newest first. ?kind=mute or
+// ?kind=restrict lists muted or restricted members instead.
+func (h *ChatAdminHandler) GetBans(c *gin.Context) {
+	chat, ok := h.chat(c)
+	if !ok || !requireAdminPermission(c, chat, models.PermBanUsers) {
+		return
+	}
+
+	filter := bson.M{
+		"chat_id": chat.ID,
+		"$or": []bson.M{
+			{"until_date": nil},
+			{"until_date": bson.M{"$gt": time.Now()}},
+		},
+	}
+	switch kind := c.DefaultQuery("kind", models.RestrictionBan); kind {
+	case models.RestrictionBan, models.RestrictionMute:
+		filter["kind"] = kind
+	case models.RestrictionRestrict:
+		filter["kind"] = bson.M{"$in": []interface{}{models.RestrictionRestrict, nil}}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be ban, mute or restrict"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	cursor, err := h.db.MongoDB.Collection("chat_restrictions").Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bans"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	bans := []models.MemberRestriction{}
+	if err := cursor.All(ctx, &bans); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode bans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, bans)
+}
+
+// GetInviteLinks lists the chat's invite links, newest first, including
+// revoked and expired ones.
+func (h *ChatAdminHandler) GetInviteLinks(c *gin.Context) {
+	chat, ok := h.chat(c)
+	if !ok || !requireAdminPermission(c, chat, models.PermInviteUsers) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	cursor, err := h.db.MongoDB.Collection("invite_links").Find(
+		ctx,
+		bson.M{"chat_id": chat.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invite links"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	links := []models.InviteLink{}
+	if err := cursor.All(ctx, &links); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode invite links"})
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+// CreateInviteLink adds a named invite link. Links that need approval queue
+// join requests instead, so they cannot also limit members.
+func (h *ChatAdminHandler) CreateInviteLink(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	chat, ok := h.chat(c)
+	if !ok || !requireAdminPermission(c, chat, models.PermInviteUsers) {
+		return
+	}
+
+	var req CreateInviteLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+	if req.MemberLimit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "member_limit cannot be negative"})
+		return
+	}
+	if req.MemberLimit > 0 && req.RequiresApproval {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "member_limit cannot be combined with requires_approval"})
+		return
+	}
+
+	code, err := utils.GenerateInviteCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite link"})
+		return
+	}
+	now := time.Now()
+	link := models.InviteLink{
+		ID:               primitive.NewObjectID(),
+		ChatID:           chat.ID,
+		Code:             code,
+		Name:             req.Name,
+		CreatorID:        userIDObj,
+		ExpiresAt:        req.ExpiresAt,
+		MemberLimit:      req.MemberLimit,
+		RequiresApproval: req.RequiresApproval,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if _, err := h.db.MongoDB.Collection("invite_links").InsertOne(c.Request.Context(), link); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite link"})
+		return
+	}
+	utils.LogChatEvent(c.Request.Context(), h.db, models.ChatEvent{
+		ChatID:   chat.ID,
+		ActorID:  userIDObj,
+		Action:   models.EventInviteLinkCreated,
+		NewValue: link,
+	})
+
+	c.JSON(http.StatusCreated, link)
+}
+
+// RevokeInviteLink stops a link from admitting anyone. Only its creator and
+// the owner can revoke it.
+func (h *ChatAdminHandler) RevokeInviteLink(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	chat, ok := h.chat(c)
+	if !ok || !requireAdminPermission(c, chat, models.PermInviteUsers) {
+		return
+	}
+	linkID, err := primitive.ObjectIDFromHex(c.Param("link_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite link ID"})
+		return
+	}
+
+	filter := bson.M{"_id": linkID, "chat_id": chat.ID}
+	if !utils.IsChatOwner(chat, userIDObj) {
+		filter["creator_id"] = userIDObj
+	}
+	result, err := h.db.MongoDB.Collection("invite_links").UpdateOne(
+		c.Request.Context(),
+		filter,
+		bson.M{"$set": bson.M{"revoked": true, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite link"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite link not found"})
+		return
+	}
+	utils.LogChatEvent(c.Request.Context(), h.db, models.ChatEvent{
+		ChatID:   chat.ID,
+		ActorID:  userIDObj,
+		Action:   models.EventInviteLinkRevoked,
+		OldValue: gin.H{"invite_link_id": linkID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite link revoked"})
+}
+
+// GetJoinRequests lists pending join requests, oldest first.
+func (h *ChatAdminHandler) GetJoinRequests(c *gin.Context) {
+	chat, ok := h.chat(c)
+	if !ok || !requireAdminPermission(c, chat, models.PermInviteUsers) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	cursor, err := h.db.MongoDB.Collection("join_requests").Find(
+		ctx,
+		bson.M{"chat_id": chat.ID, "status": "pending"},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch join requests"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	requests := []models.JoinRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode join requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// ApproveJoinRequest adds the requesting user to the chat.
+func (h *ChatAdminHandler) ApproveJoinRequest(c *gin.Context) {
+	h.decideJoinRequest(c, "approved")
+}
+
+// DeclineJoinRequest turns the requesting user away.
+func (h *ChatAdminHandler) DeclineJoinRequest(c *gin.Context) {
+	h.decideJoinRequest(c, "declined")
+}
+
+func (h *ChatAdminHandler) decideJoinRequest(c *gin.Context, status string) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	chat, ok := h.chat(c)
+	if !ok || !requireAdminPermission(c, chat, models.PermInviteUsers) {
+		return
+	}
+	requesterID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if status == "approved" {
+		ban, err := utils.ActiveBan(ctx, h.db, chat.ID, requesterID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check bans"})
+			return
+		}
+		if ban != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User is banned from this chat; unban them first"})
+			return
+		}
+	}
+
+	now := time.Now()
+	var request models.JoinRequest
+	err = h.db.MongoDB.Collection("join_requests").FindOneAndUpdate(
+		ctx,
+		bson.M{"chat_id": chat.ID, "user_id": requesterID, "status": "pending"},
+		bson.M{"$set": bson.M{"status": status, "decided_by": userIDObj, "decided_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&request)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Join request not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update join request"})
+		return
+	}
+
+	action := models.EventJoinRequestDeclined
+	if status == "approved" {
+		action = models.EventJoinRequestApproved
+		if _, err := utils.AddChatMember(ctx, h.db, chat, requesterID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+			return
+		}
+	}
+	utils.LogMemberEvent(ctx, h.db, chat.ID, userIDObj, action, requesterID)
+
+	c.JSON(http.StatusOK, request)
+}
+
+// GetEvents lists the chat's recent admin and membership actions, newest
+// first, for its admins. They can be filtered by comma-separated action,
+// actor_id and target_user_id.
+func (h *ChatAdminHandler) GetEvents(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	chat, ok := h.chat(c)
+	if !ok {
+		return
+	}
+	if utils.ChatAdmin(chat, userID.(primitive.ObjectID)) == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can see recent actions"})
+		return
+	}
+
+	page := 1
+	limit := 50
+	if p := c.Query("page"); p != "" {
+		if parsedPage, err := strconv.Atoi(p); err == nil && parsedPage > 0 {
+			page = parsedPage
+		}
+	}
+	if l := c.Query("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+			limit = parsedLimit
+		}
+	}
+
+	filter := bson.M{"chat_id": chat.ID}
+	if actions := c.Query("action"); actions != "" {
+		filter["action"] = bson.M{"$in": strings.Split(actions, ",")}
+	}
+	for _, param := range []string{"actor_id", "target_user_id"} {
+		if value := c.Query(param); value != "" {
+			id, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			filter[param] = id
+		}
+	}
+
+	ctx := c.Request.Context()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := h.db.MongoDB.Collection("chat_events").Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.ChatEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"page":   page,
+		"limit":  limit,
+	})
+}
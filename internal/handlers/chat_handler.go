@@ -7,11 +7,13 @@ import (
 
 	"chat-backend/internal/database"
 	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
 	"chat-backend/internal/websocket"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ChatHandler struct {
@@ -73,6 +75,9 @@ func (h *ChatHandler) CreateChat(c *gin.Context) {
 		}
 		members = append(members, memberID)
 	}
+	if req.Type == "direct" && !checkNotBlocked(c, h.db, &models.Chat{Type: req.Type, Members: members}, userIDObj) {
+		return
+	}
 
 	chat := models.Chat{
 		ID:        primitive.NewObjectID(),
@@ -194,3 +199,65 @@ func (h *ChatHandler) DeleteMessage(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Message deleted successfully"})
 }
 
+
+// respondChatAccessError writes the response for a chat the caller may not
+// use, see utils.ChatForMember.
+func respondChatAccessError(c *gin.Context, err error) {
+	switch err {
+	case mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+	case utils.ErrNotChatMember:
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this chat"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load chat"})
+	}
+}
+
+// memberChat returns the chat loaded by the route's chat middleware, or
+// loads chatID for chats named in the request body. It writes the error
+// response and returns false if the caller is not a member. The middleware
+// also loads public channels for readers, so the cached chat is only used
+// for members.
+func memberChat(c *gin.Context, db *database.Database, chatID primitive.ObjectID) (*models.Chat, bool) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+	if value, ok := c.Get("chat"); ok {
+		if chat := value.(models.Chat); chat.ID == chatID && utils.IsChatMember(&chat, userIDObj) {
+			return &chat, true
+		}
+	}
+
+	chat, err := utils.ChatForMember(c.Request.Context(), db, chatID, userIDObj)
+	if err != nil {
+		respondChatAccessError(c, err)
+		return nil, false
+	}
+	return chat, true
+}
+
+// errBlocked does not say who blocked whom, so users cannot tell that they
+// were blocked.
+const errBlocked = "Message could not be sent"
+
+// checkNotBlocked writes a 403 and returns false if the chat is a direct
+// chat between users separated by a block.
+func checkNotBlocked(c *gin.Context, db *database.Database, chat *models.Chat, userID primitive.ObjectID) bool {
+	if chat.Type != "direct" {
+		return true
+	}
+	for _, memberID := range chat.Members {
+		if memberID == userID {
+			continue
+		}
+		blocked, err := utils.IsBlocked(c.Request.Context(), db, userID, memberID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check blocked users"})
+			return false
+		}
+		if blocked {
+			c.JSON(http.StatusForbidden, gin.H{"error": errBlocked})
+			return false
+		}
+	}
+	return true
+}
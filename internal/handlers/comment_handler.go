@@ -7,6 +7,7 @@ import (
 
 	"chat-backend/internal/database"
 	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -61,6 +62,7 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 	comment.IsSpam = false
 
 	// Handle reply (parent comment)
+	replyTo := primitive.NilObjectID
 	if comment.ParentID != nil {
 		var parentComment models.Comment
 		err := h.db.MongoDB.Collection("comments").FindOne(
@@ -71,6 +73,24 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent comment not found"})
 			return
 		}
+		replyTo = parentComment.UserID
+	}
+
+	// Users separated by a block cannot comment on each other's products or
+	// reply to each other's comments
+	for _, otherID := range []primitive.ObjectID{product.OwnerID, replyTo} {
+		if otherID.IsZero() || otherID == userIDObj {
+			continue
+		}
+		blocked, err := utils.IsBlocked(c.Request.Context(), h.db, userIDObj, otherID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check blocked users"})
+			return
+		}
+		if blocked {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Comment could not be posted"})
+			return
+		}
 	}
 
 	result, err := h.db.MongoDB.Collection("comments").InsertOne(context.Background(), comment)
@@ -89,16 +109,11 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 	)
 
 	// Get user info
-	var user models.User
-	h.db.MongoDB.Collection("users").FindOne(context.Background(), bson.M{"_id": userIDObj}).Decode(&user)
+	user, _ := profileViewer(c, h.db).UserProfile(c.Request.Context(), userIDObj)
 
 	response := gin.H{
 		"comment": comment,
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"avatar":   user.Avatar,
-		},
+		"user":    user,
 	}
 
 	c.JSON(http.StatusCreated, response)
@@ -140,7 +155,7 @@ func (h *CommentHandler) GetComments(c *gin.Context) {
 	// Populate user info and replies for each comment
 	type CommentWithUser struct {
 		models.Comment
-		User    gin.H                `json:"user"`
+		User    models.PublicProfile `json:"user"`
 		Replies []CommentWithUser    `json:"replies,omitempty"`
 		IsLiked bool                 `json:"is_liked"`
 	}
@@ -152,9 +167,9 @@ func (h *CommentHandler) GetComments(c *gin.Context) {
 		userIDObj = userID.(primitive.ObjectID)
 	}
 
+	viewer := profileViewer(c, h.db)
 	for _, comment := range comments {
-		var user models.User
-		h.db.MongoDB.Collection("users").FindOne(context.Background(), bson.M{"_id": comment.UserID}).Decode(&user)
+		user, _ := viewer.UserProfile(c.Request.Context(), comment.UserID)
 
 		// Check if user liked this comment
 		isLiked := false
@@ -179,8 +194,7 @@ func (h *CommentHandler) GetComments(c *gin.Context) {
 
 		repliesWithUser := make([]CommentWithUser, 0, len(replies))
 		for _, reply := range replies {
-			var replyUser models.User
-			h.db.MongoDB.Collection("users").FindOne(context.Background(), bson.M{"_id": reply.UserID}).Decode(&replyUser)
+			replyUser, _ := viewer.UserProfile(c.Request.Context(), reply.UserID)
 
 			replyIsLiked := false
 			if exists {
@@ -194,22 +208,14 @@ func (h *CommentHandler) GetComments(c *gin.Context) {
 
 			repliesWithUser = append(repliesWithUser, CommentWithUser{
 				Comment: reply,
-				User: gin.H{
-					"id":       replyUser.ID,
-					"username": replyUser.Username,
-					"avatar":   replyUser.Avatar,
-				},
+				User:    replyUser,
 				IsLiked: replyIsLiked,
 			})
 		}
 
 		result = append(result, CommentWithUser{
 			Comment: comment,
-			User: gin.H{
-				"id":       user.ID,
-				"username": user.Username,
-				"avatar":   user.Avatar,
-			},
+			User:    user,
 			Replies: repliesWithUser,
 			IsLiked: isLiked,
 		})
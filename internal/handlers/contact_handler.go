@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
@@ -12,6 +13,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ContactHandler struct {
@@ -47,19 +50,21 @@ func (h *ContactHandler) GetContacts(c *gin.Context) {
 		return
 	}
 
-	// Fetch user details for each contact
+	// Fetch user details for each contact, as far as they let us see them
+	viewer := profileViewer(c, h.db)
+	contactIDs := make([]primitive.ObjectID, len(contacts))
+	for i, contact := range contacts {
+		contactIDs[i] = contact.ContactID
+	}
+	viewer.Load(c.Request.Context(), contactIDs...)
+
 	var contactDetails []map[string]interface{}
 	for _, contact := range contacts {
-		var user models.User
-		err := h.db.MongoDB.Collection("users").FindOne(
-			context.Background(),
-			bson.M{"_id": contact.ContactID},
-		).Decode(&user)
-
+		profile, err := viewer.UserProfile(c.Request.Context(), contact.ContactID)
 		if err == nil {
 			contactDetails = append(contactDetails, map[string]interface{}{
 				"contact": contact,
-				"user":    user,
+				"user":    profile,
 			})
 		}
 	}
@@ -77,16 +82,24 @@ func (h *ContactHandler) ScanQRCode(c *gin.Context) {
 		return
 	}
 
-	// Parse QR code
-	contactUserIDStr, err := utils.ParseQRCode(req.QRData)
+	// Only codes the user was actually issued are accepted
+	ctx := c.Request.Context()
+	contactUserID, err := h.qrCodeOwner(ctx, req.QRData)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid QR code"})
 		return
 	}
-
-	contactUserID, err := primitive.ObjectIDFromHex(contactUserIDStr)
+	if contactUserID == userIDObj {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot add yourself"})
+		return
+	}
+	blocked, err := utils.IsBlocked(ctx, h.db, userIDObj, contactUserID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID in QR code"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add contact"})
+		return
+	}
+	if blocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This contact cannot be added"})
 		return
 	}
 
@@ -121,18 +134,51 @@ func (h *ContactHandler) ScanQRCode(c *gin.Context) {
 		return
 	}
 
-	// Also create reverse contact (bidirectional)
-	reverseContact := models.Contact{
-		ID:          primitive.NewObjectID(),
-		UserID:      contactUserID,
-		ContactID:   userIDObj,
-		ContactQR:   "", // Will be generated if needed
-		IsAnonymous: false,
-		CreatedAt:   time.Now(),
+	// Contacts are one-way: the scanned user decides for themselves whether
+	// to add the scanner, which is what their "contacts" privacy rules rely on
+	c.JSON(http.StatusCreated, contact)
+}
+
+// qrCodeOwner returns the user a contact QR code was issued to. Codes are
+// looked up in qr_code_cache; a code missing from it (the cache can be
+// cleared) is accepted if it renders to the QR image stored on the user.
+func (h *ContactHandler) qrCodeOwner(ctx context.Context, qrData string) (primitive.ObjectID, error) {
+	userIDStr, err := utils.ParseQRCode(qrData)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return primitive.NilObjectID, err
 	}
-	h.db.MongoDB.Collection("contacts").InsertOne(context.Background(), reverseContact)
 
-	c.JSON(http.StatusCreated, contact)
+	var cached qrCodeCacheDoc
+	err = h.db.MongoDB.Collection("qr_code_cache").FindOne(ctx, bson.M{"qr_data": qrData}).Decode(&cached)
+	if err == nil {
+		if cached.UserID != userIDStr {
+			return primitive.NilObjectID, errors.New("QR code does not match its user")
+		}
+		return userID, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return primitive.NilObjectID, err
+	}
+
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return primitive.NilObjectID, err
+	}
+	image, err := utils.GenerateQRImage(qrData)
+	if err != nil || user.QRCode == "" || image != user.QRCode {
+		return primitive.NilObjectID, errors.New("QR code was not issued to the user")
+	}
+	_, _ = h.db.MongoDB.Collection("qr_code_cache").UpdateOne(
+		ctx,
+		bson.M{"qr_data": qrData},
+		bson.M{"$set": qrCodeCacheDoc{QRData: qrData, UserID: userIDStr, CreatedAt: time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return userID, nil
 }
 
 func (h *ContactHandler) DeleteContact(c *gin.Context) {
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// deviceApprovalStep is the login step held until an existing session
+// approves the new device.
+const deviceApprovalStep = "device_approval"
+
+type DeviceApprovalPollRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+// deviceSettings returns the user's device settings. Users without a settings
+// document get the defaults (notifications on, no approval required).
+func (h *AuthHandler) deviceSettings(ctx context.Context, userID primitive.ObjectID) models.DeviceSettings {
+	var settings struct {
+		Devices models.DeviceSettings `bson:"devices"`
+	}
+	err := h.db.MongoDB.Collection("user_settings").FindOne(
+		ctx,
+		bson.M{"user_id": userID},
+		options.FindOne().SetProjection(bson.M{"devices": 1}),
+	).Decode(&settings)
+	if err != nil {
+		return models.DeviceSettings{DeviceNotifications: true}
+	}
+	return settings.Devices
+}
+
+// needsDeviceApproval reports whether a login from the device must be
+// approved by one of the user's existing sessions first. Logins are never
+// held when no session is left that could approve them.
+func (h *AuthHandler) needsDeviceApproval(ctx context.Context, user models.User, info utils.SessionInfo) (bool, error) {
+	if utils.KnownDevice(user, info.DeviceID, info.DeviceSecret) {
+		return false, nil
+	}
+	if !h.deviceSettings(ctx, user.ID).RequireAuthForNewDevice {
+		return false, nil
+	}
+	active, err := h.sessions.ListActive(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return len(active) > 0, nil
+}
+
+// notifyUser posts a service message to the user and pushes it, together
+// with the event fields, to the user's connected clients.
+func (h *AuthHandler) notifyUser(ctx context.Context, userID primitive.ObjectID, eventType, text string, event gin.H) {
+	message, err := utils.SendServiceMessage(ctx, h.db, userID, text)
+	if err != nil || h.hub == nil {
+		return
+	}
+	payload := gin.H{"type": eventType, "message": message}
+	for k, v := range event {
+		payload[k] = v
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	h.hub.SendToUser(userID, data)
+}
+
+func describeDevice(name, deviceType, ip string) string {
+	if name == "" {
+		name = "an unknown device"
+	}
+	if deviceType != "" {
+		name = fmt.Sprintf("%s (%s)", name, deviceType)
+	}
+	return fmt.Sprintf("%s, IP %s", name, ip)
+}
+
+// sendLoginAlert tells the user about a completed login from a new device.
+func (h *AuthHandler) sendLoginAlert(ctx context.Context, userID primitive.ObjectID, info utils.SessionInfo) {
+	if !h.deviceSettings(ctx, userID).DeviceNotifications {
+		return
+	}
+	text := fmt.Sprintf(
+		"New login from %s at %s. If this wasn't you, terminate the session in Settings > Devices and change your password.",
+		describeDevice(info.DeviceName, info.DeviceType, info.IPAddress),
+		time.Now().UTC().Format("2006-01-02 15:04 UTC"),
+	)
+	h.notifyUser(ctx, userID, "login_alert", text, gin.H{"device_id": info.DeviceID})
+}
+
+// requestDeviceApproval asks the user's existing sessions to approve a login
+// whose only remaining step is device approval. This alert is always sent,
+// regardless of the device notification setting.
+func (h *AuthHandler) requestDeviceApproval(ctx context.Context, challenge models.AuthChallenge) {
+	text := fmt.Sprintf(
+		"Login attempt from %s. Approve or deny it in Settings > Devices. If this wasn't you, deny it and change your password.",
+		describeDevice(challenge.DeviceName, challenge.DeviceType, challenge.IPAddress),
+	)
+	h.notifyUser(ctx, challenge.UserID, "device_approval_request", text, gin.H{"request": challenge})
+}
+
+// GetPendingDeviceLogins lists new-device logins waiting for approval.
+func (h *AuthHandler) GetPendingDeviceLogins(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	cursor, err := h.db.MongoDB.Collection("auth_challenges").Find(
+		c.Request.Context(),
+		bson.M{
+			"user_id":    userIDObj,
+			"pending":    []string{deviceApprovalStep},
+			"expires_at": bson.M{"$gt": time.Now()},
+		},
+		options.Find().SetSort(bson.M{"created_at": -1}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login requests"})
+		return
+	}
+	defer cursor.Close(c.Request.Context())
+
+	requests := []models.AuthChallenge{}
+	if err := cursor.All(c.Request.Context(), &requests); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// ApproveDeviceLogin lets the new device finish its login. Only logins that
+// passed every other step can be approved.
+func (h *AuthHandler) ApproveDeviceLogin(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+	sessionID, _ := c.Get("session_id")
+	sessionIDObj := sessionID.(primitive.ObjectID)
+
+	requestID, err := primitive.ObjectIDFromHex(c.Param("request_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	result, err := h.db.MongoDB.Collection("auth_challenges").UpdateOne(
+		c.Request.Context(),
+		bson.M{
+			"_id":        requestID,
+			"user_id":    userIDObj,
+			"pending":    []string{deviceApprovalStep},
+			"expires_at": bson.M{"$gt": time.Now()},
+		},
+		bson.M{"$set": bson.M{
+			"pending":     []string{},
+			"approved_by": sessionIDObj,
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve login"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login request not found or expired"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Login approved"})
+}
+
+// DenyDeviceLogin rejects a held login; the new device has to start over.
+func (h *AuthHandler) DenyDeviceLogin(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	requestID, err := primitive.ObjectIDFromHex(c.Param("request_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	result, err := h.db.MongoDB.Collection("auth_challenges").DeleteOne(c.Request.Context(), bson.M{
+		"_id":     requestID,
+		"user_id": userIDObj,
+		"pending": deviceApprovalStep,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deny login"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login request not found or expired"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Login denied"})
+}
+
+// PollDeviceApproval is called by the new device while its login waits for
+// approval. Once approved, the challenge is consumed and tokens are issued.
+func (h *AuthHandler) PollDeviceApproval(c *gin.Context) {
+	var req DeviceApprovalPollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	challenges := h.db.MongoDB.Collection("auth_challenges")
+
+	var challenge models.AuthChallenge
+	err := challenges.FindOne(ctx, bson.M{
+		"token_hash": utils.HashToken(req.ChallengeToken),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&challenge)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login request denied or expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Challenge lookup failed"})
+		return
+	}
+
+	// Tokens go to the device that was approved, not whoever holds the challenge
+	if challenge.DeviceID != "" && challenge.DeviceID != sessionInfo(c).DeviceID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login request belongs to another device"})
+		return
+	}
+
+	if len(challenge.Pending) > 0 {
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":                   "pending",
+			"pending":                  challenge.Pending,
+			"device_approval_required": true,
+		})
+		return
+	}
+
+	result, err := challenges.DeleteOne(ctx, bson.M{"_id": challenge.ID, "pending": bson.M{"$size": 0}})
+	if err != nil || result.DeletedCount == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login request denied or expired"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": challenge.UserID}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login request denied or expired"})
+		return
+	}
+
+	h.respondWithTokens(c, http.StatusOK, user, nil)
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const emailCodeTTL = 15 * time.Minute
+
+type EmailRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Kind     string `json:"kind"` // recovery (default) or email
+	Password string `json:"password,omitempty"`
+}
+
+type VerifyEmailRequest struct {
+	Kind string `json:"kind"` // recovery (default) or email
+	Code string `json:"code" binding:"required"`
+}
+
+type RemoveEmailRequest struct {
+	Kind     string `json:"kind"` // recovery (default) or email
+	Password string `json:"password,omitempty"`
+}
+
+type RecoverySendCodeRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+}
+
+type RecoveryLoginRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+	EmailCode   string `json:"email_code" binding:"required"`
+	Password    string `json:"password" binding:"required"`
+}
+
+// emailKind maps the request kind to the user field and code purpose.
+func emailKind(kind string) (field, purpose string, ok bool) {
+	switch kind {
+	case "", "recovery":
+		return "recovery_email", "verify_recovery_email", true
+	case "email":
+		return "email", "verify_email", true
+	}
+	return "", "", false
+}
+
+func normalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Name != "" {
+		return "", fmt.Errorf("invalid email address")
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+// respondEmailDisabled rejects email flows when no mail server is configured.
+func respondEmailDisabled(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Email is not available on this server"})
+}
+
+// issueEmailCode replaces any outstanding code for the purpose and mails a new one.
+func (h *AuthHandler) issueEmailCode(ctx context.Context, userID primitive.ObjectID, email, purpose string) error {
+	code, err := newNumericCode()
+	if err != nil {
+		return err
+	}
+
+	codes := h.db.MongoDB.Collection("email_codes")
+	_, _ = codes.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose})
+
+	now := time.Now()
+	_, err = codes.InsertOne(ctx, models.EmailCode{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Email:     email,
+		Purpose:   purpose,
+		CodeHash:  utils.HashToken(code),
+		ExpiresAt: now.Add(emailCodeTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	subject := "Confirm your email address"
+	intro := "Your ChatApp email confirmation code is"
+	if purpose == "account_recovery" {
+		subject = "Account recovery code"
+		intro = "Your ChatApp account recovery code is"
+	}
+	body := fmt.Sprintf("%s: %s\n\nThe code expires in 15 minutes. If you did not request it, you can ignore this email.", intro, code)
+	return h.mailer.SendMail(email, subject, body)
+}
+
+// consumeEmailCode checks an email code for the purpose. Every guess takes an
+// attempt before it is compared, and the code is burned after maxCodeAttempts.
+func (h *AuthHandler) consumeEmailCode(ctx context.Context, userID primitive.ObjectID, purpose, code string) (*models.EmailCode, bool) {
+	codes := h.db.MongoDB.Collection("email_codes")
+
+	var doc models.EmailCode
+	err := codes.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"user_id":    userID,
+			"purpose":    purpose,
+			"expires_at": bson.M{"$gt": time.Now()},
+			"attempts":   bson.M{"$lt": maxCodeAttempts},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetSort(bson.M{"created_at": -1}).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		return nil, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(doc.CodeHash), []byte(utils.HashToken(strings.TrimSpace(code)))) != 1 {
+		if doc.Attempts >= maxCodeAttempts {
+			_, _ = codes.DeleteOne(ctx, bson.M{"_id": doc.ID})
+		}
+		return nil, false
+	}
+
+	// Only the request that deletes the code may use it
+	deleted, err := codes.DeleteOne(ctx, bson.M{"_id": doc.ID})
+	if err != nil || deleted.DeletedCount == 0 {
+		return nil, false
+	}
+	_, _ = codes.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose})
+	return &doc, true
+}
+
+// setUserEmail stores a verified address on the user, which is authoritative,
+// and mirrors it into the account settings.
+func (h *AuthHandler) setUserEmail(ctx context.Context, userID primitive.ObjectID, field, email string) error {
+	update := bson.M{"$set": bson.M{field: email, "updated_at": time.Now()}}
+	if email == "" {
+		update = bson.M{"$unset": bson.M{field: ""}, "$set": bson.M{"updated_at": time.Now()}}
+	}
+	if _, err := h.db.MongoDB.Collection("users").UpdateOne(ctx, bson.M{"_id": userID}, update); err != nil {
+		return err
+	}
+
+	_, _ = h.db.MongoDB.Collection("user_settings").UpdateOne(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{
+			"account." + field: email,
+			"updated_at":       time.Now(),
+		}},
+	)
+	return nil
+}
+
+// RequestEmailVerification sends a confirmation code to a new account or
+// recovery email. The address is only saved once the code is confirmed.
+func (h *AuthHandler) RequestEmailVerification(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	if !h.mailer.Enabled() {
+		respondEmailDisabled(c)
+		return
+	}
+
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, purpose, ok := emailKind(req.Kind)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be recovery or email"})
+		return
+	}
+
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// A stolen session must not be enough to redirect account recovery
+	if user.PasswordHash != "" && !checkPassword(user.PasswordHash, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	if err := h.guard.AllowSend(ctx, user.PhoneNumber, c.ClientIP()); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	if err := h.issueEmailCode(ctx, userIDObj, email, purpose); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send confirmation email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Confirmation code sent", "email": email})
+}
+
+// VerifyEmail confirms the address with the emailed code and saves it.
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	field, purpose, ok := emailKind(req.Kind)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be recovery or email"})
+		return
+	}
+
+	ctx := context.Background()
+	doc, ok := h.consumeEmailCode(ctx, userIDObj, purpose, req.Code)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	if err := h.setUserEmail(ctx, userIDObj, field, doc.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified", field: doc.Email})
+}
+
+// RemoveEmail removes the account or recovery email.
+func (h *AuthHandler) RemoveEmail(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req RemoveEmailRequest
+	_ = c.ShouldBindJSON(&req)
+
+	field, _, ok := emailKind(req.Kind)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be recovery or email"})
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.PasswordHash != "" && !checkPassword(user.PasswordHash, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	if err := h.setUserEmail(ctx, userIDObj, field, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email removed"})
+}
+
+// SendRecoveryCode emails an account recovery code to the verified recovery
+// email of a two-step account. The response does not reveal whether the
+// account exists or has a recovery email.
+func (h *AuthHandler) SendRecoveryCode(c *gin.Context) {
+	if !h.mailer.Enabled() {
+		respondEmailDisabled(c)
+		return
+	}
+
+	var req RecoverySendCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !normalizeRequestPhone(c, &req.PhoneNumber) {
+		return
+	}
+
+	ctx := context.Background()
+	if err := h.guard.AllowSend(ctx, req.PhoneNumber, c.ClientIP()); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	var user models.User
+	err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"phone_number": req.PhoneNumber}).Decode(&user)
+	if err == nil && user.TwoStepEnabled && user.RecoveryEmail != "" {
+		if err := h.issueEmailCode(ctx, user.ID, user.RecoveryEmail, "account_recovery"); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send recovery email"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account has a recovery email, a code was sent to it"})
+}
+
+// RecoveryLogin lets a two-step user who lost their phone log in with the
+// recovery email code in place of the SMS code, plus the cloud password.
+func (h *AuthHandler) RecoveryLogin(c *gin.Context) {
+	var req RecoveryLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !normalizeRequestPhone(c, &req.PhoneNumber) {
+		return
+	}
+
+	ctx := context.Background()
+	ip := c.ClientIP()
+	if err := h.guard.CheckVerify(ctx, req.PhoneNumber, ip); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	var user models.User
+	err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"phone_number": req.PhoneNumber}).Decode(&user)
+	if err != nil || !user.TwoStepEnabled || user.RecoveryEmail == "" {
+		h.guard.RecordFailure(ctx, req.PhoneNumber, ip, "no_code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	if _, ok := h.consumeEmailCode(ctx, user.ID, "account_recovery", req.EmailCode); !ok {
+		h.guard.RecordFailure(ctx, req.PhoneNumber, ip, "wrong_code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	if user.PasswordHash == "" || !checkPassword(user.PasswordHash, req.Password) {
+		h.guard.RecordFailure(ctx, req.PhoneNumber, ip, "wrong_password")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	h.guard.RecordSuccess(ctx, req.PhoneNumber)
+
+	// The password step is done; TOTP may still be required
+	h.finishLogin(c, user, "password")
+}
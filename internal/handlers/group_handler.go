@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"context"
+	"io"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"chat-backend/internal/database"
 	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+	"chat-backend/internal/websocket"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,11 +19,12 @@ import (
 )
 
 type GroupHandler struct {
-	db *database.Database
+	db  *database.Database
+	hub *websocket.Hub
 }
 
-func NewGroupHandler(db *database.Database) *GroupHandler {
-	return &GroupHandler{db: db}
+func NewGroupHandler(db *database.Database, hub *websocket.Hub) *GroupHandler {
+	return &GroupHandler{db: db, hub: hub}
 }
 
 type CreateGroupRequest struct {
@@ -27,6 +33,45 @@ type CreateGroupRequest struct {
 	MemberIDs []string `json:"member_ids"`
 }
 
+// CreateGroupResponse is the new group, with the users who were sent an
+// invite link instead of being added.
+type CreateGroupResponse struct {
+	models.Chat
+	Invited []primitive.ObjectID `json:"invited,omitempty"`
+}
+
+// How a user can be brought into a group, see admission.
+const (
+	admitMember = iota
+	admitInvite
+	admitNone
+)
+
+// admission tells whether the viewer can add the user to a group directly,
+// following the user's group_invites privacy rule, or only send them an
+// invite link. Users separated from the viewer by a block get neither.
+func admission(ctx context.Context, viewer *utils.ProfileViewer, userID primitive.ObjectID) int {
+	switch {
+	case viewer.Blocked(ctx, userID):
+		return admitNone
+	case viewer.Allows(ctx, userID, utils.PrivacyGroupInvites):
+		return admitMember
+	default:
+		return admitInvite
+	}
+}
+
+// sendInvite sends the user an invite link to the group in a direct message
+// from the inviter.
+func (h *GroupHandler) sendInvite(ctx context.Context, group *models.Chat, inviterID, userID primitive.ObjectID) error {
+	message, err := utils.SendChatInvite(ctx, h.db, group, inviterID, userID)
+	if err != nil {
+		return err
+	}
+	h.hub.BroadcastToRoom(message.ChatID, *message)
+	return nil
+}
+
 func (h *GroupHandler) CreateGroup(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userIDObj := userID.(primitive.ObjectID)
@@ -37,13 +82,30 @@ func (h *GroupHandler) CreateGroup(c *gin.Context) {
 		return
 	}
 
-	members := []primitive.ObjectID{userIDObj}
+	var memberIDs []primitive.ObjectID
 	for _, memberIDStr := range req.MemberIDs {
 		memberID, err := primitive.ObjectIDFromHex(memberIDStr)
 		if err != nil {
 			continue
 		}
-		members = append(members, memberID)
+		memberIDs = append(memberIDs, memberID)
+	}
+	memberIDs = uniqueObjectIDs(memberIDs, userIDObj)
+
+	// Users whose privacy settings keep the creator from adding them are
+	// invited once the group exists
+	ctx := c.Request.Context()
+	viewer := utils.NewProfileViewer(h.db, userIDObj)
+	viewer.Load(ctx, memberIDs...)
+	members := []primitive.ObjectID{userIDObj}
+	var invited []primitive.ObjectID
+	for _, memberID := range memberIDs {
+		switch admission(ctx, viewer, memberID) {
+		case admitMember:
+			members = append(members, memberID)
+		case admitInvite:
+			invited = append(invited, memberID)
+		}
 	}
 
 	chat := models.Chat{
@@ -54,13 +116,14 @@ func (h *GroupHandler) CreateGroup(c *gin.Context) {
 			{
 				UserID:      userIDObj,
 				Role:        "owner",
-				Permissions: []string{"all"},
+				Permissions: []models.AdminPermission{models.PermAll},
 				GrantedAt:   time.Now(),
 				GrantedBy:   userIDObj,
 			},
 		},
 		GroupName: req.GroupName,
 		GroupIcon: req.GroupIcon,
+		Restrictions: utils.DefaultGroupRestrictions(),
 		MaxMembers: 200000, // Telegram limit
 		Statistics: models.ChatStatistics{
 			LastCalculated: time.Now(),
@@ -75,7 +138,16 @@ func (h *GroupHandler) CreateGroup(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, chat)
+	response := CreateGroupResponse{Chat: chat}
+	for _, invitedID := range invited {
+		if err := h.sendInvite(ctx, &chat, userIDObj, invitedID); err != nil {
+			log.Printf("Failed to invite %s to group %s: %v", invitedID.Hex(), chat.ID.Hex(), err)
+			continue
+		}
+		response.Invited = append(response.Invited, invitedID)
+	}
+
+	c.JSON(http.StatusCreated, response)
 }
 
 func (h *GroupHandler) GetGroups(c *gin.Context) {
@@ -123,10 +195,51 @@ func (h *GroupHandler) GetGroup(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
 		return
 	}
+	group.Restrictions = utils.EffectiveGroupRestrictions(&group)
 
 	c.JSON(http.StatusOK, group)
 }
 
+// editableChatFields are the info and settings UpdateGroup may change, with
+// the JSON type each takes. Everything else has a dedicated endpoint or is
+// maintained by the server.
+var editableChatFields = map[string]string{
+	"group_name":  "string",
+	"group_icon":  "string",
+	"description": "string",
+	"wallpaper":   "string",
+	"is_secret":   "bool",
+	"slow_mode":   "seconds",
+}
+
+// validChatField reports whether the field may be set to value here.
+func validChatField(field string, value interface{}) bool {
+	if strings.HasPrefix(field, "$") || strings.Contains(field, ".") {
+		return false
+	}
+	switch editableChatFields[field] {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	case "seconds":
+		seconds, ok := value.(float64)
+		return ok && seconds >= 0 && seconds == float64(int(seconds))
+	default:
+		return false
+	}
+}
+
+// memberInfoFields may be changed by members when the group's restrictions
+// allow it; everything else needs the change_info admin permission.
+var memberInfoFields = map[string]bool{
+	"group_name":  true,
+	"group_icon":  true,
+	"description": true,
+}
+
 func (h *GroupHandler) UpdateGroup(c *gin.Context) {
 	groupIDStr := c.Param("group_id")
 	groupID, err := primitive.ObjectIDFromHex(groupIDStr)
@@ -141,8 +254,35 @@ func (h *GroupHandler) UpdateGroup(c *gin.Context) {
 		return
 	}
 
+	memberEditable := true
+	for field := range updateData {
+		if !validChatField(field, updateData[field]) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Field cannot be updated here: " + field})
+			return
+		}
+		memberEditable = memberEditable && memberInfoFields[field]
+	}
+
+	group, ok := memberChat(c, h.db, groupID)
+	if !ok {
+		return
+	}
+	if group.Type != "group" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	userID, _ := c.Get("user_id")
+	rights, _, err := utils.MemberRights(c.Request.Context(), h.db, group, userID.(primitive.ObjectID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check restrictions"})
+		return
+	}
+	if !(memberEditable && rights.CanChangeInfo) && !requireAdminPermission(c, group, models.PermChangeInfo) {
+		return
+	}
+
 	updateData["updated_at"] = time.Now()
-	_, err = h.db.MongoDB.Collection("chats").UpdateOne(
+	result, err := h.db.MongoDB.Collection("chats").UpdateOne(
 		context.Background(),
 		bson.M{"_id": groupID, "type": "group"},
 		bson.M{"$set": updateData},
@@ -152,10 +292,52 @@ func (h *GroupHandler) UpdateGroup(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
 		return
 	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	logChatUpdate(c, h.db, group, updateData)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Group updated successfully"})
 }
 
+// logChatUpdate records changes to a group's or channel's info in its event
+// log: one event each for the title, photo and description, and one for any
+// other settings.
+func logChatUpdate(c *gin.Context, db *database.Database, chat *models.Chat, updateData map[string]interface{}) {
+	userID, _ := c.Get("user_id")
+	ctx := c.Request.Context()
+	event := models.ChatEvent{ChatID: chat.ID, ActorID: userID.(primitive.ObjectID)}
+
+	settings := map[string]interface{}{}
+	for field, value := range updateData {
+		event.OldValue, event.NewValue = nil, value
+		switch field {
+		case "updated_at":
+			continue
+		case "group_name":
+			event.Action, event.OldValue = models.EventTitleChanged, chat.GroupName
+		case "group_icon":
+			event.Action, event.OldValue = models.EventPhotoChanged, chat.GroupIcon
+		case "description":
+			event.Action, event.OldValue = models.EventDescriptionChanged, chat.Description
+		default:
+			settings[field] = value
+			continue
+		}
+		utils.LogChatEvent(ctx, db, event)
+	}
+	if len(settings) > 0 {
+		event.Action, event.OldValue, event.NewValue = models.EventSettingsChanged, nil, settings
+		utils.LogChatEvent(ctx, db, event)
+	}
+}
+
+// UpdateUsername sets, changes or removes the group's public username.
+func (h *GroupHandler) UpdateUsername(c *gin.Context) {
+	changeChatUsername(c, h.db, "group", "group_id")
+}
+
 func (h *GroupHandler) DeleteGroup(c *gin.Context) {
 	groupIDStr := c.Param("group_id")
 	groupID, err := primitive.ObjectIDFromHex(groupIDStr)
@@ -164,7 +346,21 @@ func (h *GroupHandler) DeleteGroup(c *gin.Context) {
 		return
 	}
 
-	_, err = h.db.MongoDB.Collection("chats").DeleteOne(
+	group, ok := memberChat(c, h.db, groupID)
+	if !ok {
+		return
+	}
+	if group.Type != "group" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	userID, _ := c.Get("user_id")
+	if !utils.IsChatOwner(group, userID.(primitive.ObjectID)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can delete the group"})
+		return
+	}
+
+	result, err := h.db.MongoDB.Collection("chats").DeleteOne(
 		context.Background(),
 		bson.M{"_id": groupID, "type": "group"},
 	)
@@ -173,6 +369,11 @@ func (h *GroupHandler) DeleteGroup(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
 		return
 	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	_ = utils.ReleaseUsername(context.Background(), h.db, "group", groupID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully"})
 }
@@ -199,9 +400,60 @@ func (h *GroupHandler) AddMember(c *gin.Context) {
 		return
 	}
 
+	group, ok := memberChat(c, h.db, groupID)
+	if !ok {
+		return
+	}
+	// Direct chats and channels have no group restrictions that could let
+	// members add others
+	if group.Type != "group" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	userID, _ := c.Get("user_id")
+	rights, _, err := utils.MemberRights(c.Request.Context(), h.db, group, userID.(primitive.ObjectID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check restrictions"})
+		return
+	}
+	if !rights.CanInviteUsers && !requireAdminPermission(c, group, models.PermInviteUsers) {
+		return
+	}
+
+	ban, err := utils.ActiveBan(c.Request.Context(), h.db, groupID, memberID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check bans"})
+		return
+	}
+	if ban != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is banned from this group; unban them first", "until_date": ban.UntilDate})
+		return
+	}
+	if utils.IsChatMember(group, memberID) {
+		c.JSON(http.StatusOK, gin.H{"message": "Member added successfully"})
+		return
+	}
+
+	viewer := utils.NewProfileViewer(h.db, userID.(primitive.ObjectID))
+	switch admission(c.Request.Context(), viewer, memberID) {
+	case admitNone:
+		c.JSON(http.StatusForbidden, gin.H{"error": "This user cannot be added to the group"})
+		return
+	case admitInvite:
+		if err := h.sendInvite(c.Request.Context(), group, userID.(primitive.ObjectID), memberID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send invite"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":  "invited",
+			"message": "The user's privacy settings do not allow adding them, so they were sent an invite link",
+		})
+		return
+	}
+
 	_, err = h.db.MongoDB.Collection("chats").UpdateOne(
 		context.Background(),
-		bson.M{"_id": groupID},
+		bson.M{"_id": groupID, "type": "group"},
 		bson.M{"$addToSet": bson.M{"members": memberID}},
 	)
 
@@ -209,6 +461,7 @@ func (h *GroupHandler) AddMember(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
 		return
 	}
+	utils.LogMemberEvent(c.Request.Context(), h.db, groupID, userID.(primitive.ObjectID), models.EventMemberAdded, memberID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Member added successfully"})
 }
@@ -228,20 +481,265 @@ func (h *GroupHandler) RemoveMember(c *gin.Context) {
 		return
 	}
 
-	_, err = h.db.MongoDB.Collection("chats").UpdateOne(
+	// Members may leave; removing others takes ban_users, and removing an
+	// admin also the right to demote them
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+	group, ok := memberChat(c, h.db, groupID)
+	if !ok {
+		return
+	}
+	if group.Type != "group" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	if !utils.IsChatMember(group, memberID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is not a member of this group"})
+		return
+	}
+	target := utils.ChatAdmin(group, memberID)
+	if target != nil && target.Role == "owner" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The owner cannot be removed; transfer ownership first"})
+		return
+	}
+	if memberID != userIDObj {
+		if !requireAdminPermission(c, group, models.PermBanUsers) {
+			return
+		}
+		if target != nil && !utils.IsChatOwner(group, userIDObj) && target.GrantedBy != userIDObj {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only remove admins you promoted"})
+			return
+		}
+	}
+
+	result, err := h.db.MongoDB.Collection("chats").UpdateOne(
 		context.Background(),
-		bson.M{"_id": groupID},
-		bson.M{"$pull": bson.M{"members": memberID}},
+		bson.M{"_id": groupID, "type": "group", "members": memberID},
+		bson.M{"$pull": bson.M{
+			"members": memberID,
+			"admins":  bson.M{"user_id": memberID, "role": bson.M{"$ne": "owner"}},
+		}},
 	)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
 		return
 	}
+	// Someone else removed them first; there is nothing to log
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is not a member of this group"})
+		return
+	}
+	h.hub.LeaveRoom(memberID, groupID)
+
+	action := models.EventMemberKicked
+	if memberID == userIDObj {
+		action = models.EventMemberLeft
+	}
+	utils.LogMemberEvent(c.Request.Context(), h.db, groupID, userIDObj, action, memberID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
 }
 
+type RestrictMemberRequest struct {
+	models.GroupRestrictions
+	UntilDate *time.Time `json:"until_date,omitempty"` // unset restricts until lifted
+}
+
+type MuteMemberRequest struct {
+	UntilDate *time.Time `json:"until_date,omitempty"` // unset mutes until lifted
+}
+
+// UpdateRestrictions sets what members of the group may do by default,
+// which takes the ban_users admin permission.
+func (h *GroupHandler) UpdateRestrictions(c *gin.Context) {
+	groupID, err := primitive.ObjectIDFromHex(c.Param("group_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+	group, ok := memberChat(c, h.db, groupID)
+	if !ok {
+		return
+	}
+	if group.Type != "group" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	if !requireAdminPermission(c, group, models.PermBanUsers) {
+		return
+	}
+
+	var restrictions models.GroupRestrictions
+	if err := c.ShouldBindJSON(&restrictions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	restrictions.UpdatedAt = &now
+
+	result, err := h.db.MongoDB.Collection("chats").UpdateOne(
+		c.Request.Context(),
+		bson.M{"_id": groupID, "type": "group"},
+		bson.M{"$set": bson.M{"restrictions": restrictions, "updated_at": now}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update restrictions"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	userID, _ := c.Get("user_id")
+	old := utils.EffectiveGroupRestrictions(group)
+	utils.LogChatEvent(c.Request.Context(), h.db, models.ChatEvent{
+		ChatID:   groupID,
+		ActorID:  userID.(primitive.ObjectID),
+		Action:   models.EventRestrictionsChanged,
+		OldValue: old,
+		NewValue: restrictions,
+	})
+
+	c.JSON(http.StatusOK, restrictions)
+}
+
+// RestrictMember narrows what one member may do, on top of the group's
+// restrictions. Admins cannot be restricted; demote them first.
+func (h *GroupHandler) RestrictMember(c *gin.Context) {
+	var req RestrictMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rights := req.GroupRestrictions
+	rights.UpdatedAt = nil
+	h.restrictMember(c, models.RestrictionRestrict, rights, req.UntilDate)
+}
+
+// MuteMember makes a member read-only.
+func (h *GroupHandler) MuteMember(c *gin.Context) {
+	var req MuteMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.restrictMember(c, models.RestrictionMute, models.GroupRestrictions{}, req.UntilDate)
+}
+
+func (h *GroupHandler) restrictMember(c *gin.Context, kind string, rights models.GroupRestrictions, untilDate *time.Time) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	groupID, err := primitive.ObjectIDFromHex(c.Param("group_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+	memberID, err := primitive.ObjectIDFromHex(c.Param("member_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid member ID"})
+		return
+	}
+	group, ok := memberChat(c, h.db, groupID)
+	if !ok {
+		return
+	}
+	// Channels and direct chats have no member restrictions
+	if group.Type != "group" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	if !requireAdminPermission(c, group, models.PermBanUsers) {
+		return
+	}
+
+	if untilDate != nil && !untilDate.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "until_date must be in the future"})
+		return
+	}
+	if memberID == userIDObj {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot restrict yourself"})
+		return
+	}
+	if !utils.IsChatMember(group, memberID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is not a member of this group"})
+		return
+	}
+	if utils.ChatAdmin(group, memberID) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins cannot be restricted; demote them first"})
+		return
+	}
+
+	restriction := models.MemberRestriction{
+		ChatID:       groupID,
+		UserID:       memberID,
+		Kind:         kind,
+		Rights:       rights,
+		UntilDate:    untilDate,
+		RestrictedBy: userIDObj,
+		CreatedAt:    time.Now(),
+	}
+	if err := utils.SaveMemberRestriction(c.Request.Context(), h.db, &restriction); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restrict member"})
+		return
+	}
+	action := models.EventMemberRestricted
+	if kind == models.RestrictionMute {
+		action = models.EventMemberMuted
+	}
+	utils.LogChatEvent(c.Request.Context(), h.db, models.ChatEvent{
+		ChatID:       groupID,
+		ActorID:      userIDObj,
+		Action:       action,
+		TargetUserID: &memberID,
+		NewValue:     restriction,
+	})
+
+	c.JSON(http.StatusOK, restriction)
+}
+
+// UnrestrictMember lifts a member's mute or restrictions. Bans are lifted
+// through the bans endpoint.
+func (h *GroupHandler) UnrestrictMember(c *gin.Context) {
+	groupID, err := primitive.ObjectIDFromHex(c.Param("group_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+	memberID, err := primitive.ObjectIDFromHex(c.Param("member_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid member ID"})
+		return
+	}
+	group, ok := memberChat(c, h.db, groupID)
+	if !ok {
+		return
+	}
+	if group.Type != "group" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	if !requireAdminPermission(c, group, models.PermBanUsers) {
+		return
+	}
+
+	result, err := h.db.MongoDB.Collection("chat_restrictions").DeleteOne(
+		c.Request.Context(),
+		bson.M{"chat_id": groupID, "user_id": memberID, "kind": bson.M{"$ne": models.RestrictionBan}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lift restrictions"})
+		return
+	}
+	if result.DeletedCount > 0 {
+		userID, _ := c.Get("user_id")
+		utils.LogMemberEvent(c.Request.Context(), h.db, groupID, userID.(primitive.ObjectID), models.EventMemberUnrestricted, memberID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Restrictions lifted"})
+}
+
 func (h *GroupHandler) GetStatistics(c *gin.Context) {
 	groupIDStr := c.Param("group_id")
 	groupID, err := primitive.ObjectIDFromHex(groupIDStr)
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InviteHandler lets users preview and join groups and channels through
+// invite links. Links are managed through ChatAdminHandler.
+type InviteHandler struct {
+	db *database.Database
+}
+
+func NewInviteHandler(db *database.Database) *InviteHandler {
+	return &InviteHandler{db: db}
+}
+
+// inviteChat loads the usable invite link named by the :code parameter and
+// its chat, writing the error response if either is gone.
+func (h *InviteHandler) inviteChat(c *gin.Context) (*models.InviteLink, *models.Chat, bool) {
+	ctx := c.Request.Context()
+	link, err := utils.ActiveInviteLink(ctx, h.db, c.Param("code"))
+	if err == utils.ErrInviteLinkInvalid {
+		c.JSON(http.StatusGone, gin.H{"error": "Invite link is invalid or expired"})
+		return nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invite link"})
+		return nil, nil, false
+	}
+
+	var chat models.Chat
+	err = h.db.MongoDB.Collection("chats").FindOne(ctx, bson.M{
+		"_id":  link.ChatID,
+		"type": bson.M{"$in": []string{"group", "channel"}},
+	}).Decode(&chat)
+	if err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Invite link is invalid or expired"})
+		return nil, nil, false
+	}
+	return link, &chat, true
+}
+
+// Preview describes the chat behind an invite link before joining.
+func (h *InviteHandler) Preview(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	link, chat, ok := h.inviteChat(c)
+	if !ok {
+		return
+	}
+	response := gin.H{
+		"type":              chat.Type,
+		"id":                chat.ID,
+		"title":             chat.GroupName,
+		"description":       chat.Description,
+		"icon":              chat.GroupIcon,
+		"requires_approval": link.RequiresApproval,
+		"is_member":         utils.IsChatMember(chat, userID.(primitive.ObjectID)),
+	}
+	if chat.Type == "channel" {
+		response["subscriber_count"] = chat.SubscriberCount
+	} else {
+		response["member_count"] = len(chat.Members)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Join adds the caller to the chat behind an invite link, or queues a join
+// request when the link needs approval.
+func (h *InviteHandler) Join(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	link, chat, ok := h.inviteChat(c)
+	if !ok {
+		return
+	}
+	if utils.IsChatMember(chat, userIDObj) {
+		c.JSON(http.StatusOK, gin.H{"status": "member", "chat_id": chat.ID})
+		return
+	}
+
+	ctx := c.Request.Context()
+	ban, err := utils.ActiveBan(ctx, h.db, chat.ID, userIDObj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check bans"})
+		return
+	}
+	if ban != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are banned from this chat", "until_date": ban.UntilDate})
+		return
+	}
+
+	if link.RequiresApproval {
+		var request models.JoinRequest
+		err := h.db.MongoDB.Collection("join_requests").FindOneAndUpdate(
+			ctx,
+			bson.M{"chat_id": chat.ID, "user_id": userIDObj, "status": "pending"},
+			bson.M{"$setOnInsert": bson.M{
+				"invite_link_id": link.ID,
+				"created_at":     time.Now(),
+			}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&request)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request to join"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": "pending", "request": request})
+		return
+	}
+
+	if err := utils.UseInviteLink(ctx, h.db, link); err != nil {
+		if err == utils.ErrInviteLinkInvalid {
+			c.JSON(http.StatusGone, gin.H{"error": "Invite link is invalid or expired"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join"})
+		return
+	}
+	added, err := utils.AddChatMember(ctx, h.db, chat, userIDObj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join"})
+		return
+	}
+	if added {
+		utils.LogChatEvent(ctx, h.db, models.ChatEvent{
+			ChatID:       chat.ID,
+			ActorID:      userIDObj,
+			Action:       models.EventMemberJoined,
+			TargetUserID: &userIDObj,
+			NewValue:     gin.H{"invite_link_id": link.ID},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "joined", "chat_id": chat.ID})
+}
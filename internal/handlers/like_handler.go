@@ -244,22 +244,21 @@ func (h *LikeHandler) GetProductLikes(c *gin.Context) {
 
 	// Get user info for each like
 	type LikeWithUser struct {
-		Like models.Like `json:"like"`
-		User gin.H       `json:"user"`
+		Like models.Like          `json:"like"`
+		User models.PublicProfile `json:"user"`
 	}
 
+	viewer := profileViewer(c, h.db)
 	result := make([]LikeWithUser, 0, len(likes))
 	for _, like := range likes {
-		var user models.User
-		h.db.MongoDB.Collection("users").FindOne(context.Background(), bson.M{"_id": like.UserID}).Decode(&user)
+		profile, err := viewer.UserProfile(c.Request.Context(), like.UserID)
+		if err != nil {
+			continue
+		}
 
 		result = append(result, LikeWithUser{
 			Like: like,
-			User: gin.H{
-				"id":       user.ID,
-				"username": user.Username,
-				"avatar":   user.Avatar,
-			},
+			User: profile,
 		})
 	}
 
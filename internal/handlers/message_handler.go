@@ -3,10 +3,12 @@ package handlers
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
 	"chat-backend/internal/database"
 	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
 	"chat-backend/internal/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -75,14 +77,22 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	// Check slow mode
-	var chat models.Chat
-	err = h.db.MongoDB.Collection("chats").FindOne(
-		context.Background(),
-		bson.M{"_id": chatID},
-	).Decode(&chat)
+	member, ok := memberChat(c, h.db, chatID)
+	if !ok {
+		return
+	}
+	chat := *member
+	if !checkNotBlocked(c, h.db, &chat, userIDObj) {
+		return
+	}
+
+	// Only admins post in channels
+	if chat.Type == "channel" && !requireAdminPermission(c, &chat, models.PermPostMessages) {
+		return
+	}
 
-	if err == nil && chat.SlowMode > 0 {
+	// Check slow mode
+	if chat.SlowMode > 0 {
 		lastMessageKey := userIDObj.Hex()
 		if lastTime, exists := chat.LastSlowModeMessage[lastMessageKey]; exists {
 			timeSinceLastMessage := time.Since(lastTime)
@@ -135,7 +145,6 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 		Contact:     req.Contact,
 		Poll:        req.Poll,
 		Mentions:    mentions,
-		Formatting:  *req.Formatting,
 		LinkPreview: req.LinkPreview,
 		ScheduledFor: req.ScheduledFor,
 		IsDraft:     req.IsDraft,
@@ -143,6 +152,13 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
+	if req.Formatting != nil {
+		message.Formatting = *req.Formatting
+	}
+
+	if !checkSendRights(c, h.db, &chat, userIDObj, &message) {
+		return
+	}
 
 	// If scheduled, don't send immediately
 	if req.ScheduledFor != nil && req.ScheduledFor.After(time.Now()) {
@@ -208,16 +224,19 @@ func (h *MessageHandler) EditMessage(c *gin.Context) {
 		return
 	}
 
-	// Verify message belongs to user
-	var message models.Message
-	err = h.db.MongoDB.Collection("messages").FindOne(
-		context.Background(),
-		bson.M{"_id": messageID, "sender_id": userIDObj},
-	).Decode(&message)
-
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
-		return
+	// Users edit their own messages; channel admins may also edit others' posts
+	value, _ := c.Get("message")
+	message := value.(models.Message)
+	if message.SenderID != userIDObj {
+		value, _ := c.Get("chat")
+		chat := value.(models.Chat)
+		if chat.Type != "channel" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own messages"})
+			return
+		}
+		if !requireAdminPermission(c, &chat, models.PermEditMessages) {
+			return
+		}
 	}
 
 	now := time.Now()
@@ -270,8 +289,21 @@ func (h *MessageHandler) DeleteMessage(c *gin.Context) {
 		return
 	}
 
+	// Group and channel admins may delete anyone's messages for everyone
+	if req.DeleteForEveryone && message.SenderID != userIDObj {
+		value, _ := c.Get("chat")
+		chat := value.(models.Chat)
+		if chat.Type != "group" && chat.Type != "channel" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own messages for everyone"})
+			return
+		}
+		if !requireAdminPermission(c, &chat, models.PermDeleteMessages) {
+			return
+		}
+	}
+
 	now := time.Now()
-	if req.DeleteForEveryone && message.SenderID == userIDObj {
+	if req.DeleteForEveryone {
 		// Delete for everyone
 		_, err = h.db.MongoDB.Collection("messages").UpdateOne(
 			context.Background(),
@@ -305,6 +337,20 @@ func (h *MessageHandler) DeleteMessage(c *gin.Context) {
 		return
 	}
 
+	if value, ok := c.Get("chat"); ok && req.DeleteForEveryone {
+		if chat := value.(models.Chat); chat.Type == "group" || chat.Type == "channel" {
+			snapshot := message
+			utils.LogChatEvent(c.Request.Context(), h.db, models.ChatEvent{
+				ChatID:       chat.ID,
+				ActorID:      userIDObj,
+				Action:       models.EventMessageDeleted,
+				TargetUserID: &snapshot.SenderID,
+				MessageID:    &snapshot.ID,
+				Message:      &snapshot,
+			})
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Message deleted successfully"})
 }
 
@@ -339,13 +385,54 @@ func (h *MessageHandler) ForwardMessage(c *gin.Context) {
 		return
 	}
 
-	// Forward to each chat
-	var forwardedMessages []models.Message
+	// Every target must be a chat of the caller that lets them post the message
+	var chatIDs []primitive.ObjectID
 	for _, chatIDStr := range req.ChatIDs {
 		chatID, err := primitive.ObjectIDFromHex(chatIDStr)
 		if err != nil {
 			continue
 		}
+		target, ok := memberChat(c, h.db, chatID)
+		if !ok {
+			return
+		}
+		if target.Type == "channel" && !requireAdminPermission(c, target, models.PermPostMessages) {
+			return
+		}
+		if !checkNotBlocked(c, h.db, target, userIDObj) || !checkSendRights(c, h.db, target, userIDObj, &originalMessage) {
+			return
+		}
+		chatIDs = append(chatIDs, chatID)
+	}
+
+	// Forwards of a user's message only link back to it when the user's
+	// forwards privacy lets the forwarder through, and carry just the
+	// sender's name otherwise; channel posts always link back
+	forwardedFrom, forwardedFromChat := &originalMessage.ID, &originalMessage.ChatID
+	var forwardedFromName string
+	var sourceChat models.Chat
+	err = h.db.MongoDB.Collection("chats").FindOne(
+		c.Request.Context(),
+		bson.M{"_id": originalMessage.ChatID},
+		options.FindOne().SetProjection(bson.M{"type": 1}),
+	).Decode(&sourceChat)
+	if err != nil || sourceChat.Type != "channel" {
+		viewer := utils.NewProfileViewer(h.db, userIDObj)
+		if !viewer.Allows(c.Request.Context(), originalMessage.SenderID, utils.PrivacyForwards) {
+			forwardedFrom, forwardedFromChat = nil, nil
+			var sender models.User
+			_ = h.db.MongoDB.Collection("users").FindOne(
+				c.Request.Context(),
+				bson.M{"_id": originalMessage.SenderID},
+				options.FindOne().SetProjection(bson.M{"first_name": 1, "last_name": 1}),
+			).Decode(&sender)
+			forwardedFromName = strings.TrimSpace(sender.FirstName + " " + sender.LastName)
+		}
+	}
+
+	// Forward to each chat
+	var forwardedMessages []models.Message
+	for _, chatID := range chatIDs {
 
 		forwardedMessage := models.Message{
 			ID:              primitive.NewObjectID(),
@@ -359,8 +446,9 @@ func (h *MessageHandler) ForwardMessage(c *gin.Context) {
 			FileSize:       originalMessage.FileSize,
 			Duration:       originalMessage.Duration,
 			Status:         "sent",
-			ForwardedFrom:   &originalMessage.ID,
-			ForwardedFromChat: &originalMessage.ChatID,
+			ForwardedFrom:   forwardedFrom,
+			ForwardedFromChat: forwardedFromChat,
+			ForwardedFromName: forwardedFromName,
 			Location:        originalMessage.Location,
 			Contact:         originalMessage.Contact,
 			Poll:            originalMessage.Poll,
@@ -507,6 +595,9 @@ func (h *MessageHandler) MarkAsRead(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
 		return
 	}
+	if _, ok := memberChat(c, h.db, chatID); !ok {
+		return
+	}
 
 	if len(req.MessageIDs) > 0 {
 		// Mark specific messages as read
@@ -609,22 +700,21 @@ func (h *MessageHandler) MarkAsRead(c *gin.Context) {
 }
 
 func (h *MessageHandler) PinMessage(c *gin.Context) {
-	chatIDStr := c.Param("chat_id")
-	chatID, err := primitive.ObjectIDFromHex(chatIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
-		return
-	}
-
-	messageIDStr := c.Param("message_id")
-	messageID, err := primitive.ObjectIDFromHex(messageIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
-		return
+	// The message and its chat are checked by the route middleware
+	value, _ := c.Get("message")
+	message := value.(models.Message)
+	messageID, chatID := message.ID, message.ChatID
+
+	// Anyone may pin in private chats, groups and channels need pin_messages
+	value, _ = c.Get("chat")
+	if chat := value.(models.Chat); chat.Type == "group" || chat.Type == "channel" {
+		if !requireAdminPermission(c, &chat, models.PermPinMessages) {
+			return
+		}
 	}
 
 	// Update message
-	_, err = h.db.MongoDB.Collection("messages").UpdateOne(
+	_, err := h.db.MongoDB.Collection("messages").UpdateOne(
 		context.Background(),
 		bson.M{"_id": messageID},
 		bson.M{"$set": bson.M{
@@ -654,26 +744,27 @@ func (h *MessageHandler) PinMessage(c *gin.Context) {
 		)
 	}
 
+	logMessageEvent(c, h.db, models.EventMessagePinned, &message)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Message pinned"})
 }
 
 func (h *MessageHandler) UnpinMessage(c *gin.Context) {
-	chatIDStr := c.Param("chat_id")
-	chatID, err := primitive.ObjectIDFromHex(chatIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
-		return
-	}
-
-	messageIDStr := c.Param("message_id")
-	messageID, err := primitive.ObjectIDFromHex(messageIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
-		return
+	// The message and its chat are checked by the route middleware
+	value, _ := c.Get("message")
+	message := value.(models.Message)
+	messageID, chatID := message.ID, message.ChatID
+
+	// Anyone may pin in private chats, groups and channels need pin_messages
+	value, _ = c.Get("chat")
+	if chat := value.(models.Chat); chat.Type == "group" || chat.Type == "channel" {
+		if !requireAdminPermission(c, &chat, models.PermPinMessages) {
+			return
+		}
 	}
 
 	// Update message
-	_, err = h.db.MongoDB.Collection("messages").UpdateOne(
+	_, err := h.db.MongoDB.Collection("messages").UpdateOne(
 		context.Background(),
 		bson.M{"_id": messageID},
 		bson.M{"$set": bson.M{
@@ -707,6 +798,8 @@ func (h *MessageHandler) UnpinMessage(c *gin.Context) {
 		)
 	}
 
+	logMessageEvent(c, h.db, models.EventMessageUnpinned, &message)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Message unpinned"})
 }
 
@@ -796,6 +889,23 @@ func (h *MessageHandler) SearchMessages(c *gin.Context) {
 		}
 	}
 
+	// Only chats the caller can read are searched
+	var chatFilter interface{}
+	if chatID != nil {
+		if _, err := utils.ChatForReader(c.Request.Context(), h.db, *chatID, userIDObj); err != nil {
+			respondChatAccessError(c, err)
+			return
+		}
+		chatFilter = *chatID
+	} else {
+		chatIDs, err := utils.MemberChatIDs(c.Request.Context(), h.db, userIDObj)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search messages"})
+			return
+		}
+		chatFilter = bson.M{"$in": chatIDs}
+	}
+
 	filter := bson.M{
 		"$or": []bson.M{
 			{"content": bson.M{"$regex": query, "$options": "i"}},
@@ -805,9 +915,7 @@ func (h *MessageHandler) SearchMessages(c *gin.Context) {
 		"deleted_for": bson.M{"$ne": userIDObj},
 	}
 
-	if chatID != nil {
-		filter["chat_id"] = *chatID
-	}
+	filter["chat_id"] = chatFilter
 
 	cursor, err := h.db.MongoDB.Collection("messages").Find(
 		context.Background(),
@@ -876,3 +984,20 @@ func (h *MessageHandler) TranslateMessage(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"translated_text": translatedText})
 }
 
+
+// logMessageEvent records an action on a group or channel message in the
+// chat's event log.
+func logMessageEvent(c *gin.Context, db *database.Database, action string, message *models.Message) {
+	value, _ := c.Get("chat")
+	chat := value.(models.Chat)
+	if chat.Type != "group" && chat.Type != "channel" {
+		return
+	}
+	userID, _ := c.Get("user_id")
+	utils.LogChatEvent(c.Request.Context(), db, models.ChatEvent{
+		ChatID:    chat.ID,
+		ActorID:   userID.(primitive.ObjectID),
+		Action:    action,
+		MessageID: &message.ID,
+	})
+}
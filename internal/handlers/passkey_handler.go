@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	passkeyChallengeTTL = 5 * time.Minute
+	maxPasskeysPerUser  = 10
+)
+
+type PasskeyAttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+	AttestationObject string   `json:"attestationObject" binding:"required"`
+	Transports        []string `json:"transports,omitempty"`
+}
+
+// RegisterPasskeyRequest is the PublicKeyCredential from navigator.credentials.create().
+type RegisterPasskeyRequest struct {
+	ID       string                     `json:"id" binding:"required"`
+	Type     string                     `json:"type"`
+	Response PasskeyAttestationResponse `json:"response"`
+	Name     string                     `json:"name,omitempty"`
+	Password string                     `json:"password,omitempty"` // cloud password, or
+	Code     string                     `json:"code,omitempty"`     // an SMS code from /auth/send-code
+}
+
+type PasskeyAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AuthenticatorData string `json:"authenticatorData" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+// PasskeyLoginRequest is the PublicKeyCredential from navigator.credentials.get().
+type PasskeyLoginRequest struct {
+	ID       string                   `json:"id" binding:"required"`
+	Type     string                   `json:"type"`
+	Response PasskeyAssertionResponse `json:"response"`
+}
+
+// newPasskeyChallenge stores a single-use ceremony challenge.
+func (h *AuthHandler) newPasskeyChallenge(c *gin.Context, ceremony string, userID *primitive.ObjectID) (string, bool) {
+	challenge, err := utils.NewWebAuthnChallenge()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create challenge"})
+		return "", false
+	}
+	now := time.Now()
+	_, err = h.db.MongoDB.Collection("webauthn_challenges").InsertOne(c.Request.Context(), models.WebAuthnChallenge{
+		ID:        primitive.NewObjectID(),
+		Challenge: challenge,
+		Ceremony:  ceremony,
+		UserID:    userID,
+		ExpiresAt: now.Add(passkeyChallengeTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create challenge"})
+		return "", false
+	}
+	return challenge, true
+}
+
+// consumePasskeyChallenge burns the challenge a WebAuthn response answers.
+func (h *AuthHandler) consumePasskeyChallenge(c *gin.Context, clientDataJSON []byte, ceremony string, userID *primitive.ObjectID) (string, bool) {
+	challenge, err := utils.ClientDataChallenge(clientDataJSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client data"})
+		return "", false
+	}
+
+	filter := bson.M{
+		"challenge":  challenge,
+		"ceremony":   ceremony,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	if userID != nil {
+		filter["user_id"] = *userID
+	}
+	var stored models.WebAuthnChallenge
+	err = h.db.MongoDB.Collection("webauthn_challenges").FindOneAndDelete(c.Request.Context(), filter).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Challenge lookup failed"})
+		return "", false
+	}
+	return stored.Challenge, true
+}
+
+// checkPasswordOrCode confirms a sensitive change from a logged-in session
+// with the cloud password or, if none is given, a fresh SMS code. Wrong
+// passwords count toward the account's verification lockout.
+func (h *AuthHandler) checkPasswordOrCode(c *gin.Context, user models.User, password, code string) bool {
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+	switch {
+	case password != "" && user.PasswordHash != "":
+		if err := h.guard.CheckVerify(ctx, user.PhoneNumber, ip); err != nil {
+			respondVerificationError(c, err)
+			return false
+		}
+		if !checkPassword(user.PasswordHash, password) {
+			h.guard.RecordFailure(ctx, user.PhoneNumber, ip, "wrong_password")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+			return false
+		}
+		h.guard.RecordSuccess(ctx, user.PhoneNumber)
+		return true
+	case code != "":
+		ok, err := h.consumeVerificationCode(ctx, user.PhoneNumber, code, ip)
+		if err != nil {
+			respondVerificationError(c, err)
+			return false
+		}
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+			return false
+		}
+		return true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Your password or a code sent to your phone is required"})
+		return false
+	}
+}
+
+func (h *AuthHandler) userPasskeys(c *gin.Context, userID primitive.ObjectID) ([]models.Passkey, error) {
+	cursor, err := h.db.MongoDB.Collection("passkeys").Find(
+		c.Request.Context(),
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.M{"created_at": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(c.Request.Context())
+
+	passkeys := []models.Passkey{}
+	if err := cursor.All(c.Request.Context(), &passkeys); err != nil {
+		return nil, err
+	}
+	return passkeys, nil
+}
+
+// PasskeyRegistrationOptions starts registering a passkey for the current user.
+func (h *AuthHandler) PasskeyRegistrationOptions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(c.Request.Context(), bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	passkeys, err := h.userPasskeys(c, userIDObj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch passkeys"})
+		return
+	}
+	if len(passkeys) >= maxPasskeysPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey limit reached"})
+		return
+	}
+
+	// The authenticator refuses to create a second passkey for this account
+	exclude := make([]utils.PasskeyDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		exclude = append(exclude, utils.PasskeyDescriptor{Type: "public-key", ID: passkey.CredentialID, Transports: passkey.Transports})
+	}
+
+	challenge, ok := h.newPasskeyChallenge(c, "registration", &userIDObj)
+	if !ok {
+		return
+	}
+
+	name := user.PhoneNumber
+	if user.Username != "" {
+		name = user.Username
+	}
+	displayName := user.Username
+	if displayName == "" {
+		displayName = user.PhoneNumber
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"publicKey": h.webauthn.RegistrationOptions(challenge, userIDObj[:], name, displayName, exclude),
+	})
+}
+
+// RegisterPasskey verifies the authenticator's response and stores the passkey.
+func (h *AuthHandler) RegisterPasskey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req RegisterPasskeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clientDataJSON, err1 := utils.DecodeBase64URL(req.Response.ClientDataJSON)
+	attestationObject, err2 := utils.DecodeBase64URL(req.Response.AttestationObject)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Response fields must be base64url encoded"})
+		return
+	}
+
+	// A passkey logs in without the SMS code, so a session alone must not be
+	// able to add one
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(c.Request.Context(), bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !h.checkPasswordOrCode(c, user, req.Password, req.Code) {
+		return
+	}
+
+	challenge, ok := h.consumePasskeyChallenge(c, clientDataJSON, "registration", &userIDObj)
+	if !ok {
+		return
+	}
+
+	registered, err := h.webauthn.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	passkey := models.Passkey{
+		ID:             primitive.NewObjectID(),
+		UserID:         userIDObj,
+		Name:           name,
+		CredentialID:   base64.RawURLEncoding.EncodeToString(registered.CredentialID),
+		PublicKey:      registered.PublicKey,
+		Algorithm:      registered.Algorithm,
+		SignCount:      registered.SignCount,
+		AAGUID:         hex.EncodeToString(registered.AAGUID),
+		Transports:     req.Response.Transports,
+		BackupEligible: registered.BackupEligible,
+		BackupState:    registered.BackupState,
+		CreatedAt:      time.Now(),
+	}
+
+	// Credential IDs are globally unique (see EnsureIndexes); one registered
+	// elsewhere is refused
+	if _, err := h.db.MongoDB.Collection("passkeys").InsertOne(c.Request.Context(), passkey); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Passkey is already registered"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save passkey"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, passkey)
+}
+
+// GetPasskeys lists the current user's passkeys.
+func (h *AuthHandler) GetPasskeys(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	passkeys, err := h.userPasskeys(c, userIDObj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, passkeys)
+}
+
+// DeletePasskey removes one of the current user's passkeys.
+func (h *AuthHandler) DeletePasskey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	passkeyID, err := primitive.ObjectIDFromHex(c.Param("passkey_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	result, err := h.db.MongoDB.Collection("passkeys").DeleteOne(c.Request.Context(), bson.M{"_id": passkeyID, "user_id": userIDObj})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted"})
+}
+
+// PasskeyLoginOptions starts a passkey login. No phone number is needed:
+// the authenticator offers the passkeys it holds for this site.
+func (h *AuthHandler) PasskeyLoginOptions(c *gin.Context) {
+	challenge, ok := h.newPasskeyChallenge(c, "login", nil)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"publicKey": h.webauthn.AssertionOptions(challenge, nil),
+	})
+}
+
+// PasskeyLogin verifies a passkey assertion and logs the user in, in place
+// of an SMS code. Further login steps (cloud password, TOTP, new-device
+// approval) still apply.
+func (h *AuthHandler) PasskeyLogin(c *gin.Context) {
+	var req PasskeyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clientDataJSON, err1 := utils.DecodeBase64URL(req.Response.ClientDataJSON)
+	authenticatorData, err2 := utils.DecodeBase64URL(req.Response.AuthenticatorData)
+	signature, err3 := utils.DecodeBase64URL(req.Response.Signature)
+	credentialID, err4 := utils.DecodeBase64URL(req.ID)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Response fields must be base64url encoded"})
+		return
+	}
+
+	challenge, ok := h.consumePasskeyChallenge(c, clientDataJSON, "login", nil)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	passkeys := h.db.MongoDB.Collection("passkeys")
+
+	var passkey models.Passkey
+	err := passkeys.FindOne(ctx, bson.M{"credential_id": base64.RawURLEncoding.EncodeToString(credentialID)}).Decode(&passkey)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown passkey"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Passkey lookup failed"})
+		return
+	}
+
+	// The user handle, when returned, must name the passkey's owner
+	if req.Response.UserHandle != "" {
+		handle, err := utils.DecodeBase64URL(req.Response.UserHandle)
+		if err != nil || string(handle) != string(passkey.UserID[:]) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey does not belong to this account"})
+			return
+		}
+	}
+
+	assertion, err := h.webauthn.VerifyAssertion(challenge, passkey.PublicKey, passkey.SignCount, clientDataJSON, authenticatorData, signature)
+	if errors.Is(err, utils.ErrPasskeySignCount) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey sign counter mismatch; the passkey may have been cloned"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only advance from the counter that was checked, so concurrent replays fail
+	now := time.Now()
+	result, err := passkeys.UpdateOne(
+		ctx,
+		bson.M{"_id": passkey.ID, "sign_count": passkey.SignCount},
+		bson.M{"$set": bson.M{
+			"sign_count":   assertion.SignCount,
+			"backup_state": assertion.BackupState,
+			"last_used_at": now,
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update passkey"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey sign counter mismatch; the passkey may have been cloned"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": passkey.UserID}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown passkey"})
+		return
+	}
+
+	h.finishLogin(c, user)
+}
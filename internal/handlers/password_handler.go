@@ -0,0 +1,515 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength    = 8
+	maxPasswordLength    = 72 // bcrypt limit
+	challengeTTL         = 10 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+type VerifyPasswordRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Password       string `json:"password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code,omitempty"` // SMS code, required to set the first password
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	EmailCode   string `json:"email_code,omitempty"` // required with two-step, see /auth/recovery/send-code
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type EnableTwoStepRequest struct {
+	Password string `json:"password" binding:"required"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+type DisableTwoStepRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return errors.New("password must be at least 8 characters")
+	}
+	if len(password) > maxPasswordLength {
+		return errors.New("password must be at most 72 bytes")
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// pendingLoginSteps lists the extra steps a user must pass after the first
+// factor, skipping the ones already completed in this login.
+func pendingLoginSteps(user models.User, completed ...string) []string {
+	done := make(map[string]bool, len(completed))
+	for _, step := range completed {
+		done[step] = true
+	}
+
+	var steps []string
+	if user.TwoStepEnabled && user.PasswordHash != "" && !done["password"] {
+		steps = append(steps, "password")
+	}
+	if user.TOTPEnabled && user.TOTPSecret != "" && !done["totp"] {
+		steps = append(steps, "totp")
+	}
+	return steps
+}
+
+// finishLogin issues tokens for the user, or a challenge when the account
+// has further login steps (two-step cloud password, TOTP, and approval of a
+// new device, which always comes last).
+func (h *AuthHandler) finishLogin(c *gin.Context, user models.User, completed ...string) {
+	ctx := c.Request.Context()
+	info := sessionInfo(c)
+
+	pending := pendingLoginSteps(user, completed...)
+	needsApproval, err := h.needsDeviceApproval(ctx, user, info)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check device"})
+		return
+	}
+	if needsApproval {
+		pending = append(pending, deviceApprovalStep)
+	}
+	if len(pending) == 0 {
+		h.respondWithTokens(c, http.StatusOK, user, nil)
+		return
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create challenge"})
+		return
+	}
+	challenge := models.AuthChallenge{
+		ID:         primitive.NewObjectID(),
+		UserID:     user.ID,
+		TokenHash:  utils.HashToken(token),
+		Pending:    pending,
+		DeviceID:   info.DeviceID,
+		DeviceName: info.DeviceName,
+		DeviceType: info.DeviceType,
+		IPAddress:  info.IPAddress,
+		UserAgent:  info.UserAgent,
+		ExpiresAt:  time.Now().Add(challengeTTL),
+		CreatedAt:  time.Now(),
+	}
+	if _, err := h.db.MongoDB.Collection("auth_challenges").InsertOne(ctx, challenge); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create challenge"})
+		return
+	}
+	if len(pending) == 1 && needsApproval {
+		h.requestDeviceApproval(ctx, challenge)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"two_step_required":        len(pending) > 1 || !needsApproval,
+		"device_approval_required": needsApproval,
+		"challenge_token":          token,
+		"pending":                  pending,
+		"password_hint":            user.PasswordHint,
+	})
+}
+
+// onlyDeviceApprovalLeft reports whether a challenge is waiting for nothing
+// but the approval of its device.
+func onlyDeviceApprovalLeft(pending []string) bool {
+	return len(pending) == 1 && pending[0] == deviceApprovalStep
+}
+
+// advanceChallenge checks one pending step of a login challenge. When the last
+// step passes tokens are issued, otherwise the remaining steps are returned.
+// Every check takes an attempt before it runs, and a challenge is burned after
+// maxChallengeAttempts failed checks.
+func (h *AuthHandler) advanceChallenge(c *gin.Context, challengeToken, step string, verify func(user models.User) bool) {
+	ctx := c.Request.Context()
+	challenges := h.db.MongoDB.Collection("auth_challenges")
+
+	var challenge models.AuthChallenge
+	err := challenges.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"token_hash": utils.HashToken(challengeToken),
+			"expires_at": bson.M{"$gt": time.Now()},
+			"attempts":   bson.M{"$lt": maxChallengeAttempts},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&challenge)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Challenge lookup failed"})
+		return
+	}
+	refund := bson.M{"$inc": bson.M{"attempts": -1}}
+
+	found := false
+	for _, pending := range challenge.Pending {
+		if pending == step {
+			found = true
+		}
+	}
+	if !found {
+		_, _ = challenges.UpdateOne(ctx, bson.M{"_id": challenge.ID}, refund)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Step is not pending", "pending": challenge.Pending})
+		return
+	}
+
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": challenge.UserID}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	if !verify(user) {
+		if challenge.Attempts >= maxChallengeAttempts {
+			_, _ = challenges.DeleteOne(ctx, bson.M{"_id": challenge.ID})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many failed attempts, please log in again"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":              "Verification failed",
+			"attempts_remaining": maxChallengeAttempts - challenge.Attempts,
+		})
+		return
+	}
+
+	// A passed check gives its attempt back. Only the request that removes
+	// the step from the pending list may advance the challenge.
+	var updated models.AuthChallenge
+	err = challenges.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": challenge.ID, "pending": step},
+		bson.M{"$pull": bson.M{"pending": step}, "$inc": bson.M{"attempts": -1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	remaining := updated.Pending
+	if len(remaining) > 0 {
+		if onlyDeviceApprovalLeft(remaining) {
+			h.requestDeviceApproval(ctx, updated)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"two_step_required":        !onlyDeviceApprovalLeft(remaining),
+			"device_approval_required": onlyDeviceApprovalLeft(remaining),
+			"challenge_token":          challengeToken,
+			"pending":                  remaining,
+		})
+		return
+	}
+
+	// Tokens are issued once, by the request that deletes the challenge
+	deleted, err := challenges.DeleteOne(ctx, bson.M{"_id": challenge.ID})
+	if err != nil || deleted.DeletedCount == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	h.respondWithTokens(c, http.StatusOK, user, nil)
+}
+
+// VerifyPassword completes the cloud password step of a two-step login.
+func (h *AuthHandler) VerifyPassword(c *gin.Context) {
+	var req VerifyPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.advanceChallenge(c, req.ChallengeToken, "password", func(user models.User) bool {
+		return user.PasswordHash != "" && checkPassword(user.PasswordHash, req.Password)
+	})
+}
+
+// ChangePassword sets or changes the password of the current user and
+// terminates all other sessions.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+	sessionID, _ := c.Get("session_id")
+	sessionIDObj := sessionID.(primitive.ObjectID)
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Wrong current passwords count toward the account's lockout like at
+	// login. Without a password yet, a stolen session must not be able to
+	// set one, so the phone has to confirm it.
+	ip := c.ClientIP()
+	if user.PasswordHash != "" {
+		if err := h.guard.CheckVerify(ctx, user.PhoneNumber, ip); err != nil {
+			respondVerificationError(c, err)
+			return
+		}
+		if !checkPassword(user.PasswordHash, req.CurrentPassword) {
+			h.guard.RecordFailure(ctx, user.PhoneNumber, ip, "wrong_password")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+		h.guard.RecordSuccess(ctx, user.PhoneNumber)
+	} else {
+		if req.Code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A code sent to your phone is required to set a password"})
+			return
+		}
+		ok, err := h.consumeVerificationCode(ctx, user.PhoneNumber, req.Code, ip)
+		if err != nil {
+			respondVerificationError(c, err)
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+			return
+		}
+	}
+
+	if err := h.setPassword(context.Background(), userIDObj, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	_ = h.sessions.RevokeAll(context.Background(), userIDObj, sessionIDObj, "password_changed")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated"})
+}
+
+// ResetPassword sets a new password after SMS verification. Accounts with
+// two-step verification also need a code sent to their recovery email.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !normalizeRequestPhone(c, &req.PhoneNumber) {
+		return
+	}
+
+	if err := validatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"phone_number": req.PhoneNumber}).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	if user.TwoStepEnabled {
+		if user.RecoveryEmail == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-step verification is enabled and no recovery email is set; the password cannot be reset"})
+			return
+		}
+		if req.EmailCode == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Recovery email code required", "email_code_required": true})
+			return
+		}
+	}
+
+	// The SMS code is checked first so a wrong one does not use up the
+	// recovery email code as well
+	ok, err := h.consumeVerificationCode(ctx, req.PhoneNumber, req.Code, c.ClientIP())
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	if user.TwoStepEnabled {
+		if _, ok := h.consumeEmailCode(ctx, user.ID, "account_recovery", req.EmailCode); !ok {
+			h.guard.RecordFailure(ctx, req.PhoneNumber, c.ClientIP(), "wrong_code")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+			return
+		}
+	}
+
+	if err := h.setPassword(ctx, user.ID, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	_ = h.sessions.RevokeAll(ctx, user.ID, primitive.NilObjectID, "password_reset")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset, please log in again"})
+}
+
+// EnableTwoStep turns on the cloud password. If the user has no password yet,
+// the given one becomes it; otherwise it must match the current password.
+func (h *AuthHandler) EnableTwoStep(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req EnableTwoStepRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.PasswordHash == "" {
+		if err := validatePassword(req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := h.setPassword(ctx, userIDObj, req.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
+			return
+		}
+	} else if !checkPassword(user.PasswordHash, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	if err := h.setTwoStep(ctx, userIDObj, true, req.Hint); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-step verification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-step verification enabled"})
+}
+
+// DisableTwoStep turns off the cloud password step after confirming the password.
+func (h *AuthHandler) DisableTwoStep(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req DisableTwoStepRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.PasswordHash == "" || !checkPassword(user.PasswordHash, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	if err := h.setTwoStep(ctx, userIDObj, false, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-step verification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-step verification disabled"})
+}
+
+// setPassword hashes and stores a new password. Callers validate it first.
+func (h *AuthHandler) setPassword(ctx context.Context, userID primitive.ObjectID, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.db.MongoDB.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{
+			"password_hash": hash,
+			"updated_at":    time.Now(),
+		}},
+	)
+	return err
+}
+
+// setTwoStep stores the two-step flag on the user, which is authoritative,
+// and mirrors it into the user's settings document.
+func (h *AuthHandler) setTwoStep(ctx context.Context, userID primitive.ObjectID, enabled bool, hint string) error {
+	_, err := h.db.MongoDB.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{
+			"two_step_enabled": enabled,
+			"password_hint":    hint,
+			"updated_at":       time.Now(),
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, _ = h.db.MongoDB.Collection("user_settings").UpdateOne(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{
+			"account.two_step_enabled": enabled,
+			"privacy.two_step_enabled": enabled,
+			"updated_at":               time.Now(),
+		}},
+	)
+	return nil
+}
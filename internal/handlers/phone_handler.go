@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ChangePhoneCodeRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+}
+
+type ChangePhoneRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	Password    string `json:"password,omitempty"` // required with two-step verification
+}
+
+// phoneInUse reports whether any other account uses the phone number.
+func (h *AuthHandler) phoneInUse(ctx context.Context, phone string, except primitive.ObjectID) (bool, error) {
+	count, err := h.db.MongoDB.Collection("users").CountDocuments(ctx, bson.M{
+		"phone_number": phone,
+		"_id":          bson.M{"$ne": except},
+	})
+	return count > 0, err
+}
+
+// SendChangePhoneCode sends a verification code to the number the current
+// user wants to move their account to.
+func (h *AuthHandler) SendChangePhoneCode(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req ChangePhoneCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	phone := utils.NormalizePhone(req.PhoneNumber)
+	if phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number format"})
+		return
+	}
+
+	inUse, err := h.phoneInUse(ctx, phone, userIDObj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check phone number"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone number is already in use"})
+		return
+	}
+
+	if err := h.guard.AllowSend(ctx, phone, c.ClientIP()); err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+
+	code, err := newNumericCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate code"})
+		return
+	}
+	if err := h.storeVerificationCode(ctx, phone, code, 5*time.Minute); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store verification code"})
+		return
+	}
+
+	// The code must reach the new number itself, never the account's email
+	delivery, err := h.otp.Send(ctx, utils.OTPRecipient{PhoneNumber: phone}, code, "phone_change")
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to deliver verification code", "delivery_id": delivery.ID})
+		return
+	}
+
+	response := gin.H{
+		"message":     "Verification code sent",
+		"delivery_id": delivery.ID,
+		"channel":     delivery.Channel,
+	}
+	if devDelivery(delivery) {
+		response["code"] = code
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ChangePhone moves the current user's account to a verified new phone
+// number, which becomes the login identity.
+func (h *AuthHandler) ChangePhone(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req ChangePhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	phone := utils.NormalizePhone(req.PhoneNumber)
+	if phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number format"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.PhoneNumber == phone {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This is already your phone number"})
+		return
+	}
+
+	// With two-step verification, a session alone cannot move the account.
+	// Wrong passwords count toward the account's lockout, and the code is
+	// used up first so every guess costs a code.
+	ip := c.ClientIP()
+	needPassword := user.TwoStepEnabled && user.PasswordHash != ""
+	if needPassword {
+		if err := h.guard.CheckVerify(ctx, user.PhoneNumber, ip); err != nil {
+			respondVerificationError(c, err)
+			return
+		}
+	}
+
+	ok, err := h.consumeVerificationCode(ctx, phone, req.Code, ip)
+	if err != nil {
+		respondVerificationError(c, err)
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	if needPassword {
+		if !checkPassword(user.PasswordHash, req.Password) {
+			h.guard.RecordFailure(ctx, user.PhoneNumber, ip, "wrong_password")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+			return
+		}
+		h.guard.RecordSuccess(ctx, user.PhoneNumber)
+	}
+
+	inUse, err := h.phoneInUse(ctx, phone, userIDObj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check phone number"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone number is already in use"})
+		return
+	}
+
+	oldPhone := user.PhoneNumber
+	users := h.db.MongoDB.Collection("users")
+	_, err = users.UpdateOne(
+		ctx,
+		bson.M{"_id": userIDObj, "phone_number": oldPhone},
+		bson.M{"$set": bson.M{"phone_number": phone, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change phone number"})
+		return
+	}
+
+	// Another account may have claimed the number in the meantime
+	if inUse, err := h.phoneInUse(ctx, phone, userIDObj); err != nil || inUse {
+		_, _ = users.UpdateOne(ctx, bson.M{"_id": userIDObj, "phone_number": phone}, bson.M{"$set": bson.M{"phone_number": oldPhone}})
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone number is already in use"})
+		return
+	}
+
+	if err := h.migratePhoneNumber(ctx, userIDObj, oldPhone, phone); err != nil {
+		log.Printf("Phone number migration for user %s incomplete: %v", userIDObj.Hex(), err)
+	}
+
+	h.notifyUser(ctx, userIDObj, "phone_changed",
+		fmt.Sprintf("Your phone number was changed to %s. Use it to log in from now on.", phone),
+		gin.H{"phone_number": phone})
+	user.PhoneNumber = phone
+	h.notifyContactsOfPhoneChange(ctx, user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Phone number changed", "phone_number": phone})
+}
+
+// migratePhoneNumber updates the copies of the user's phone number kept
+// outside the user record: account settings and shared contact cards.
+func (h *AuthHandler) migratePhoneNumber(ctx context.Context, userID primitive.ObjectID, oldPhone, newPhone string) error {
+	_, err := h.db.MongoDB.Collection("user_settings").UpdateOne(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{"account.phone_number": newPhone}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.db.MongoDB.Collection("messages").UpdateMany(
+		ctx,
+		bson.M{"$or": []bson.M{
+			{"contact.user_id": userID},
+			{"contact.phone_number": oldPhone, "contact.user_id": nil},
+		}},
+		bson.M{"$set": bson.M{
+			"contact.phone_number": newPhone,
+			"contact.user_id":      userID,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.db.MongoDB.Collection("verification_codes").DeleteMany(ctx, bson.M{"phone_number": oldPhone})
+	return err
+}
+
+// notifyContactsOfPhoneChange tells users who have the user in their
+// contacts about the new number, but only those who could see the number on
+// the user's profile. Adding a contact is one-way, so having the user as a
+// contact is not enough on its own.
+func (h *AuthHandler) notifyContactsOfPhoneChange(ctx context.Context, user models.User) {
+	if user.HidePhoneNumber {
+		return
+	}
+
+	cursor, err := h.db.MongoDB.Collection("contacts").Find(ctx, bson.M{"contact_id": user.ID})
+	if err != nil {
+		return
+	}
+	var contacts []models.Contact
+	if err := cursor.All(ctx, &contacts); err != nil {
+		return
+	}
+
+	name := user.Username
+	if name == "" {
+		name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
+	if name == "" {
+		name = "Your contact"
+	}
+	text := fmt.Sprintf("%s changed their phone number to %s.", name, user.PhoneNumber)
+	for _, contact := range contacts {
+		if utils.NewProfileViewer(h.db, contact.UserID).Profile(ctx, &user).PhoneNumber == "" {
+			continue
+		}
+		h.notifyUser(ctx, contact.UserID, "contact_phone_changed", text, gin.H{
+			"user_id":      user.ID,
+			"phone_number": user.PhoneNumber,
+		})
+	}
+}
@@ -60,16 +60,11 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	product.ID = result.InsertedID.(primitive.ObjectID)
 
 	// Populate owner info
-	var owner models.User
-	h.db.MongoDB.Collection("users").FindOne(context.Background(), bson.M{"_id": userIDObj}).Decode(&owner)
+	owner, _ := profileViewer(c, h.db).UserProfile(c.Request.Context(), userIDObj)
 	
 	response := gin.H{
 		"product": product,
-		"owner": gin.H{
-			"id":       owner.ID,
-			"username": owner.Username,
-			"avatar":   owner.Avatar,
-		},
+		"owner":   owner,
 	}
 
 	c.JSON(http.StatusCreated, response)
@@ -126,14 +121,14 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 	// Populate owner info and check if user liked each product
 	type ProductWithOwner struct {
 		models.Product
-		Owner     gin.H `json:"owner"`
+		Owner     models.PublicProfile `json:"owner"`
 		IsLiked   bool  `json:"is_liked"`
 	}
 
+	viewer := profileViewer(c, h.db)
 	result := make([]ProductWithOwner, 0, len(products))
 	for _, product := range products {
-		var owner models.User
-		h.db.MongoDB.Collection("users").FindOne(context.Background(), bson.M{"_id": product.OwnerID}).Decode(&owner)
+		owner, _ := viewer.UserProfile(c.Request.Context(), product.OwnerID)
 
 		isLiked := false
 		if exists {
@@ -147,11 +142,7 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 
 		result = append(result, ProductWithOwner{
 			Product: product,
-			Owner: gin.H{
-				"id":       owner.ID,
-				"username": owner.Username,
-				"avatar":   owner.Avatar,
-			},
+			Owner:   owner,
 			IsLiked: isLiked,
 		})
 	}
@@ -191,8 +182,7 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 	)
 
 	// Get owner
-	var owner models.User
-	h.db.MongoDB.Collection("users").FindOne(context.Background(), bson.M{"_id": product.OwnerID}).Decode(&owner)
+	owner, _ := profileViewer(c, h.db).UserProfile(c.Request.Context(), product.OwnerID)
 
 	// Check if user liked
 	userID, exists := c.Get("user_id")
@@ -209,12 +199,7 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"product": product,
-		"owner": gin.H{
-			"id":       owner.ID,
-			"username": owner.Username,
-			"avatar":   owner.Avatar,
-			"bio":      owner.Bio,
-		},
+		"owner":    owner,
 		"is_liked": isLiked,
 	})
 }
@@ -7,6 +7,7 @@ import (
 
 	"chat-backend/internal/database"
 	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -43,6 +44,16 @@ func (h *ProposalHandler) CreateProposal(c *gin.Context) {
 		return
 	}
 
+	blocked, err := utils.IsBlocked(c.Request.Context(), h.db, userIDObj, receiverID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check blocked users"})
+		return
+	}
+	if blocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Proposal could not be sent"})
+		return
+	}
+
 	proposal := models.Proposal{
 		ID:         primitive.NewObjectID(),
 		SenderID:   userIDObj,
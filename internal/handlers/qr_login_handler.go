@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const qrLoginTTL = 2 * time.Minute
+
+type QRLoginTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ApproveQRLoginRequest struct {
+	QRData string `json:"qr_data" binding:"required"` // scanned CHATAPP-LOGIN:<token>
+}
+
+// redeemQRLogin consumes an approved QR login and opens a session for the
+// web client that requested it, like any other login. Each login token can
+// be redeemed once.
+func (h *AuthHandler) redeemQRLogin(ctx context.Context, tokenHash string) (*utils.TokenPair, *models.User, error) {
+	var login models.QRLoginToken
+	err := h.db.MongoDB.Collection("qr_login_tokens").FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"token_hash": tokenHash,
+			"status":     "approved",
+			"expires_at": bson.M{"$gt": time.Now()},
+		},
+		bson.M{"$set": bson.M{"status": "consumed"}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&login)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": *login.UserID}).Decode(&user); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := h.openSession(ctx, user, utils.SessionInfo{
+		DeviceID:   login.DeviceID,
+		DeviceName: login.DeviceName,
+		DeviceType: login.DeviceType,
+		IPAddress:  login.IPAddress,
+		UserAgent:  login.UserAgent,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, &user, nil
+}
+
+func qrLoginResponse(tokens *utils.TokenPair, user *models.User) gin.H {
+	return gin.H{
+		"status":        "approved",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+		"device_secret": tokens.DeviceSecret,
+		"user":          user,
+	}
+}
+
+// CreateQRLogin starts a QR login for a web or desktop client. The client
+// shows the QR code and waits on /ws?qr_login=<token> or polls for the result.
+func (h *AuthHandler) CreateQRLogin(c *gin.Context) {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate login token"})
+		return
+	}
+
+	qr, err := utils.GenerateQRImage(utils.LoginQRData(token))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate QR code"})
+		return
+	}
+
+	info := sessionInfo(c)
+	now := time.Now()
+	login := models.QRLoginToken{
+		ID:         primitive.NewObjectID(),
+		TokenHash:  utils.HashToken(token),
+		Status:     "pending",
+		DeviceID:   info.DeviceID,
+		DeviceName: info.DeviceName,
+		DeviceType: info.DeviceType,
+		IPAddress:  info.IPAddress,
+		UserAgent:  info.UserAgent,
+		ExpiresAt:  now.Add(qrLoginTTL),
+		CreatedAt:  now,
+	}
+	if _, err := h.db.MongoDB.Collection("qr_login_tokens").InsertOne(context.Background(), login); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start QR login"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":      token,
+		"qr":         qr,
+		"expires_at": login.ExpiresAt,
+	})
+}
+
+// PollQRLogin reports the state of a QR login. Once approved, the first poll
+// receives the tokens; later polls see the login as consumed.
+func (h *AuthHandler) PollQRLogin(c *gin.Context) {
+	var req QRLoginTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	hash := utils.HashToken(req.Token)
+
+	var login models.QRLoginToken
+	if err := h.db.MongoDB.Collection("qr_login_tokens").FindOne(ctx, bson.M{"token_hash": hash}).Decode(&login); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login token not found"})
+		return
+	}
+
+	if login.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"status": "expired", "error": "Login token expired"})
+		return
+	}
+
+	switch login.Status {
+	case "pending":
+		c.JSON(http.StatusOK, gin.H{"status": "pending", "expires_at": login.ExpiresAt})
+	case "approved":
+		tokens, user, err := h.redeemQRLogin(ctx, hash)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusGone, gin.H{"status": "consumed", "error": "Login token already used"})
+			return
+		}
+		if err == errAccountDeleted {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account has been deleted"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete login"})
+			return
+		}
+		c.JSON(http.StatusOK, qrLoginResponse(tokens, user))
+	default:
+		c.JSON(http.StatusGone, gin.H{"status": "consumed", "error": "Login token already used"})
+	}
+}
+
+// ApproveQRLogin is called by a logged-in device that scanned a login QR code.
+// If the web client is waiting on the websocket, its tokens are pushed there.
+func (h *AuthHandler) ApproveQRLogin(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+	sessionID, _ := c.Get("session_id")
+	sessionIDObj := sessionID.(primitive.ObjectID)
+
+	var req ApproveQRLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := utils.ParseLoginQRCode(req.QRData)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login QR code"})
+		return
+	}
+
+	ctx := context.Background()
+	hash := utils.HashToken(token)
+	now := time.Now()
+
+	var login models.QRLoginToken
+	err = h.db.MongoDB.Collection("qr_login_tokens").FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"token_hash": hash,
+			"status":     "pending",
+			"expires_at": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{
+			"status":      "approved",
+			"user_id":     userIDObj,
+			"approved_by": sessionIDObj,
+			"approved_at": now,
+		}},
+	).Decode(&login)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusGone, gin.H{"error": "Login token expired or already used"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve login"})
+		return
+	}
+
+	if h.hub.HasQRLoginWaiter(hash) {
+		tokens, user, err := h.redeemQRLogin(ctx, hash)
+		if err == nil {
+			payload, _ := json.Marshal(gin.H{"type": "qr_login", "data": qrLoginResponse(tokens, user)})
+			if !h.hub.DeliverQRLogin(hash, payload) {
+				// The web client went away after redemption; don't leave an
+				// orphaned session behind.
+				_ = h.sessions.Revoke(ctx, user.ID, tokens.SessionID, "terminated")
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Login approved",
+		"device_name": login.DeviceName,
+		"ip_address":  login.IPAddress,
+	})
+}
@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
 	"chat-backend/internal/database"
 	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+	"chat-backend/internal/websocket"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,11 +19,94 @@ import (
 )
 
 type SettingsHandler struct {
-	db *database.Database
+	db       *database.Database
+	sessions *utils.SessionService
+	hub      *websocket.Hub
 }
 
-func NewSettingsHandler(db *database.Database) *SettingsHandler {
-	return &SettingsHandler{db: db}
+func NewSettingsHandler(db *database.Database, sessions *utils.SessionService, hub *websocket.Hub) *SettingsHandler {
+	return &SettingsHandler{db: db, sessions: sessions, hub: hub}
+}
+
+// defaultUserSettings are the settings a user starts with.
+func defaultUserSettings(userID primitive.ObjectID) models.UserSettings {
+	return models.UserSettings{
+		ID:     primitive.NewObjectID(),
+		UserID: userID,
+		Account: models.AccountSettings{
+			AccountStatus: "active",
+		},
+		Privacy: models.PrivacySettings{
+			LastSeen:      "everyone",
+			OnlineStatus:  "everyone",
+			ProfilePhoto:  "everyone",
+			BioVisibility: "everyone",
+			GroupInvites:  "everyone",
+			Forwards:      "everyone",
+			FindByPhone:   true,
+			FindByUsername: true,
+			SecretChatTTL: 0,
+			EncryptionLevel: "standard",
+		},
+		Chat: models.ChatSettings{
+			Theme:          "light",
+			FontSize:       "medium",
+			EmojiEnabled:   true,
+			StickersEnabled: true,
+			GIFEnabled:     true,
+			MessagePreview: true,
+			ReadReceipts:   true,
+			AutoDownload: models.AutoDownloadSettings{
+				Photos:    "wifi",
+				Videos:    "wifi",
+				Audio:     "wifi",
+				Documents: "wifi",
+			},
+		},
+		Notifications: models.NotificationSettings{
+			DirectChats: true,
+			GroupChats:  true,
+			Calls:       true,
+			Sound:       "default",
+			Vibration:   "default",
+		},
+		Appearance: models.AppearanceSettings{
+			Theme:    "system",
+			FontSize: "medium",
+			Animations: true,
+		},
+		Data: models.DataSettings{
+			CloudSync: true,
+		},
+		Calls: models.CallSettings{
+			Quality:       "medium",
+			DataUsageMode: "medium",
+			VideoCalls:    true,
+			VoiceCalls:    true,
+			WhoCanCall:    "everyone",
+			CallHistory:   true,
+		},
+		Groups: models.GroupSettings{
+			WhoCanCreate: "everyone",
+		},
+		Devices: models.DeviceSettings{
+			DeviceNotifications: true,
+		},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
+
+// ensureSettings creates the default settings for a user who has none, so
+// that partial updates never leave a settings document without defaults.
+func (h *SettingsHandler) ensureSettings(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := h.db.MongoDB.Collection("user_settings").UpdateOne(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$setOnInsert": defaultUserSettings(userID)},
+		options.Update().SetUpsert(true),
+	)
+	return err
 }
 
 func (h *SettingsHandler) GetSettings(c *gin.Context) {
@@ -35,66 +121,7 @@ func (h *SettingsHandler) GetSettings(c *gin.Context) {
 
 	if err == mongo.ErrNoDocuments {
 		// Create default settings
-		settings = models.UserSettings{
-			ID:     primitive.NewObjectID(),
-			UserID: userIDObj,
-			Account: models.AccountSettings{
-				AccountStatus: "active",
-			},
-			Privacy: models.PrivacySettings{
-				LastSeen:      "everyone",
-				OnlineStatus:  "everyone",
-				ProfilePhoto:  "everyone",
-				BioVisibility: "everyone",
-				FindByPhone:   true,
-				FindByUsername: true,
-				SecretChatTTL: 0,
-				EncryptionLevel: "standard",
-			},
-			Chat: models.ChatSettings{
-				Theme:          "light",
-				FontSize:       "medium",
-				EmojiEnabled:   true,
-				StickersEnabled: true,
-				GIFEnabled:     true,
-				MessagePreview: true,
-				ReadReceipts:   true,
-				AutoDownload: models.AutoDownloadSettings{
-					Photos:    "wifi",
-					Videos:    "wifi",
-					Audio:     "wifi",
-					Documents: "wifi",
-				},
-			},
-			Notifications: models.NotificationSettings{
-				DirectChats: true,
-				GroupChats:  true,
-				Calls:       true,
-				Sound:       "default",
-				Vibration:   "default",
-			},
-			Appearance: models.AppearanceSettings{
-				Theme:    "system",
-				FontSize: "medium",
-				Animations: true,
-			},
-			Data: models.DataSettings{
-				CloudSync: true,
-			},
-			Calls: models.CallSettings{
-				Quality:       "medium",
-				DataUsageMode: "medium",
-				VideoCalls:    true,
-				VoiceCalls:    true,
-				WhoCanCall:    "everyone",
-				CallHistory:   true,
-			},
-			Groups: models.GroupSettings{
-				WhoCanCreate: "everyone",
-			},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
+		settings = defaultUserSettings(userIDObj)
 		_, err = h.db.MongoDB.Collection("user_settings").InsertOne(context.Background(), settings)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create settings"})
@@ -137,6 +164,14 @@ func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Settings updated successfully"})
 }
 
+// authUser loads the user record, which is authoritative for security
+// settings such as two-step verification and verified emails.
+func (h *SettingsHandler) authUser(userID primitive.ObjectID) models.User {
+	var user models.User
+	_ = h.db.MongoDB.Collection("users").FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	return user
+}
+
 func (h *SettingsHandler) UpdateAccountSettings(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userIDObj := userID.(primitive.ObjectID)
@@ -147,6 +182,16 @@ func (h *SettingsHandler) UpdateAccountSettings(c *gin.Context) {
 		return
 	}
 
+	// two_step_enabled is managed by /auth/two-step, emails by /auth/email,
+	// the phone number by /auth/phone, the username by /users/me/username
+	user := h.authUser(userIDObj)
+	accountSettings.Username = user.Username
+	accountSettings.PhoneNumber = user.PhoneNumber
+	accountSettings.TwoStepEnabled = user.TwoStepEnabled
+	accountSettings.Email = user.Email
+	accountSettings.RecoveryEmail = user.RecoveryEmail
+	accountSettings.AccountStatus = user.AccountStatus
+
 	_, err := h.db.MongoDB.Collection("user_settings").UpdateOne(
 		context.Background(),
 		bson.M{"user_id": userIDObj},
@@ -174,7 +219,38 @@ func (h *SettingsHandler) UpdatePrivacySettings(c *gin.Context) {
 		return
 	}
 
-	_, err := h.db.MongoDB.Collection("user_settings").UpdateOne(
+	rules := map[string]string{
+		utils.PrivacyLastSeen:     privacySettings.LastSeen,
+		utils.PrivacyOnlineStatus: privacySettings.OnlineStatus,
+		utils.PrivacyProfilePhoto: privacySettings.ProfilePhoto,
+		utils.PrivacyBio:          privacySettings.BioVisibility,
+		utils.PrivacyGroupInvites: privacySettings.GroupInvites,
+		utils.PrivacyForwards:     privacySettings.Forwards,
+	}
+	for key, rule := range rules {
+		if !utils.ValidPrivacyRule(rule) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": key + " must be everyone, contacts or nobody"})
+			return
+		}
+	}
+
+	// two_step_enabled is managed by /auth/two-step, exceptions by
+	// /settings/privacy/exceptions/:key, blocked users by /settings/block
+	privacySettings.TwoStepEnabled = h.authUser(userIDObj).TwoStepEnabled
+	var current models.UserSettings
+	err := h.db.MongoDB.Collection("user_settings").FindOne(
+		context.Background(),
+		bson.M{"user_id": userIDObj},
+		options.FindOne().SetProjection(bson.M{"privacy.exceptions": 1, "privacy.blocked_users": 1}),
+	).Decode(&current)
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy settings"})
+		return
+	}
+	privacySettings.Exceptions = current.Privacy.Exceptions
+	privacySettings.BlockedUsers = current.Privacy.BlockedUsers
+
+	_, err = h.db.MongoDB.Collection("user_settings").UpdateOne(
 		context.Background(),
 		bson.M{"user_id": userIDObj},
 		bson.M{"$set": bson.M{
@@ -191,6 +267,100 @@ func (h *SettingsHandler) UpdatePrivacySettings(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Privacy settings updated"})
 }
 
+// UpdatePrivacyExceptions replaces the users and groups that always or never
+// pass one privacy rule. Sending empty lists clears the exceptions.
+func (h *SettingsHandler) UpdatePrivacyExceptions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	key := c.Param("key")
+	if !utils.PrivacyKeys[key] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown privacy key"})
+		return
+	}
+
+	var exceptions models.PrivacyExceptions
+	if err := c.ShouldBindJSON(&exceptions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	exceptions.AlwaysAllowUsers = uniqueObjectIDs(exceptions.AlwaysAllowUsers, userIDObj)
+	exceptions.NeverAllowUsers = uniqueObjectIDs(exceptions.NeverAllowUsers, userIDObj)
+	exceptions.AlwaysAllowChats = uniqueObjectIDs(exceptions.AlwaysAllowChats, primitive.NilObjectID)
+	exceptions.NeverAllowChats = uniqueObjectIDs(exceptions.NeverAllowChats, primitive.NilObjectID)
+	if overlaps(exceptions.AlwaysAllowUsers, exceptions.NeverAllowUsers) || overlaps(exceptions.AlwaysAllowChats, exceptions.NeverAllowChats) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The same user or group cannot be both always and never allowed"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	chatIDs := append(append([]primitive.ObjectID{}, exceptions.AlwaysAllowChats...), exceptions.NeverAllowChats...)
+	if len(chatIDs) > 0 {
+		count, err := h.db.MongoDB.Collection("chats").CountDocuments(ctx, bson.M{
+			"_id":     bson.M{"$in": chatIDs},
+			"type":    "group",
+			"members": userIDObj,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check groups"})
+			return
+		}
+		if int(count) != len(chatIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Exceptions can only name groups you are a member of"})
+			return
+		}
+	}
+
+	if err := h.ensureSettings(ctx, userIDObj); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy exceptions"})
+		return
+	}
+
+	field := "privacy.exceptions." + key
+	update := bson.M{"$set": bson.M{field: exceptions, "updated_at": time.Now()}}
+	if len(exceptions.AlwaysAllowUsers)+len(exceptions.NeverAllowUsers)+len(chatIDs) == 0 {
+		update = bson.M{"$unset": bson.M{field: ""}, "$set": bson.M{"updated_at": time.Now()}}
+	}
+	_, err := h.db.MongoDB.Collection("user_settings").UpdateOne(
+		ctx,
+		bson.M{"user_id": userIDObj},
+		update,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy exceptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": key, "exceptions": exceptions})
+}
+
+// uniqueObjectIDs drops duplicates and skip from ids, keeping the order.
+func uniqueObjectIDs(ids []primitive.ObjectID, skip primitive.ObjectID) []primitive.ObjectID {
+	seen := make(map[primitive.ObjectID]bool, len(ids))
+	unique := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if id == skip || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+func overlaps(a, b []primitive.ObjectID) bool {
+	in := make(map[primitive.ObjectID]bool, len(a))
+	for _, id := range a {
+		in[id] = true
+	}
+	for _, id := range b {
+		if in[id] {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *SettingsHandler) UpdateChatSettings(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userIDObj := userID.(primitive.ObjectID)
@@ -302,62 +472,63 @@ func (h *SettingsHandler) UpdateDataSettings(c *gin.Context) {
 func (h *SettingsHandler) GetSessions(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userIDObj := userID.(primitive.ObjectID)
+	currentSessionID, _ := c.Get("session_id")
 
-	var settings models.UserSettings
-	err := h.db.MongoDB.Collection("user_settings").FindOne(
-		context.Background(),
-		bson.M{"user_id": userIDObj},
-	).Decode(&settings)
-
+	active, err := h.sessions.ListActive(c.Request.Context(), userIDObj)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Settings not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
 		return
 	}
 
-	c.JSON(http.StatusOK, settings.Privacy.ActiveSessions)
+	sessions := make([]models.Session, 0, len(active))
+	for _, session := range active {
+		sessions = append(sessions, models.Session{
+			ID:         session.ID.Hex(),
+			DeviceName: session.DeviceName,
+			DeviceType: session.DeviceType,
+			IPAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+			LastActive: session.LastActive,
+			IsCurrent:  session.ID == currentSessionID,
+		})
+	}
+
+	c.JSON(http.StatusOK, sessions)
 }
 
 func (h *SettingsHandler) TerminateSession(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userIDObj := userID.(primitive.ObjectID)
-	sessionID := c.Param("session_id")
-
-	var settings models.UserSettings
-	err := h.db.MongoDB.Collection("user_settings").FindOne(
-		context.Background(),
-		bson.M{"user_id": userIDObj},
-	).Decode(&settings)
 
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("session_id"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Settings not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
 		return
 	}
 
-	// Remove session from list
-	var updatedSessions []models.Session
-	for _, session := range settings.Privacy.ActiveSessions {
-		if session.ID != sessionID {
-			updatedSessions = append(updatedSessions, session)
-		}
+	err = h.sessions.Revoke(c.Request.Context(), userIDObj, sessionID, "terminated")
+	if err == utils.ErrSessionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
 	}
-
-	_, err = h.db.MongoDB.Collection("user_settings").UpdateOne(
-		context.Background(),
-		bson.M{"user_id": userIDObj},
-		bson.M{"$set": bson.M{
-			"privacy.active_sessions": updatedSessions,
-			"updated_at":              time.Now(),
-		}},
-	)
-
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to terminate session"})
 		return
 	}
 
+	// Keep the legacy settings list in sync for older clients
+	_, _ = h.db.MongoDB.Collection("user_settings").UpdateOne(
+		context.Background(),
+		bson.M{"user_id": userIDObj},
+		bson.M{"$pull": bson.M{"privacy.active_sessions": bson.M{"id": sessionID.Hex()}}},
+	)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Session terminated"})
 }
 
+// BlockUser blocks a user in both directions: neither can message, call,
+// send proposals to or comment on the products of the other, and the blocked
+// user can no longer find the blocker or see their photo and last seen.
 func (h *SettingsHandler) BlockUser(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userIDObj := userID.(primitive.ObjectID)
@@ -375,43 +546,29 @@ func (h *SettingsHandler) BlockUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
+	if blockedUserID == userIDObj {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot block yourself"})
+		return
+	}
 
-	var settings models.UserSettings
-	err = h.db.MongoDB.Collection("user_settings").FindOne(
+	if err := h.ensureSettings(context.Background(), userIDObj); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+	_, err = h.db.MongoDB.Collection("user_settings").UpdateOne(
 		context.Background(),
 		bson.M{"user_id": userIDObj},
-	).Decode(&settings)
+		bson.M{
+			"$addToSet": bson.M{"privacy.blocked_users": blockedUserID},
+			"$set":      bson.M{"updated_at": time.Now()},
+		},
+	)
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Settings not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
 		return
 	}
-
-	// Add to blocked list if not already blocked
-	alreadyBlocked := false
-	for _, id := range settings.Privacy.BlockedUsers {
-		if id == blockedUserID {
-			alreadyBlocked = true
-			break
-		}
-	}
-
-	if !alreadyBlocked {
-		settings.Privacy.BlockedUsers = append(settings.Privacy.BlockedUsers, blockedUserID)
-		_, err = h.db.MongoDB.Collection("user_settings").UpdateOne(
-			context.Background(),
-			bson.M{"user_id": userIDObj},
-			bson.M{"$set": bson.M{
-				"privacy.blocked_users": settings.Privacy.BlockedUsers,
-				"updated_at":            time.Now(),
-			}},
-		)
-
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
-			return
-		}
-	}
+	h.hub.SetBlocked(userIDObj, blockedUserID, true)
 
 	c.JSON(http.StatusOK, gin.H{"message": "User blocked"})
 }
@@ -460,6 +617,10 @@ func (h *SettingsHandler) UnblockUser(c *gin.Context) {
 		return
 	}
 
+	// The other user may have blocked this one too
+	stillBlocked, err := utils.IsBlocked(c.Request.Context(), h.db, userIDObj, blockedUserID)
+	h.hub.SetBlocked(userIDObj, blockedUserID, stillBlocked || err != nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "User unblocked"})
 }
 
@@ -479,20 +640,12 @@ func (h *SettingsHandler) GetBlockedUsers(c *gin.Context) {
 	}
 
 	// Fetch user details for blocked users
-	var blockedUsers []map[string]interface{}
+	viewer := profileViewer(c, h.db)
+	viewer.Load(c.Request.Context(), settings.Privacy.BlockedUsers...)
+	blockedUsers := []models.PublicProfile{}
 	for _, blockedID := range settings.Privacy.BlockedUsers {
-		var user models.User
-		err := h.db.MongoDB.Collection("users").FindOne(
-			context.Background(),
-			bson.M{"_id": blockedID},
-		).Decode(&user)
-
-		if err == nil {
-			blockedUsers = append(blockedUsers, map[string]interface{}{
-				"id":          user.ID,
-				"username":    user.Username,
-				"phone_number": user.PhoneNumber,
-			})
+		if profile, err := viewer.UserProfile(c.Request.Context(), blockedID); err == nil {
+			blockedUsers = append(blockedUsers, profile)
 		}
 	}
 
@@ -508,6 +661,10 @@ func (h *SettingsHandler) UpdateCallSettings(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !utils.ValidPrivacyRule(callSettings.WhoCanCall) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "who_can_call must be everyone, contacts or nobody"})
+		return
+	}
 
 	_, err := h.db.MongoDB.Collection("user_settings").UpdateOne(
 		context.Background(),
@@ -526,6 +683,38 @@ func (h *SettingsHandler) UpdateCallSettings(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Call settings updated"})
 }
 
+// UpdateDeviceSettings controls new-device login approval and login alerts.
+func (h *SettingsHandler) UpdateDeviceSettings(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var deviceSettings models.DeviceSettings
+	if err := c.ShouldBindJSON(&deviceSettings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.ensureSettings(context.Background(), userIDObj); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device settings"})
+		return
+	}
+	_, err := h.db.MongoDB.Collection("user_settings").UpdateOne(
+		context.Background(),
+		bson.M{"user_id": userIDObj},
+		bson.M{"$set": bson.M{
+			"devices":    deviceSettings,
+			"updated_at": time.Now(),
+		}},
+	)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device settings updated"})
+}
+
 func (h *SettingsHandler) UpdateGroupSettings(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userIDObj := userID.(primitive.ObjectID)
@@ -563,7 +752,32 @@ func (h *SettingsHandler) UpdateAdvancedSettings(c *gin.Context) {
 		return
 	}
 
-	_, err := h.db.MongoDB.Collection("user_settings").UpdateOne(
+	if !utils.ValidSelfDestructTTL(advancedSettings.SelfDestructTTL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("self_destruct_ttl must be 0 or between %d and %d days", utils.MinSelfDestructTTL, utils.MaxSelfDestructTTL)})
+		return
+	}
+
+	if !utils.ValidAutoLogout(advancedSettings.AutoLogout) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("auto_logout must be 0 or between %d and %d minutes", utils.MinAutoLogout, utils.MaxAutoLogout)})
+		return
+	}
+
+	// The self-destruct worker and session validation read these from the user record
+	_, err := h.db.MongoDB.Collection("users").UpdateOne(
+		context.Background(),
+		bson.M{"_id": userIDObj},
+		bson.M{"$set": bson.M{
+			"self_destruct_ttl": advancedSettings.SelfDestructTTL,
+			"auto_logout":       advancedSettings.AutoLogout,
+			"updated_at":        time.Now(),
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update advanced settings"})
+		return
+	}
+
+	_, err = h.db.MongoDB.Collection("user_settings").UpdateOne(
 		context.Background(),
 		bson.M{"user_id": userIDObj},
 		bson.M{"$set": bson.M{
@@ -580,17 +794,41 @@ func (h *SettingsHandler) UpdateAdvancedSettings(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Advanced settings updated"})
 }
 
+// setAccountStatus updates the authoritative status on the user record and
+// mirrors it into the account settings.
+func (h *SettingsHandler) setAccountStatus(ctx context.Context, filter bson.M, userID primitive.ObjectID, update bson.M) (bool, error) {
+	update["updated_at"] = time.Now()
+	result, err := h.db.MongoDB.Collection("users").UpdateOne(ctx, filter, bson.M{"$set": update})
+	if err != nil || result.MatchedCount == 0 {
+		return false, err
+	}
+
+	_, _ = h.db.MongoDB.Collection("user_settings").UpdateOne(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{
+			"account.account_status": update["account_status"],
+			"updated_at":             time.Now(),
+		}},
+	)
+	return true, nil
+}
+
+// SuspendAccount deactivates the account until its owner reactivates it.
+// Suspended accounts are read-only and hidden from search and nearby.
 func (h *SettingsHandler) SuspendAccount(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userIDObj := userID.(primitive.ObjectID)
 
-	_, err := h.db.MongoDB.Collection("user_settings").UpdateOne(
+	_, err := h.setAccountStatus(
 		context.Background(),
-		bson.M{"user_id": userIDObj},
-		bson.M{"$set": bson.M{
-			"account.account_status": "suspended",
-			"updated_at":             time.Now(),
-		}},
+		bson.M{"_id": userIDObj},
+		userIDObj,
+		bson.M{
+			"account_status": "suspended",
+			"suspended_at":   time.Now(),
+			"suspended_by":   "self",
+		},
 	)
 
 	if err != nil {
@@ -601,17 +839,47 @@ func (h *SettingsHandler) SuspendAccount(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Account suspended"})
 }
 
-func (h *SettingsHandler) DeleteAccount(c *gin.Context) {
+// ReactivateAccount lifts a suspension the user placed on their own account.
+func (h *SettingsHandler) ReactivateAccount(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userIDObj := userID.(primitive.ObjectID)
 
-	_, err := h.db.MongoDB.Collection("user_settings").UpdateOne(
+	ok, err := h.setAccountStatus(
 		context.Background(),
-		bson.M{"user_id": userIDObj},
-		bson.M{"$set": bson.M{
-			"account.account_status": "deleted",
-			"updated_at":             time.Now(),
-		}},
+		bson.M{"_id": userIDObj, "account_status": "suspended", "suspended_by": "self"},
+		userIDObj,
+		bson.M{"account_status": "active"},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reactivate account"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is not self-suspended"})
+		return
+	}
+
+	_, _ = h.db.MongoDB.Collection("users").UpdateOne(
+		context.Background(),
+		bson.M{"_id": userIDObj},
+		bson.M{"$unset": bson.M{"suspended_at": "", "suspended_by": ""}},
+	)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account reactivated"})
+}
+
+// DeleteAccount marks the account deleted, which locks it out immediately,
+// and then removes all of its data.
+func (h *SettingsHandler) DeleteAccount(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	ctx := context.Background()
+	_, err := h.setAccountStatus(
+		ctx,
+		bson.M{"_id": userIDObj},
+		userIDObj,
+		bson.M{"account_status": "deleted"},
 	)
 
 	if err != nil {
@@ -619,6 +887,13 @@ func (h *SettingsHandler) DeleteAccount(c *gin.Context) {
 		return
 	}
 
+	_ = h.sessions.RevokeAll(ctx, userIDObj, primitive.NilObjectID, "account_deleted")
+
+	if err := utils.DeleteAccountData(ctx, h.db, userIDObj); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Account locked but data removal failed; it will be retried in the background"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
 }
 
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	totpIssuer        = "ChatApp"
+	recoveryCodeCount = 10
+)
+
+type TOTPCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+type VerifyTOTPRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code,omitempty"`
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code. TOTP codes cannot be replayed and recovery codes are consumed.
+func (h *AuthHandler) checkSecondFactor(ctx context.Context, user models.User, code, recoveryCode string) bool {
+	users := h.db.MongoDB.Collection("users")
+
+	if recoveryCode != "" {
+		hash := utils.HashToken(utils.NormalizeRecoveryCode(recoveryCode))
+		result, err := users.UpdateOne(
+			ctx,
+			bson.M{"_id": user.ID, "recovery_code_hashes": hash},
+			bson.M{"$pull": bson.M{"recovery_code_hashes": hash}},
+		)
+		return err == nil && result.ModifiedCount == 1
+	}
+
+	if user.TOTPSecret == "" {
+		return false
+	}
+	step, ok := utils.ValidateTOTPAfter(user.TOTPSecret, code, user.TOTPLastStep, time.Now())
+	if !ok {
+		return false
+	}
+	// The step is claimed atomically so concurrent requests cannot both
+	// use the same code
+	result, err := users.UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID, "$or": []bson.M{
+			{"totp_last_step": bson.M{"$lt": step}},
+			{"totp_last_step": bson.M{"$exists": false}},
+		}},
+		bson.M{"$set": bson.M{"totp_last_step": step}},
+	)
+	return err == nil && result.ModifiedCount == 1
+}
+
+// checkSessionSecondFactor is checkSecondFactor for requests from a logged-in
+// session. Login challenges limit their own attempts; here wrong codes count
+// toward the account's verification lockout so a session cannot guess codes.
+func (h *AuthHandler) checkSessionSecondFactor(c *gin.Context, user models.User, code, recoveryCode string) bool {
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+	if err := h.guard.CheckVerify(ctx, user.PhoneNumber, ip); err != nil {
+		respondVerificationError(c, err)
+		return false
+	}
+	if !h.checkSecondFactor(ctx, user, code, recoveryCode) {
+		h.guard.RecordFailure(ctx, user.PhoneNumber, ip, "wrong_totp")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return false
+	}
+	h.guard.RecordSuccess(ctx, user.PhoneNumber)
+	return true
+}
+
+// newRecoveryCodes generates a fresh set of recovery codes and their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, utils.HashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// SetupTOTP starts (re-)enrollment: it creates a pending secret and returns
+// it with an otpauth:// URI and QR code. Re-enrolling requires a current code.
+func (h *AuthHandler) SetupTOTP(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req TOTPCodeRequest
+	_ = c.ShouldBindJSON(&req)
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.TOTPEnabled && !h.checkSessionSecondFactor(c, user, req.Code, req.RecoveryCode) {
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	account := user.Username
+	if account == "" {
+		account = user.PhoneNumber
+	}
+	uri := utils.TOTPURI(totpIssuer, account, secret)
+	qr, err := utils.GenerateQRImage(uri)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate QR code"})
+		return
+	}
+
+	_, err = h.db.MongoDB.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": userIDObj},
+		bson.M{"$set": bson.M{
+			"totp_pending_secret": secret,
+			"updated_at":          time.Now(),
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_url": uri,
+		"qr":          qr,
+	})
+}
+
+// ConfirmTOTP activates the pending secret once the user proves their
+// authenticator produces valid codes. Recovery codes are returned only here.
+func (h *AuthHandler) ConfirmTOTP(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.TOTPPendingSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No enrollment in progress"})
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(user.TOTPPendingSecret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	_, err = h.db.MongoDB.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": userIDObj},
+		bson.M{
+			"$set": bson.M{
+				"totp_enabled":         true,
+				"totp_secret":          user.TOTPPendingSecret,
+				"totp_last_step":       step,
+				"recovery_code_hashes": hashes,
+				"updated_at":           time.Now(),
+			},
+			"$unset": bson.M{"totp_pending_secret": ""},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable authenticator"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Authenticator enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP removes the authenticator after a valid code or recovery code.
+func (h *AuthHandler) DisableTOTP(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Authenticator is not enabled"})
+		return
+	}
+
+	if !h.checkSessionSecondFactor(c, user, req.Code, req.RecoveryCode) {
+		return
+	}
+
+	_, err := h.db.MongoDB.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": userIDObj},
+		bson.M{
+			"$set": bson.M{
+				"totp_enabled": false,
+				"updated_at":   time.Now(),
+			},
+			"$unset": bson.M{
+				"totp_secret":          "",
+				"totp_pending_secret":  "",
+				"totp_last_step":       "",
+				"recovery_code_hashes": "",
+			},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable authenticator"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Authenticator disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after a valid TOTP code.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userIDObj}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	if !h.checkSessionSecondFactor(c, user, req.Code, "") {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	_, err = h.db.MongoDB.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": userIDObj},
+		bson.M{"$set": bson.M{
+			"recovery_code_hashes": hashes,
+			"updated_at":           time.Now(),
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// VerifyTOTP completes the authenticator step of a login challenge.
+func (h *AuthHandler) VerifyTOTP(c *gin.Context) {
+	var req VerifyTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+
+	h.advanceChallenge(c, req.ChallengeToken, "totp", func(user models.User) bool {
+		return h.checkSecondFactor(c.Request.Context(), user, req.Code, req.RecoveryCode)
+	})
+}
@@ -52,10 +52,17 @@ func (h *UserHandler) SearchByUsername(c *gin.Context) {
 		return
 	}
 
+	// Usernames are case-insensitive
+	claim, err := utils.LookupUsername(context.Background(), h.db, username)
+	if err != nil || claim.OwnerType != "user" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
 	var user models.User
-	err := h.db.MongoDB.Collection("users").FindOne(
+	err = h.db.MongoDB.Collection("users").FindOne(
 		context.Background(),
-		bson.M{"username": username},
+		bson.M{"_id": claim.OwnerID, "account_status": bson.M{"$nin": hiddenAccountStatuses}},
 	).Decode(&user)
 
 	if err != nil {
@@ -63,12 +70,23 @@ func (h *UserHandler) SearchByUsername(c *gin.Context) {
 		return
 	}
 
-	// Hide phone number if user wants it hidden
-	if user.HidePhoneNumber {
-		user.PhoneNumber = ""
+	viewer := profileViewer(c, h.db)
+	if !viewer.CanFindByUsername(c.Request.Context(), user.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, viewer.Profile(c.Request.Context(), &user))
+}
+
+// profileViewer projects other users for the caller, who may be anonymous
+// on public routes.
+func profileViewer(c *gin.Context, db *database.Database) *utils.ProfileViewer {
+	var viewerID primitive.ObjectID
+	if userID, ok := c.Get("user_id"); ok {
+		viewerID = userID.(primitive.ObjectID)
+	}
+	return utils.NewProfileViewer(db, viewerID)
 }
 
 func (h *UserHandler) GetDevices(c *gin.Context) {
@@ -86,7 +104,49 @@ func (h *UserHandler) GetDevices(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, user.ActiveDevices)
+	// Mark the device of the requesting session
+	var current models.AuthSession
+	sessionID, _ := c.Get("session_id")
+	_ = h.db.MongoDB.Collection("sessions").FindOne(context.Background(), bson.M{"_id": sessionID}).Decode(&current)
+
+	devices := make([]models.DeviceInfo, 0, len(user.ActiveDevices))
+	for _, device := range user.ActiveDevices {
+		device.IsCurrent = current.DeviceID != "" && device.DeviceID == current.DeviceID
+		devices = append(devices, device)
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+// hiddenAccountStatuses are excluded from search and nearby results.
+var hiddenAccountStatuses = []string{"suspended", "deleted"}
+
+// editableUserFields are the profile fields UpdateMe may change, with the
+// JSON type each takes. Everything else has a dedicated endpoint or is
+// maintained by the server.
+var editableUserFields = map[string]string{
+	"first_name":        "string",
+	"last_name":         "string",
+	"avatar":            "string",
+	"bio":               "string",
+	"company_name":      "string",
+	"company_category":  "string",
+	"is_anonymous":      "bool",
+	"hide_phone_number": "bool",
+}
+
+// validUserField reports whether the field may be set to value here.
+func validUserField(field string, value interface{}) bool {
+	switch editableUserFields[field] {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	default:
+		return false
+	}
 }
 
 func (h *UserHandler) UpdateMe(c *gin.Context) {
@@ -99,6 +159,13 @@ func (h *UserHandler) UpdateMe(c *gin.Context) {
 		return
 	}
 
+	for field := range updateData {
+		if !validUserField(field, updateData[field]) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Field cannot be updated here: " + field})
+			return
+		}
+	}
+
 	updateData["updated_at"] = time.Now()
 	_, err := h.db.MongoDB.Collection("users").UpdateOne(
 		context.Background(),
@@ -114,6 +181,33 @@ func (h *UserHandler) UpdateMe(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 }
 
+// UpdateUsername sets, changes or removes the current user's username.
+func (h *UserHandler) UpdateUsername(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userIDObj := userID.(primitive.ObjectID)
+
+	var req UpdateUsernameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	username, err := utils.ChangeUsername(ctx, h.db, "user", userIDObj, req.Username)
+	if err != nil {
+		respondUsernameError(c, err)
+		return
+	}
+
+	_, _ = h.db.MongoDB.Collection("user_settings").UpdateOne(
+		ctx,
+		bson.M{"user_id": userIDObj},
+		bson.M{"$set": bson.M{"account.username": username}},
+	)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Username updated", "username": username})
+}
+
 type LocationUpdate struct {
 	Latitude  float64 `json:"latitude" binding:"required"`
 	Longitude float64 `json:"longitude" binding:"required"`
@@ -181,6 +275,7 @@ func (h *UserHandler) GetNearbyUsers(c *gin.Context) {
 		bson.M{
 			"_id": bson.M{"$ne": userIDObj},
 			"location": bson.M{"$exists": true},
+			"account_status": bson.M{"$nin": hiddenAccountStatuses},
 		},
 	)
 
@@ -190,7 +285,14 @@ func (h *UserHandler) GetNearbyUsers(c *gin.Context) {
 	}
 	defer cursor.Close(context.Background())
 
-	var nearbyUsers []models.User
+	type NearbyUser struct {
+		models.PublicProfile
+		Distance float64 `json:"distance"` // km
+	}
+
+	// Users in range, with their distances
+	var candidates []models.User
+	var distances []float64
 	for cursor.Next(context.Background()) {
 		var u models.User
 		if err := cursor.Decode(&u); err != nil {
@@ -203,8 +305,28 @@ func (h *UserHandler) GetNearbyUsers(c *gin.Context) {
 		)
 
 		if distance <= radius {
-			nearbyUsers = append(nearbyUsers, u)
+			candidates = append(candidates, u)
+			distances = append(distances, distance)
+		}
+	}
+
+	// Blocks hide users in both directions
+	viewer := profileViewer(c, h.db)
+	ids := make([]primitive.ObjectID, len(candidates))
+	for i := range candidates {
+		ids[i] = candidates[i].ID
+	}
+	viewer.Load(c.Request.Context(), ids...)
+
+	nearbyUsers := []NearbyUser{}
+	for i := range candidates {
+		if viewer.Blocked(c.Request.Context(), candidates[i].ID) {
+			continue
 		}
+		nearbyUsers = append(nearbyUsers, NearbyUser{
+			PublicProfile: viewer.Profile(c.Request.Context(), &candidates[i]),
+			Distance:      distances[i],
+		})
 	}
 
 	c.JSON(http.StatusOK, nearbyUsers)
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type UsernameHandler struct {
+	db *database.Database
+}
+
+func NewUsernameHandler(db *database.Database) *UsernameHandler {
+	return &UsernameHandler{db: db}
+}
+
+type UpdateUsernameRequest struct {
+	Username string `json:"username"` // empty removes the username
+}
+
+// respondUsernameError writes the response for a failed username claim or
+// change.
+func respondUsernameError(c *gin.Context, err error) {
+	var cooldown *utils.UsernameCooldownError
+	switch {
+	case errors.As(err, &cooldown):
+		retryAfter := int(cooldown.RetryAfter.Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Username was changed recently, try again later",
+			"retry_after": retryAfter,
+		})
+	case errors.Is(err, utils.ErrUsernameInvalid), errors.Is(err, utils.ErrUsernameBotName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, utils.ErrUsernameReserved), errors.Is(err, utils.ErrUsernameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update username"})
+	}
+}
+
+// changeChatUsername sets the public username of a group or channel, which
+// takes the change_info admin permission.
+func changeChatUsername(c *gin.Context, db *database.Database, chatType, param string) {
+	chatID, err := primitive.ObjectIDFromHex(c.Param(param))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + chatType + " ID"})
+		return
+	}
+
+	var req UpdateUsernameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var chat models.Chat
+	if err := db.MongoDB.Collection("chats").FindOne(ctx, bson.M{"_id": chatID, "type": chatType}).Decode(&chat); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+		return
+	}
+
+	if !requireAdminPermission(c, &chat, models.PermChangeInfo) {
+		return
+	}
+
+	username, err := utils.ChangeUsername(ctx, db, chatType, chatID, req.Username)
+	if err != nil {
+		respondUsernameError(c, err)
+		return
+	}
+	userID, _ := c.Get("user_id")
+	utils.LogChatEvent(ctx, db, models.ChatEvent{
+		ChatID:   chatID,
+		ActorID:  userID.(primitive.ObjectID),
+		Action:   models.EventUsernameChanged,
+		OldValue: utils.NormalizeUsername(chat.PublicLink),
+		NewValue: username,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Public link updated", "username": username})
+}
+
+// Resolve tells which user, group, channel or bot a public username belongs
+// to, so clients can open deep links.
+func (h *UsernameHandler) Resolve(c *gin.Context) {
+	ctx := c.Request.Context()
+	notFound := gin.H{"error": "Username not found"}
+
+	claim, err := utils.LookupUsername(ctx, h.db, c.Param("username"))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, notFound)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve username"})
+		return
+	}
+
+	// The owner's record is authoritative; a claim it no longer matches is stale
+	switch claim.OwnerType {
+	case "user":
+		var user models.User
+		err := h.db.MongoDB.Collection("users").FindOne(ctx, bson.M{
+			"_id":            claim.OwnerID,
+			"account_status": bson.M{"$nin": hiddenAccountStatuses},
+		}).Decode(&user)
+		if err != nil || !strings.EqualFold(user.Username, claim.Name) {
+			c.JSON(http.StatusNotFound, notFound)
+			return
+		}
+		viewer := profileViewer(c, h.db)
+		if !viewer.CanFindByUsername(ctx, user.ID) {
+			c.JSON(http.StatusNotFound, notFound)
+			return
+		}
+		profile := viewer.Profile(ctx, &user)
+		c.JSON(http.StatusOK, gin.H{
+			"type":       "user",
+			"id":         profile.ID,
+			"username":   profile.Username,
+			"first_name": profile.FirstName,
+			"last_name":  profile.LastName,
+			"avatar":     profile.Avatar,
+			"is_premium": profile.IsPremium,
+		})
+
+	case "group", "channel":
+		var chat models.Chat
+		err := h.db.MongoDB.Collection("chats").FindOne(ctx, bson.M{"_id": claim.OwnerID, "type": claim.OwnerType}).Decode(&chat)
+		if err != nil || !strings.EqualFold(utils.NormalizeUsername(chat.PublicLink), claim.Name) {
+			c.JSON(http.StatusNotFound, notFound)
+			return
+		}
+		response := gin.H{
+			"type":        chat.Type,
+			"id":          chat.ID,
+			"username":    utils.NormalizeUsername(chat.PublicLink),
+			"title":       chat.GroupName,
+			"description": chat.Description,
+			"icon":        chat.GroupIcon,
+		}
+		if chat.Type == "channel" {
+			response["subscriber_count"] = chat.SubscriberCount
+		} else {
+			response["member_count"] = len(chat.Members)
+		}
+		c.JSON(http.StatusOK, response)
+
+	case "bot":
+		var bot models.Bot
+		err := h.db.MongoDB.Collection("bots").FindOne(ctx, bson.M{"_id": claim.OwnerID}).Decode(&bot)
+		if err != nil || !strings.EqualFold(bot.Username, claim.Name) {
+			c.JSON(http.StatusNotFound, notFound)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"type":        "bot",
+			"id":          bot.ID,
+			"username":    bot.Username,
+			"name":        bot.Name,
+			"description": bot.Description,
+			"avatar":      bot.Avatar,
+		})
+
+	default:
+		c.JSON(http.StatusNotFound, notFound)
+	}
+}
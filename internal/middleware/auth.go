@@ -4,12 +4,21 @@ import (
 	"net/http"
 	"strings"
 
+	"chat-backend/internal/database"
 	"chat-backend/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// suspendedAllowedRoutes may be called by suspended accounts in addition to
+// GET requests, so they can reactivate or sign out.
+var suspendedAllowedRoutes = map[string]bool{
+	"/api/v1/auth/logout":                     true,
+	"/api/v1/settings/account/reactivate":     true,
+	"/api/v1/settings/delete":                 true,
+}
+
+func AuthMiddleware(db *database.Database, sessions *utils.SessionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -32,7 +41,38 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Tokens are only valid while their session is; terminated sessions are rejected here.
+		session, err := sessions.Validate(c.Request.Context(), claims)
+		if err == utils.ErrSessionIdle {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session ended after inactivity", "reason": "auto_logout"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired or terminated"})
+			c.Abort()
+			return
+		}
+
+		// Account status lives on the user record
+		status, err := utils.AccountStatus(c.Request.Context(), db, claims.UserID)
+		if err != nil || status == "deleted" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account not found or deleted"})
+			c.Abort()
+			return
+		}
+		if status == "suspended" && c.Request.Method != http.MethodGet && !suspendedAllowedRoutes[c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is suspended", "account_status": status})
+			c.Abort()
+			return
+		}
+
+		// API use keeps the session, device and account active
+		_ = sessions.Touch(c.Request.Context(), session)
+
 		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("account_status", status)
 		c.Next()
 	}
 }
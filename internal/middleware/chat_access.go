@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ChatMember only lets members of the chat named by the route parameter
+// through. The chat is stored in the context as "chat".
+func ChatMember(db *database.Database, param string) gin.HandlerFunc {
+	return chatAccess(db, param, utils.ChatForMember)
+}
+
+// ChatReader is ChatMember for read-only routes, which also admits anyone to
+// public channels.
+func ChatReader(db *database.Database, param string) gin.HandlerFunc {
+	return chatAccess(db, param, utils.ChatForReader)
+}
+
+type chatLoader func(ctx context.Context, db *database.Database, chatID, userID primitive.ObjectID) (*models.Chat, error)
+
+func chatAccess(db *database.Database, param string, load chatLoader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID, err := primitive.ObjectIDFromHex(c.Param(param))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+			return
+		}
+		userID := c.MustGet("user_id").(primitive.ObjectID)
+
+		chat, err := load(c.Request.Context(), db, chatID, userID)
+		if !abortChatAccess(c, err) {
+			c.Set("chat", *chat)
+			c.Next()
+		}
+	}
+}
+
+// MessageChatMember resolves the chat through the :message_id route
+// parameter and only lets its members through. The message and chat are
+// stored in the context as "message" and "chat".
+func MessageChatMember(db *database.Database) gin.HandlerFunc {
+	return messageChatAccess(db, utils.ChatForMember)
+}
+
+// MessageChatReader is MessageChatMember for read-only routes.
+func MessageChatReader(db *database.Database) gin.HandlerFunc {
+	return messageChatAccess(db, utils.ChatForReader)
+}
+
+func messageChatAccess(db *database.Database, load chatLoader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		messageID, err := primitive.ObjectIDFromHex(c.Param("message_id"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+			return
+		}
+		userID := c.MustGet("user_id").(primitive.ObjectID)
+
+		var message models.Message
+		err = db.MongoDB.Collection("messages").FindOne(c.Request.Context(), bson.M{"_id": messageID}).Decode(&message)
+		if err == mongo.ErrNoDocuments {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to load message"})
+			return
+		}
+
+		chat, err := load(c.Request.Context(), db, message.ChatID, userID)
+		if !abortChatAccess(c, err) {
+			c.Set("message", message)
+			c.Set("chat", *chat)
+			c.Next()
+		}
+	}
+}
+
+// abortChatAccess aborts the request if loading the chat failed and reports
+// whether it did.
+func abortChatAccess(c *gin.Context, err error) bool {
+	switch err {
+	case nil:
+		return false
+	case mongo.ErrNoDocuments:
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+	case utils.ErrNotChatMember:
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not a member of this chat"})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to load chat"})
+	}
+	return true
+}
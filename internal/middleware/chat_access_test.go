@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chat-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// serveChatAccess runs a request through the middleware as the user and
+// returns the response status.
+func serveChatAccess(db *database.Database, userID primitive.ObjectID, route, path string, access gin.HandlerFunc) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET(route, func(c *gin.Context) {
+		c.Set("user_id", userID)
+	}, access, func(c *gin.Context) {
+		if _, ok := c.Get("chat"); !ok {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w.Code
+}
+
+func chatDoc(chatID primitive.ObjectID, chatType, publicLink string, members ...primitive.ObjectID) bson.D {
+	doc := bson.D{
+		{Key: "_id", Value: chatID},
+		{Key: "type", Value: chatType},
+		{Key: "members", Value: members},
+	}
+	if publicLink != "" {
+		doc = append(doc, bson.E{Key: "public_link", Value: publicLink})
+	}
+	return doc
+}
+
+func TestChatMember(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+	otherID := primitive.NewObjectID()
+	chatID := primitive.NewObjectID()
+	path := "/chats/" + chatID.Hex()
+
+	mt.Run("member", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch, chatDoc(chatID, "group", "", userID, otherID)))
+		db := &database.Database{MongoDB: mt.DB}
+		if code := serveChatAccess(db, userID, "/chats/:chat_id", path, ChatMember(db, "chat_id")); code != http.StatusOK {
+			t.Fatalf("got %d, want %d", code, http.StatusOK)
+		}
+	})
+
+	mt.Run("not a member", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch, chatDoc(chatID, "group", "", otherID)))
+		db := &database.Database{MongoDB: mt.DB}
+		if code := serveChatAccess(db, userID, "/chats/:chat_id", path, ChatMember(db, "chat_id")); code != http.StatusForbidden {
+			t.Fatalf("got %d, want %d", code, http.StatusForbidden)
+		}
+	})
+
+	mt.Run("public channel", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch, chatDoc(chatID, "channel", "news", otherID)))
+		db := &database.Database{MongoDB: mt.DB}
+		if code := serveChatAccess(db, userID, "/chats/:chat_id", path, ChatMember(db, "chat_id")); code != http.StatusForbidden {
+			t.Fatalf("got %d, want %d", code, http.StatusForbidden)
+		}
+	})
+
+	mt.Run("missing chat", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch))
+		db := &database.Database{MongoDB: mt.DB}
+		if code := serveChatAccess(db, userID, "/chats/:chat_id", path, ChatMember(db, "chat_id")); code != http.StatusNotFound {
+			t.Fatalf("got %d, want %d", code, http.StatusNotFound)
+		}
+	})
+
+	mt.Run("invalid ID", func(mt *mtest.T) {
+		db := &database.Database{MongoDB: mt.DB}
+		if code := serveChatAccess(db, userID, "/chats/:chat_id", "/chats/nope", ChatMember(db, "chat_id")); code != http.StatusBadRequest {
+			t.Fatalf("got %d, want %d", code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestChatReader(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+	otherID := primitive.NewObjectID()
+	chatID := primitive.NewObjectID()
+	path := "/chats/" + chatID.Hex()
+
+	mt.Run("public channel", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch, chatDoc(chatID, "channel", "news", otherID)),
+			mtest.CreateCursorResponse(0, "test.chat_restrictions", mtest.FirstBatch),
+		)
+		db := &database.Database{MongoDB: mt.DB}
+		if code := serveChatAccess(db, userID, "/chats/:chat_id", path, ChatReader(db, "chat_id")); code != http.StatusOK {
+			t.Fatalf("got %d, want %d", code, http.StatusOK)
+		}
+	})
+
+	mt.Run("banned from public channel", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch, chatDoc(chatID, "channel", "news", otherID)),
+			mtest.CreateCursorResponse(0, "test.chat_restrictions", mtest.FirstBatch, bson.D{
+				{Key: "chat_id", Value: chatID},
+				{Key: "user_id", Value: userID},
+				{Key: "kind", Value: "ban"},
+			}),
+		)
+		db := &database.Database{MongoDB: mt.DB}
+		if code := serveChatAccess(db, userID, "/chats/:chat_id", path, ChatReader(db, "chat_id")); code != http.StatusForbidden {
+			t.Fatalf("got %d, want %d", code, http.StatusForbidden)
+		}
+	})
+
+	mt.Run("private channel", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch, chatDoc(chatID, "channel", "", otherID)))
+		db := &database.Database{MongoDB: mt.DB}
+		if code := serveChatAccess(db, userID, "/chats/:chat_id", path, ChatReader(db, "chat_id")); code != http.StatusForbidden {
+			t.Fatalf("got %d, want %d", code, http.StatusForbidden)
+		}
+	})
+}
+
+func TestMessageChatMember(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+	otherID := primitive.NewObjectID()
+	chatID := primitive.NewObjectID()
+	messageID := primitive.NewObjectID()
+	path := "/messages/" + messageID.Hex()
+	message := bson.D{{Key: "_id", Value: messageID}, {Key: "chat_id", Value: chatID}}
+
+	mt.Run("member", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.messages", mtest.FirstBatch, message),
+			mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch, chatDoc(chatID, "direct", "", userID, otherID)),
+		)
+		db := &database.Database{MongoDB: mt.DB}
+		if code := serveChatAccess(db, userID, "/messages/:message_id", path, MessageChatMember(db)); code != http.StatusOK {
+			t.Fatalf("got %d, want %d", code, http.StatusOK)
+		}
+	})
+
+	mt.Run("not a member", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.messages", mtest.FirstBatch, message),
+			mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch, chatDoc(chatID, "direct", "", otherID, primitive.NewObjectID())),
+		)
+		db := &database.Database{MongoDB: mt.DB}
+		if code := serveChatAccess(db, userID, "/messages/:message_id", path, MessageChatMember(db)); code != http.StatusForbidden {
+			t.Fatalf("got %d, want %d", code, http.StatusForbidden)
+		}
+	})
+
+	mt.Run("missing message", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.messages", mtest.FirstBatch))
+		db := &database.Database{MongoDB: mt.DB}
+		if code := serveChatAccess(db, userID, "/messages/:message_id", path, MessageChatMember(db)); code != http.StatusNotFound {
+			t.Fatalf("got %d, want %d", code, http.StatusNotFound)
+		}
+	})
+}
@@ -9,7 +9,8 @@ import (
 type Bot struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	OwnerID     primitive.ObjectID `json:"owner_id" bson:"owner_id"`
-	Username    string            `json:"username" bson:"username"` // @botname
+	Username    string            `json:"username" bson:"username"` // @botname, shared namespace with users and chats
+	UsernameChangedAt *time.Time  `json:"-" bson:"username_changed_at,omitempty"`
 	Token       string            `json:"token" bson:"token"` // API token
 	Name        string            `json:"name" bson:"name"`
 	Description string            `json:"description" bson:"description"`
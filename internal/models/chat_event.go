@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actions recorded in a group's or channel's event log.
+const (
+	EventTitleChanged         = "title_changed"
+	EventPhotoChanged         = "photo_changed"
+	EventDescriptionChanged   = "description_changed"
+	EventUsernameChanged      = "username_changed"
+	EventSettingsChanged      = "settings_changed"
+	EventRestrictionsChanged  = "restrictions_changed"
+	EventMemberAdded          = "member_added"
+	EventMemberJoined         = "member_joined"
+	EventMemberLeft           = "member_left"
+	EventMemberKicked         = "member_kicked"
+	EventMemberBanned         = "member_banned"
+	EventMemberUnbanned       = "member_unbanned"
+	EventMemberMuted          = "member_muted"
+	EventMemberRestricted     = "member_restricted"
+	EventMemberUnrestricted   = "member_unrestricted"
+	EventAdminPromoted        = "admin_promoted"
+	EventAdminDemoted         = "admin_demoted"
+	EventOwnershipTransferred = "ownership_transferred"
+	EventInviteLinkCreated    = "invite_link_created"
+	EventInviteLinkRevoked    = "invite_link_revoked"
+	EventJoinRequestApproved  = "join_request_approved"
+	EventJoinRequestDeclined  = "join_request_declined"
+	EventMessageDeleted       = "message_deleted"
+	EventMessagePinned        = "message_pinned"
+	EventMessageUnpinned      = "message_unpinned"
+)
+
+// ChatEvent is one entry of a group's or channel's append-only log of admin
+// and membership actions, kept until ExpiresAt.
+type ChatEvent struct {
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ChatID       primitive.ObjectID  `json:"chat_id" bson:"chat_id"`
+	ActorID      primitive.ObjectID  `json:"actor_id" bson:"actor_id"`
+	Action       string              `json:"action" bson:"action"`
+	TargetUserID *primitive.ObjectID `json:"target_user_id,omitempty" bson:"target_user_id,omitempty"`
+	MessageID    *primitive.ObjectID `json:"message_id,omitempty" bson:"message_id,omitempty"`
+	Message      *Message            `json:"message,omitempty" bson:"message,omitempty"` // snapshot of deleted messages
+	OldValue     interface{}         `json:"old_value,omitempty" bson:"old_value,omitempty"`
+	NewValue     interface{}         `json:"new_value,omitempty" bson:"new_value,omitempty"`
+	CreatedAt    time.Time           `json:"created_at" bson:"created_at"`
+	ExpiresAt    time.Time           `json:"-" bson:"expires_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InviteLink lets people join a group or channel through its code. Links can
+// expire, admit a limited number of members, or queue joins for approval.
+type InviteLink struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ChatID           primitive.ObjectID `json:"chat_id" bson:"chat_id"`
+	Code             string             `json:"code" bson:"code"`
+	Name             string             `json:"name,omitempty" bson:"name,omitempty"`
+	CreatorID        primitive.ObjectID `json:"creator_id" bson:"creator_id"`
+	ExpiresAt        *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	MemberLimit      int                `json:"member_limit,omitempty" bson:"member_limit"` // 0 = unlimited
+	UsageCount       int                `json:"usage_count" bson:"usage_count"`
+	RequiresApproval bool               `json:"requires_approval" bson:"requires_approval"`
+	Revoked          bool               `json:"revoked" bson:"revoked"`
+	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// JoinRequest is a join through an invite link that awaits an admin.
+type JoinRequest struct {
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ChatID       primitive.ObjectID  `json:"chat_id" bson:"chat_id"`
+	UserID       primitive.ObjectID  `json:"user_id" bson:"user_id"`
+	InviteLinkID primitive.ObjectID  `json:"invite_link_id" bson:"invite_link_id"`
+	Status       string              `json:"status" bson:"status"` // pending, approved, declined
+	DecidedBy    *primitive.ObjectID `json:"decided_by,omitempty" bson:"decided_by,omitempty"`
+	DecidedAt    *time.Time          `json:"decided_at,omitempty" bson:"decided_at,omitempty"`
+	CreatedAt    time.Time           `json:"created_at" bson:"created_at"`
+}
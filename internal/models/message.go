@@ -11,7 +11,7 @@ type Message struct {
 	ChatID      primitive.ObjectID `json:"chat_id" bson:"chat_id"`
 	SenderID    primitive.ObjectID `json:"sender_id" bson:"sender_id"`
 	Content     string            `json:"content" bson:"content"`
-	MessageType string            `json:"message_type" bson:"message_type"` // text, image, audio, video, voice_message, video_message, file, location, contact, poll, sticker, gif, music
+	MessageType string            `json:"message_type" bson:"message_type"` // text, image, audio, video, voice_message, video_message, file, location, contact, poll, sticker, gif, music, invite
 	FileURL     string            `json:"file_url,omitempty" bson:"file_url,omitempty"`
 	ThumbnailURL string           `json:"thumbnail_url,omitempty" bson:"thumbnail_url,omitempty"`
 	FileName    string            `json:"file_name,omitempty" bson:"file_name,omitempty"`
@@ -33,6 +33,7 @@ type Message struct {
 	ReplyToID   *primitive.ObjectID `json:"reply_to_id,omitempty" bson:"reply_to_id,omitempty"`
 	ForwardedFrom *primitive.ObjectID `json:"forwarded_from,omitempty" bson:"forwarded_from,omitempty"`
 	ForwardedFromChat *primitive.ObjectID `json:"forwarded_from_chat,omitempty" bson:"forwarded_from_chat,omitempty"`
+	ForwardedFromName string `json:"forwarded_from_name,omitempty" bson:"forwarded_from_name,omitempty"` // when the sender hides forward attribution
 	
 	// Reactions
 	Reactions   []Reaction        `json:"reactions,omitempty" bson:"reactions,omitempty"`
@@ -44,6 +45,7 @@ type Message struct {
 	Location    *MessageLocation         `json:"location,omitempty" bson:"location,omitempty"`
 	Contact     *ContactInfo     `json:"contact,omitempty" bson:"contact,omitempty"`
 	Poll        *Poll            `json:"poll,omitempty" bson:"poll,omitempty"`
+	Invite      *ChatInvite      `json:"invite,omitempty" bson:"invite,omitempty"`
 	
 	// Privacy
 	IsAnonymous bool             `json:"is_anonymous" bson:"is_anonymous"`
@@ -121,6 +123,14 @@ type ContactInfo struct {
 	UserID      *primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
 }
 
+// ChatInvite is the group or channel an invite message links to.
+type ChatInvite struct {
+	ChatID primitive.ObjectID `json:"chat_id" bson:"chat_id"`
+	Type   string             `json:"type" bson:"type"`
+	Title  string             `json:"title" bson:"title"`
+	Code   string             `json:"code" bson:"code"` // single-use invite link
+}
+
 type Poll struct {
 	Question    string   `json:"question" bson:"question"`
 	Options     []PollOption `json:"options" bson:"options"`
@@ -151,7 +161,8 @@ type Chat struct {
 	GroupName string              `json:"group_name,omitempty" bson:"group_name,omitempty"`
 	GroupIcon string              `json:"group_icon,omitempty" bson:"group_icon,omitempty"`
 	Description string            `json:"description,omitempty" bson:"description,omitempty"`
-	PublicLink string             `json:"public_link,omitempty" bson:"public_link,omitempty"` // t.me/username
+	PublicLink string             `json:"public_link,omitempty" bson:"public_link,omitempty"` // public username, shared namespace with users and bots
+	UsernameChangedAt *time.Time  `json:"-" bson:"username_changed_at,omitempty"`
 	InviteLink string             `json:"invite_link,omitempty" bson:"invite_link,omitempty"`
 	MaxMembers int                `json:"max_members,omitempty" bson:"max_members,omitempty"` // 200000 for groups
 	PinnedMessages []primitive.ObjectID `json:"pinned_messages,omitempty" bson:"pinned_messages,omitempty"`
@@ -183,18 +194,60 @@ type Chat struct {
 type AdminRole struct {
 	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
 	Role      string            `json:"role" bson:"role"` // owner, admin, moderator
-	Permissions []string        `json:"permissions" bson:"permissions"` // delete, ban, pin, invite, etc.
+	Permissions []AdminPermission `json:"permissions" bson:"permissions"`
+	Title     string            `json:"title,omitempty" bson:"title,omitempty"` // custom admin title
 	GrantedAt time.Time         `json:"granted_at" bson:"granted_at"`
 	GrantedBy primitive.ObjectID `json:"granted_by" bson:"granted_by"`
 }
 
+// AdminPermission is an action a group or channel admin may be allowed.
+// Owners hold every permission.
+type AdminPermission string
+
+const (
+	PermChangeInfo     AdminPermission = "change_info"
+	PermDeleteMessages AdminPermission = "delete_messages"
+	PermBanUsers       AdminPermission = "ban_users"
+	PermInviteUsers    AdminPermission = "invite_users"
+	PermPinMessages    AdminPermission = "pin_messages"
+	PermManageCalls    AdminPermission = "manage_calls"
+	PermAddAdmins      AdminPermission = "add_admins"
+	PermPostMessages   AdminPermission = "post_messages" // channels
+	PermEditMessages   AdminPermission = "edit_messages" // channels, others' posts
+	PermAll            AdminPermission = "all"            // legacy owner grant
+)
+
+// GroupRestrictions are what members of a group may do, see
+// utils.EffectiveGroupRestrictions for groups that never configured them.
 type GroupRestrictions struct {
-	CanSendMessages bool `json:"can_send_messages" bson:"can_send_messages"`
-	CanSendMedia    bool `json:"can_send_media" bson:"can_send_media"`
-	CanSendLinks    bool `json:"can_send_links" bson:"can_send_links"`
-	CanSendPolls    bool `json:"can_send_polls" bson:"can_send_polls"`
-	CanChangeInfo   bool `json:"can_change_info" bson:"can_change_info"`
-	CanInviteUsers  bool `json:"can_invite_users" bson:"can_invite_users"`
+	CanSendMessages bool       `json:"can_send_messages" bson:"can_send_messages"`
+	CanSendMedia    bool       `json:"can_send_media" bson:"can_send_media"`
+	CanSendLinks    bool       `json:"can_send_links" bson:"can_send_links"`
+	CanSendPolls    bool       `json:"can_send_polls" bson:"can_send_polls"`
+	CanChangeInfo   bool       `json:"can_change_info" bson:"can_change_info"`
+	CanInviteUsers  bool       `json:"can_invite_users" bson:"can_invite_users"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty" bson:"updated_at,omitempty"` // unset until an admin configures them
+}
+
+// Kinds of MemberRestriction.
+const (
+	RestrictionBan      = "ban"      // removed and cannot rejoin
+	RestrictionMute     = "mute"     // read-only
+	RestrictionRestrict = "restrict" // specific rights removed
+)
+
+// MemberRestriction bans, mutes or narrows the rights of one user in a
+// group or channel, optionally until a date, after which it expires. Members
+// get the stricter of it and the group's restrictions.
+type MemberRestriction struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ChatID       primitive.ObjectID `json:"chat_id" bson:"chat_id"`
+	UserID       primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Kind         string             `json:"kind" bson:"kind"` // ban, mute, restrict; unset means restrict
+	Rights       GroupRestrictions  `json:"rights" bson:"rights"`
+	UntilDate    *time.Time         `json:"until_date,omitempty" bson:"until_date,omitempty"` // unset: until lifted
+	RestrictedBy primitive.ObjectID `json:"restricted_by" bson:"restricted_by"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
 }
 
 type ChatStatistics struct {
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OTPDelivery tracks how a one-time code reached (or failed to reach) its
+// recipient. Providers are tried in order; each try is recorded as an attempt.
+type OTPDelivery struct {
+	ID                primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	PhoneNumber       string               `json:"phone_number" bson:"phone_number"`
+	Email             string               `json:"email,omitempty" bson:"email,omitempty"`
+	Purpose           string               `json:"purpose" bson:"purpose"` // login, password_reset, ...
+	Status            string               `json:"status" bson:"status"`   // sent, failed
+	Provider          string               `json:"provider,omitempty" bson:"provider,omitempty"`
+	Channel           string               `json:"channel,omitempty" bson:"channel,omitempty"` // sms, email, dev
+	ProviderMessageID string               `json:"provider_message_id,omitempty" bson:"provider_message_id,omitempty"`
+	Attempts          []OTPDeliveryAttempt `json:"attempts" bson:"attempts"`
+	CreatedAt         time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt         time.Time            `json:"updated_at" bson:"updated_at"`
+}
+
+type OTPDeliveryAttempt struct {
+	Provider string    `json:"provider" bson:"provider"`
+	Channel  string    `json:"channel" bson:"channel"`
+	Status   string    `json:"status" bson:"status"` // sent, failed, skipped
+	Error    string    `json:"error,omitempty" bson:"error,omitempty"`
+	At       time.Time `json:"at" bson:"at"`
+}
+
+// AuthThrottle holds the send and verification counters for one phone number
+// or IP address. The ID is the throttled key, e.g. "phone:+15550100".
+type AuthThrottle struct {
+	ID                string    `json:"id" bson:"_id"`
+	SendCount         int       `json:"send_count" bson:"send_count"`
+	SendWindowStart   time.Time `json:"send_window_start" bson:"send_window_start"`
+	NextSendAt        time.Time `json:"next_send_at" bson:"next_send_at"`
+	FailedCount       int       `json:"failed_count" bson:"failed_count"`
+	FailedWindowStart time.Time `json:"failed_window_start" bson:"failed_window_start"`
+	LockedUntil       time.Time `json:"locked_until" bson:"locked_until"`
+	Lockouts          int       `json:"lockouts" bson:"lockouts"` // escalates the next lockout
+	UpdatedAt         time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// VerificationFailure is an audit record of a failed or refused verification.
+type VerificationFailure struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PhoneNumber string             `json:"phone_number" bson:"phone_number"`
+	IPAddress   string             `json:"ip_address" bson:"ip_address"`
+	Reason      string             `json:"reason" bson:"reason"` // wrong_code, no_code, code_burned, locked, send_throttled
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// EmailCode is a one-time code sent by email, either to verify an address
+// before it is saved or to recover an account.
+type EmailCode struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Email     string             `json:"email" bson:"email"`
+	Purpose   string             `json:"purpose" bson:"purpose"` // verify_email, verify_recovery_email, account_recovery
+	CodeHash  string             `json:"-" bson:"code_hash"`
+	Attempts  int                `json:"attempts" bson:"attempts"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
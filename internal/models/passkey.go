@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Passkey is a WebAuthn credential registered by a user. Only the public key
+// is stored; CredentialID is the base64url credential ID.
+type Passkey struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Name           string             `json:"name" bson:"name"`
+	CredentialID   string             `json:"credential_id" bson:"credential_id"`
+	PublicKey      []byte             `json:"-" bson:"public_key"`        // COSE_Key
+	Algorithm      int64              `json:"algorithm" bson:"algorithm"` // COSE: -7 ES256, -8 EdDSA, -257 RS256
+	SignCount      uint32             `json:"-" bson:"sign_count"`
+	AAGUID         string             `json:"aaguid,omitempty" bson:"aaguid,omitempty"`
+	Transports     []string           `json:"transports,omitempty" bson:"transports,omitempty"`
+	BackupEligible bool               `json:"backup_eligible" bson:"backup_eligible"` // synced passkey
+	BackupState    bool               `json:"backup_state" bson:"backup_state"`
+	LastUsedAt     *time.Time         `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// WebAuthnChallenge is a pending passkey registration or login ceremony.
+// Each challenge can be answered once.
+type WebAuthnChallenge struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Challenge string              `json:"challenge" bson:"challenge"` // base64url
+	Ceremony  string              `json:"ceremony" bson:"ceremony"`   // registration, login
+	UserID    *primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	ExpiresAt time.Time           `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
+}
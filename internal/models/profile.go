@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PublicProfile is what other users see of a user, after the user's privacy
+// settings have been applied for the viewer. It never carries the QR code,
+// location or account details.
+type PublicProfile struct {
+	ID              primitive.ObjectID `json:"id"`
+	Username        string             `json:"username,omitempty"`
+	FirstName       string             `json:"first_name,omitempty"`
+	LastName        string             `json:"last_name,omitempty"`
+	Avatar          string             `json:"avatar,omitempty"`
+	Bio             string             `json:"bio,omitempty"`
+	PhoneNumber     string             `json:"phone_number,omitempty"` // contacts only, unless hidden
+	IsPremium       bool               `json:"is_premium"`
+	UserType        string             `json:"user_type,omitempty"`
+	CompanyName     string             `json:"company_name,omitempty"`
+	CompanyCategory string             `json:"company_category,omitempty"`
+	LastActive      *time.Time         `json:"last_active,omitempty"` // when last seen is visible
+	LastSeen        string             `json:"last_seen,omitempty"`   // otherwise: recently, within_week, within_month, long_ago
+	IsOnline        *bool              `json:"is_online,omitempty"`   // when online status is visible
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuthSession is a server-side login session. Every access token carries the
+// session ID, so revoking the session invalidates its tokens immediately.
+type AuthSession struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID        primitive.ObjectID `json:"user_id" bson:"user_id"`
+	DeviceID      string             `json:"device_id" bson:"device_id"`
+	DeviceName    string             `json:"device_name" bson:"device_name"`
+	DeviceType    string             `json:"device_type" bson:"device_type"` // mobile, tablet, desktop, web
+	IPAddress     string             `json:"ip_address" bson:"ip_address"`
+	UserAgent     string             `json:"user_agent" bson:"user_agent"`
+	Revoked       bool               `json:"revoked" bson:"revoked"`
+	RevokedAt     *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	RevokedReason string             `json:"revoked_reason,omitempty" bson:"revoked_reason,omitempty"` // logout, terminated, token_reuse
+	LastActive    time.Time          `json:"last_active" bson:"last_active"`
+	ExpiresAt     time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// RefreshToken is one link in a session's refresh token chain (its "family").
+// Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	SessionID primitive.ObjectID `json:"session_id" bson:"session_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	TokenHash string             `json:"-" bson:"token_hash"`
+	UsedAt    *time.Time         `json:"used_at,omitempty" bson:"used_at,omitempty"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// AuthChallenge is a login that passed its first factor but still has
+// pending steps (e.g. the two-step cloud password) before tokens are issued.
+// The device fields describe the client logging in, shown to existing
+// sessions when the login needs their approval.
+type AuthChallenge struct {
+	ID         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID  `json:"user_id" bson:"user_id"`
+	TokenHash  string              `json:"-" bson:"token_hash"`
+	Pending    []string            `json:"pending" bson:"pending"` // password, totp, device_approval
+	Attempts   int                 `json:"attempts" bson:"attempts"`
+	DeviceID   string              `json:"device_id,omitempty" bson:"device_id,omitempty"`
+	DeviceName string              `json:"device_name,omitempty" bson:"device_name,omitempty"`
+	DeviceType string              `json:"device_type,omitempty" bson:"device_type,omitempty"`
+	IPAddress  string              `json:"ip_address,omitempty" bson:"ip_address,omitempty"`
+	UserAgent  string              `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	ApprovedBy *primitive.ObjectID `json:"approved_by,omitempty" bson:"approved_by,omitempty"` // approving session
+	ExpiresAt  time.Time           `json:"expires_at" bson:"expires_at"`
+	CreatedAt  time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// QRLoginToken is a short-lived login request shown as a QR code by a web or
+// desktop client and approved by an already logged-in device.
+type QRLoginToken struct {
+	ID         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	TokenHash  string              `json:"-" bson:"token_hash"`
+	Status     string              `json:"status" bson:"status"` // pending, approved, consumed
+	UserID     *primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	ApprovedBy *primitive.ObjectID `json:"approved_by,omitempty" bson:"approved_by,omitempty"` // approving session
+	DeviceID   string              `json:"device_id" bson:"device_id"`
+	DeviceName string              `json:"device_name" bson:"device_name"`
+	DeviceType string              `json:"device_type" bson:"device_type"`
+	IPAddress  string              `json:"ip_address" bson:"ip_address"`
+	UserAgent  string              `json:"user_agent" bson:"user_agent"`
+	ApprovedAt *time.Time          `json:"approved_at,omitempty" bson:"approved_at,omitempty"`
+	ExpiresAt  time.Time           `json:"expires_at" bson:"expires_at"`
+	CreatedAt  time.Time           `json:"created_at" bson:"created_at"`
+}
@@ -60,6 +60,9 @@ type PrivacySettings struct {
 	OnlineStatus    string   `json:"online_status" bson:"online_status"` // everyone, contacts, nobody
 	ProfilePhoto    string   `json:"profile_photo" bson:"profile_photo"` // everyone, contacts, nobody
 	BioVisibility   string   `json:"bio_visibility" bson:"bio_visibility"` // everyone, contacts, nobody
+	GroupInvites    string   `json:"group_invites" bson:"group_invites"` // everyone, contacts, nobody
+	Forwards        string   `json:"forwards" bson:"forwards"` // everyone, contacts, nobody
+	Exceptions      map[string]PrivacyExceptions `json:"exceptions,omitempty" bson:"exceptions,omitempty"` // keyed by privacy key
 	FindByPhone     bool     `json:"find_by_phone" bson:"find_by_phone"`
 	FindByUsername  bool     `json:"find_by_username" bson:"find_by_username"`
 	BlockedUsers    []primitive.ObjectID `json:"blocked_users" bson:"blocked_users"`
@@ -70,10 +73,22 @@ type PrivacySettings struct {
 	SpamReports     bool     `json:"spam_reports" bson:"spam_reports"`
 }
 
+// PrivacyExceptions override one privacy rule for specific users, or for
+// everyone in specific groups. Never-allow entries win over always-allow
+// ones, and user entries over chat entries.
+type PrivacyExceptions struct {
+	AlwaysAllowUsers []primitive.ObjectID `json:"always_allow_users" bson:"always_allow_users"`
+	NeverAllowUsers  []primitive.ObjectID `json:"never_allow_users" bson:"never_allow_users"`
+	AlwaysAllowChats []primitive.ObjectID `json:"always_allow_chats" bson:"always_allow_chats"`
+	NeverAllowChats  []primitive.ObjectID `json:"never_allow_chats" bson:"never_allow_chats"`
+}
+
 type Session struct {
 	ID          string    `json:"id" bson:"id"`
 	DeviceName  string    `json:"device_name" bson:"device_name"`
+	DeviceType  string    `json:"device_type" bson:"device_type"`
 	IPAddress   string    `json:"ip_address" bson:"ip_address"`
+	UserAgent   string    `json:"user_agent" bson:"user_agent"`
 	LastActive  time.Time `json:"last_active" bson:"last_active"`
 	IsCurrent   bool      `json:"is_current" bson:"is_current"`
 }
@@ -10,19 +10,34 @@ type User struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	PhoneNumber string            `json:"phone_number" bson:"phone_number"`
 	QRCode      string            `json:"qr_code" bson:"qr_code"`
-	Username    string            `json:"username" bson:"username"`
+	Username    string            `json:"username" bson:"username"` // shared namespace, see /users/me/username
+	UsernameChangedAt *time.Time  `json:"-" bson:"username_changed_at,omitempty"`
 	FirstName   string            `json:"first_name,omitempty" bson:"first_name,omitempty"`
 	LastName    string            `json:"last_name,omitempty" bson:"last_name,omitempty"`
 	Avatar      string            `json:"avatar" bson:"avatar"`
 	Bio         string            `json:"bio,omitempty" bson:"bio,omitempty"`
 	IsAnonymous bool              `json:"is_anonymous" bson:"is_anonymous"`
 	HidePhoneNumber bool          `json:"hide_phone_number" bson:"hide_phone_number"` // Gizli numara
+	PasswordHash string           `json:"-" bson:"password_hash,omitempty"` // bcrypt, also the two-step cloud password
+	PasswordHint string           `json:"-" bson:"password_hint,omitempty"`
+	TwoStepEnabled bool           `json:"two_step_enabled" bson:"two_step_enabled"`
+	TOTPEnabled bool              `json:"totp_enabled" bson:"totp_enabled"`
+	TOTPSecret  string            `json:"-" bson:"totp_secret,omitempty"`
+	TOTPPendingSecret string      `json:"-" bson:"totp_pending_secret,omitempty"` // awaiting confirmation during (re-)enrollment
+	TOTPLastStep int64            `json:"-" bson:"totp_last_step,omitempty"` // last accepted time step, rejects replays
+	RecoveryCodeHashes []string   `json:"-" bson:"recovery_code_hashes,omitempty"`
+	Email       string            `json:"-" bson:"email,omitempty"` // verified only, see /auth/email
+	RecoveryEmail string          `json:"-" bson:"recovery_email,omitempty"` // verified only, used for account recovery
 	IsPremium  bool               `json:"is_premium" bson:"is_premium"`
 	PremiumUntil *time.Time       `json:"premium_until,omitempty" bson:"premium_until,omitempty"`
 	Location    Location          `json:"location" bson:"location"`
 	ActiveDevices []DeviceInfo    `json:"active_devices,omitempty" bson:"active_devices,omitempty"`
 	AccountStatus string          `json:"account_status" bson:"account_status"` // active, suspended, deleted
+	SuspendedAt *time.Time        `json:"suspended_at,omitempty" bson:"suspended_at,omitempty"`
+	SuspendedBy string            `json:"suspended_by,omitempty" bson:"suspended_by,omitempty"` // self, admin
 	SelfDestructTTL int           `json:"self_destruct_ttl,omitempty" bson:"self_destruct_ttl,omitempty"` // days
+	SelfDestructWarnedAt *time.Time `json:"self_destruct_warned_at,omitempty" bson:"self_destruct_warned_at,omitempty"` // inactivity warning sent
+	AutoLogout      int           `json:"auto_logout,omitempty" bson:"auto_logout,omitempty"` // idle minutes before sessions end, 0 = never
 	UserType    string            `json:"user_type" bson:"user_type"` // "normal" or "company"
 	CompanyName string            `json:"company_name,omitempty" bson:"company_name,omitempty"`
 	CompanyCategory string        `json:"company_category,omitempty" bson:"company_category,omitempty"`
@@ -36,8 +51,10 @@ type DeviceInfo struct {
 	DeviceName  string    `json:"device_name" bson:"device_name"`
 	DeviceType  string    `json:"device_type" bson:"device_type"` // mobile, tablet, desktop, web
 	IPAddress   string    `json:"ip_address" bson:"ip_address"`
+	UserAgent   string    `json:"user_agent" bson:"user_agent"`
 	LastActive  time.Time `json:"last_active" bson:"last_active"`
 	IsCurrent   bool      `json:"is_current" bson:"is_current"`
+	SecretHash  string    `json:"-" bson:"secret_hash,omitempty"` // hash of the server-issued device secret
 }
 
 type Location struct {
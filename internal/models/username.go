@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UsernameClaim reserves a public username for one user, group, channel or
+// bot. Usernames share one case-insensitive namespace; Name is the lowercase
+// key and Username keeps the owner's spelling.
+type UsernameClaim struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name      string             `json:"-" bson:"name"`
+	Username  string             `json:"username" bson:"username"`
+	OwnerType string             `json:"owner_type" bson:"owner_type"` // user, group, channel, bot
+	OwnerID   primitive.ObjectID `json:"owner_id" bson:"owner_id"`
+	ClaimedAt time.Time          `json:"claimed_at" bson:"claimed_at"`
+}
@@ -17,27 +17,71 @@ func SetupRoutes(r *gin.Engine, db *database.Database, hub *websocket.Hub, cfg *
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
-	// Initialize Twilio service
-	twilioService := utils.NewTwilioService(cfg)
+	// Public keys for verifying access tokens (RS256/EdDSA only)
+	r.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(200, utils.JWKS())
+	})
+
+	// Initialize OTP delivery (Twilio, HTTP SMS gateway, SMTP, dev sink)
+	otpService := utils.NewOTPService(db, cfg)
+	mailer := utils.NewMailer(cfg)
+
+	// Initialize session service (access/refresh tokens)
+	sessionService := utils.NewSessionService(db, cfg)
 
 	api := r.Group("/api/v1")
 	
 	// Auth routes
 	auth := api.Group("/auth")
 	{
-		authHandler := handlers.NewAuthHandler(db, twilioService)
+		authHandler := handlers.NewAuthHandler(db, otpService, mailer, sessionService, hub, utils.NewWebAuthn(cfg))
 		auth.POST("/register", authHandler.Register)
 		auth.POST("/login", authHandler.Login)
-		auth.GET("/qr/:user_id", authHandler.GetQRCode)
 		auth.POST("/verify-phone", authHandler.VerifyPhone)
 		auth.POST("/send-code", authHandler.SendCode)
 		auth.POST("/verify-code", authHandler.VerifyCode)
 		auth.POST("/register-with-code", authHandler.RegisterWithCode)
+		auth.POST("/refresh", authHandler.Refresh)
+		auth.POST("/verify-password", authHandler.VerifyPassword)
+		auth.POST("/verify-totp", authHandler.VerifyTOTP)
+		auth.POST("/password/reset", authHandler.ResetPassword)
+		auth.POST("/qr-login", authHandler.CreateQRLogin)
+		auth.POST("/qr-login/poll", authHandler.PollQRLogin)
+		auth.POST("/recovery/send-code", authHandler.SendRecoveryCode)
+		auth.POST("/recovery/login", authHandler.RecoveryLogin)
+		auth.POST("/device-approval/poll", authHandler.PollDeviceApproval)
+		auth.POST("/passkeys/login/options", authHandler.PasskeyLoginOptions)
+		auth.POST("/passkeys/login", authHandler.PasskeyLogin)
+
+		authed := auth.Group("", middleware.AuthMiddleware(db, sessionService))
+		authed.POST("/logout", authHandler.Logout)
+		authed.GET("/qr/:user_id", authHandler.GetQRCode)
+		authed.PUT("/password", authHandler.ChangePassword)
+		authed.POST("/two-step/enable", authHandler.EnableTwoStep)
+		authed.POST("/two-step/disable", authHandler.DisableTwoStep)
+		authed.POST("/totp/setup", authHandler.SetupTOTP)
+		authed.POST("/totp/confirm", authHandler.ConfirmTOTP)
+		authed.POST("/totp/disable", authHandler.DisableTOTP)
+		authed.POST("/totp/recovery-codes", authHandler.RegenerateRecoveryCodes)
+		authed.POST("/qr-login/approve", authHandler.ApproveQRLogin)
+		authed.POST("/email", authHandler.RequestEmailVerification)
+		authed.POST("/email/verify", authHandler.VerifyEmail)
+		authed.DELETE("/email", authHandler.RemoveEmail)
+		authed.POST("/phone/send-code", authHandler.SendChangePhoneCode)
+		authed.POST("/phone/change", authHandler.ChangePhone)
+		authed.GET("/passkeys", authHandler.GetPasskeys)
+		authed.POST("/passkeys/register/options", authHandler.PasskeyRegistrationOptions)
+		authed.POST("/passkeys/register", authHandler.RegisterPasskey)
+		authed.DELETE("/passkeys/:passkey_id", authHandler.DeletePasskey)
+		authed.GET("/devices/pending", authHandler.GetPendingDeviceLogins)
+		authed.POST("/devices/pending/:request_id/approve", authHandler.ApproveDeviceLogin)
+		authed.POST("/devices/pending/:request_id/deny", authHandler.DenyDeviceLogin)
 	}
 
 	// Protected routes
 	protected := api.Group("/")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(db, sessionService))
 	{
 		// User routes
 		userHandler := handlers.NewUserHandler(db)
@@ -45,6 +89,7 @@ func SetupRoutes(r *gin.Engine, db *database.Database, hub *websocket.Hub, cfg *
 		{
 			user.GET("/me", userHandler.GetMe)
 			user.PUT("/me", userHandler.UpdateMe)
+			user.PUT("/me/username", userHandler.UpdateUsername)
 			user.PUT("/location", userHandler.UpdateLocation)
 			user.GET("/nearby", userHandler.GetNearbyUsers)
 			user.GET("/search", userHandler.SearchByUsername)
@@ -57,6 +102,15 @@ func SetupRoutes(r *gin.Engine, db *database.Database, hub *websocket.Hub, cfg *
 			public.GET("/users/search", userHandler.SearchByUsername)
 		}
 
+		// Public usernames of users, groups, channels and bots
+		usernameHandler := handlers.NewUsernameHandler(db)
+		protected.GET("/resolve/:username", usernameHandler.Resolve)
+
+		// Joining groups and channels through invite links
+		inviteHandler := handlers.NewInviteHandler(db)
+		protected.GET("/invite/:code", inviteHandler.Preview)
+		protected.POST("/invite/:code/join", inviteHandler.Join)
+
 		// Contact routes
 		contactHandler := handlers.NewContactHandler(db)
 		contacts := protected.Group("/contacts")
@@ -72,59 +126,102 @@ func SetupRoutes(r *gin.Engine, db *database.Database, hub *websocket.Hub, cfg *
 		{
 			chats.GET("", chatHandler.GetChats)
 			chats.POST("", chatHandler.CreateChat)
-			chats.GET("/:chat_id", chatHandler.GetChat)
-			chats.GET("/:chat_id/messages", chatHandler.GetMessages)
-			chats.POST("/:chat_id/messages", chatHandler.SendMessage)
+			chats.GET("/:chat_id", middleware.ChatReader(db, "chat_id"), chatHandler.GetChat)
+			chats.GET("/:chat_id/messages", middleware.ChatReader(db, "chat_id"), chatHandler.GetMessages)
+			chats.POST("/:chat_id/messages", middleware.ChatMember(db, "chat_id"), chatHandler.SendMessage)
 		}
 
 		// Message routes
 		messageHandler := handlers.NewMessageHandler(db, hub)
 		messages := protected.Group("/messages")
 		{
-			messages.PUT("/:message_id", messageHandler.EditMessage)
-			messages.DELETE("/:message_id", messageHandler.DeleteMessage)
-			messages.POST("/:message_id/forward", messageHandler.ForwardMessage)
-			messages.POST("/:message_id/reaction", messageHandler.AddReaction)
-			messages.DELETE("/:message_id/reaction", messageHandler.RemoveReaction)
+			// Chats named in the body or query are checked by the handlers
+			messageMember := middleware.MessageChatMember(db)
+			messageReader := middleware.MessageChatReader(db)
+			messages.PUT("/:message_id", messageMember, messageHandler.EditMessage)
+			messages.DELETE("/:message_id", messageMember, messageHandler.DeleteMessage)
+			messages.POST("/:message_id/forward", messageReader, messageHandler.ForwardMessage)
+			messages.POST("/:message_id/reaction", messageMember, messageHandler.AddReaction)
+			messages.DELETE("/:message_id/reaction", messageMember, messageHandler.RemoveReaction)
 			messages.POST("/read", messageHandler.MarkAsRead)
-			messages.POST("/:message_id/pin", messageHandler.PinMessage)
-			messages.DELETE("/:message_id/pin", messageHandler.UnpinMessage)
-			messages.POST("/:message_id/poll/vote", messageHandler.VotePoll)
+			messages.POST("/:message_id/pin", messageMember, messageHandler.PinMessage)
+			messages.DELETE("/:message_id/pin", messageMember, messageHandler.UnpinMessage)
+			messages.POST("/:message_id/poll/vote", messageMember, messageHandler.VotePoll)
 			messages.GET("/search", messageHandler.SearchMessages)
-			messages.GET("/:message_id/translate", messageHandler.TranslateMessage)
+			messages.GET("/:message_id/translate", messageReader, messageHandler.TranslateMessage)
 		}
 
 		// Typing indicator routes
 		typingHandler := handlers.NewTypingHandler(db, hub)
 		typing := protected.Group("/typing")
 		{
-			typing.POST("/:chat_id", typingHandler.SetTyping)
-			typing.GET("/:chat_id", typingHandler.GetTyping)
+			typing.POST("/:chat_id", middleware.ChatMember(db, "chat_id"), typingHandler.SetTyping)
+			typing.GET("/:chat_id", middleware.ChatMember(db, "chat_id"), typingHandler.GetTyping)
 		}
 
 		// Group routes
-		groupHandler := handlers.NewGroupHandler(db)
+		groupHandler := handlers.NewGroupHandler(db, hub)
 		groups := protected.Group("/groups")
 		{
 			groups.POST("", groupHandler.CreateGroup)
 			groups.GET("", groupHandler.GetGroups)
-			groups.GET("/:group_id", groupHandler.GetGroup)
-			groups.PUT("/:group_id", groupHandler.UpdateGroup)
-			groups.DELETE("/:group_id", groupHandler.DeleteGroup)
-			groups.POST("/:group_id/members", groupHandler.AddMember)
-			groups.DELETE("/:group_id/members/:member_id", groupHandler.RemoveMember)
-			groups.GET("/:group_id/statistics", groupHandler.GetStatistics)
+			groupMember := middleware.ChatMember(db, "group_id")
+			groups.GET("/:group_id", groupMember, groupHandler.GetGroup)
+			groups.PUT("/:group_id", groupMember, groupHandler.UpdateGroup)
+			groups.PUT("/:group_id/username", groupMember, groupHandler.UpdateUsername)
+			groups.DELETE("/:group_id", groupMember, groupHandler.DeleteGroup)
+			groups.POST("/:group_id/members", groupMember, groupHandler.AddMember)
+			groups.DELETE("/:group_id/members/:member_id", groupMember, groupHandler.RemoveMember)
+			groups.GET("/:group_id/statistics", groupMember, groupHandler.GetStatistics)
+			groups.PUT("/:group_id/restrictions", groupMember, groupHandler.UpdateRestrictions)
+			groups.PUT("/:group_id/members/:member_id/restrictions", groupMember, groupHandler.RestrictMember)
+			groups.DELETE("/:group_id/members/:member_id/restrictions", groupMember, groupHandler.UnrestrictMember)
+			groups.PUT("/:group_id/members/:member_id/mute", groupMember, groupHandler.MuteMember)
+
+			groupAdmins := handlers.NewChatAdminHandler(db, hub, "group", "group_id")
+			groups.GET("/:group_id/admins", groupMember, groupAdmins.GetAdmins)
+			groups.POST("/:group_id/admins", groupMember, groupAdmins.PromoteAdmin)
+			groups.DELETE("/:group_id/admins/:user_id", groupMember, groupAdmins.DemoteAdmin)
+			groups.POST("/:group_id/transfer-ownership", groupMember, groupAdmins.TransferOwnership)
+			groups.GET("/:group_id/bans", groupMember, groupAdmins.GetBans)
+			groups.POST("/:group_id/bans", groupMember, groupAdmins.BanUser)
+			groups.DELETE("/:group_id/bans/:user_id", groupMember, groupAdmins.UnbanUser)
+			groups.GET("/:group_id/invite-links", groupMember, groupAdmins.GetInviteLinks)
+			groups.POST("/:group_id/invite-links", groupMember, groupAdmins.CreateInviteLink)
+			groups.DELETE("/:group_id/invite-links/:link_id", groupMember, groupAdmins.RevokeInviteLink)
+			groups.GET("/:group_id/join-requests", groupMember, groupAdmins.GetJoinRequests)
+			groups.POST("/:group_id/join-requests/:user_id/approve", groupMember, groupAdmins.ApproveJoinRequest)
+			groups.POST("/:group_id/join-requests/:user_id/decline", groupMember, groupAdmins.DeclineJoinRequest)
+			groups.GET("/:group_id/events", groupMember, groupAdmins.GetEvents)
 		}
 
 		// Channel routes
-		channelHandler := handlers.NewChannelHandler(db)
+		channelHandler := handlers.NewChannelHandler(db, hub)
 		channels := protected.Group("/channels")
 		{
 			channels.POST("", channelHandler.CreateChannel)
+			channelMember := middleware.ChatMember(db, "channel_id")
+			channels.PUT("/:channel_id/username", channelMember, channelHandler.UpdateUsername)
 			channels.POST("/:channel_id/subscribe", channelHandler.Subscribe)
-			channels.POST("/:channel_id/unsubscribe", channelHandler.Unsubscribe)
-			channels.POST("/:channel_id/messages/:message_id/view", channelHandler.RecordView)
-			channels.GET("/:channel_id/statistics", channelHandler.GetStatistics)
+			channels.POST("/:channel_id/unsubscribe", channelMember, channelHandler.Unsubscribe)
+			channels.POST("/:channel_id/messages/:message_id/view", middleware.ChatReader(db, "channel_id"), channelHandler.RecordView)
+			channels.GET("/:channel_id/statistics", channelMember, channelHandler.GetStatistics)
+
+			channelAdmins := handlers.NewChatAdminHandler(db, hub, "channel", "channel_id")
+			channels.GET("/:channel_id/admins", channelMember, channelAdmins.GetAdmins)
+			channels.POST("/:channel_id/admins", channelMember, channelAdmins.PromoteAdmin)
+			channels.DELETE("/:channel_id/admins/:user_id", channelMember, channelAdmins.DemoteAdmin)
+			channels.POST("/:channel_id/transfer-ownership", channelMember, channelAdmins.TransferOwnership)
+			channels.GET("/:channel_id/bans", channelMember, channelAdmins.GetBans)
+			channels.POST("/:channel_id/bans", channelMember, channelAdmins.BanUser)
+			channels.DELETE("/:channel_id/bans/:user_id", channelMember, channelAdmins.UnbanUser)
+			channels.GET("/:channel_id/invite-links", channelMember, channelAdmins.GetInviteLinks)
+			channels.POST("/:channel_id/invite-links", channelMember, channelAdmins.CreateInviteLink)
+			channels.DELETE("/:channel_id/invite-links/:link_id", channelMember, channelAdmins.RevokeInviteLink)
+			channels.GET("/:channel_id/join-requests", channelMember, channelAdmins.GetJoinRequests)
+			channels.POST("/:channel_id/join-requests/:user_id/approve", channelMember, channelAdmins.ApproveJoinRequest)
+			channels.POST("/:channel_id/join-requests/:user_id/decline", channelMember, channelAdmins.DeclineJoinRequest)
+			channels.GET("/:channel_id/events", channelMember, channelAdmins.GetEvents)
 		}
 
 		// Proposal routes
@@ -155,19 +252,21 @@ func SetupRoutes(r *gin.Engine, db *database.Database, hub *websocket.Hub, cfg *
 		}
 
 		// Settings routes
-		settingsHandler := handlers.NewSettingsHandler(db)
+		settingsHandler := handlers.NewSettingsHandler(db, sessionService, hub)
 		settings := protected.Group("/settings")
 		{
 			settings.GET("", settingsHandler.GetSettings)
 			settings.PUT("", settingsHandler.UpdateSettings)
 			settings.PUT("/account", settingsHandler.UpdateAccountSettings)
 			settings.PUT("/privacy", settingsHandler.UpdatePrivacySettings)
+			settings.PUT("/privacy/exceptions/:key", settingsHandler.UpdatePrivacyExceptions)
 			settings.PUT("/chat", settingsHandler.UpdateChatSettings)
 			settings.PUT("/notifications", settingsHandler.UpdateNotificationSettings)
 			settings.PUT("/appearance", settingsHandler.UpdateAppearanceSettings)
 			settings.PUT("/data", settingsHandler.UpdateDataSettings)
 			settings.PUT("/calls", settingsHandler.UpdateCallSettings)
 			settings.PUT("/groups", settingsHandler.UpdateGroupSettings)
+			settings.PUT("/devices", settingsHandler.UpdateDeviceSettings)
 			settings.PUT("/advanced", settingsHandler.UpdateAdvancedSettings)
 			settings.GET("/sessions", settingsHandler.GetSessions)
 			settings.DELETE("/sessions/:session_id", settingsHandler.TerminateSession)
@@ -175,6 +274,7 @@ func SetupRoutes(r *gin.Engine, db *database.Database, hub *websocket.Hub, cfg *
 			settings.DELETE("/block/:user_id", settingsHandler.UnblockUser)
 			settings.GET("/blocked", settingsHandler.GetBlockedUsers)
 			settings.POST("/suspend", settingsHandler.SuspendAccount)
+			settings.POST("/account/reactivate", settingsHandler.ReactivateAccount)
 			settings.POST("/delete", settingsHandler.DeleteAccount)
 			settings.POST("/cache/clear", settingsHandler.ClearCache)
 			settings.GET("/data-usage", settingsHandler.GetDataUsage)
@@ -213,7 +313,11 @@ func SetupRoutes(r *gin.Engine, db *database.Database, hub *websocket.Hub, cfg *
 
 	// WebSocket route
 	r.GET("/ws", func(c *gin.Context) {
-		websocket.HandleWebSocket(hub, c, db)
+		if c.Query("qr_login") != "" {
+			websocket.HandleQRLoginWebSocket(hub, c, db)
+			return
+		}
+		websocket.HandleWebSocket(hub, c, db, sessionService)
 	})
 }
 
@@ -0,0 +1,216 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat-backend/internal/config"
+	"chat-backend/internal/database"
+	"chat-backend/internal/utils"
+	"chat-backend/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// openRoutes are chat-scoped routes that non-members may call.
+var openRoutes = map[string]bool{
+	"POST /api/v1/channels/:channel_id/subscribe": true,
+}
+
+// chatParams are the route parameters naming a chat, checked by the chat
+// middleware before the handler runs.
+var chatParams = []string{":chat_id", ":group_id", ":channel_id"}
+
+// routeTest serves requests through the real routes as an authenticated user.
+type routeTest struct {
+	mt     *mtest.T
+	engine *gin.Engine
+	userID primitive.ObjectID
+}
+
+func newRouteTest(t *testing.T, mt *mtest.T) *routeTest {
+	gin.SetMode(gin.TestMode)
+	if _, err := utils.ConfigureJWT(&config.Config{JWTSecret: "router-test-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	rt := &routeTest{mt: mt, engine: gin.New(), userID: primitive.NewObjectID()}
+	SetupRoutes(rt.engine, &database.Database{MongoDB: mt.DB}, websocket.NewHub(), &config.Config{})
+	return rt
+}
+
+// serve queues the lookups of the auth middleware followed by one find
+// result per response (nil for no document) and serves the request.
+func (rt *routeTest) serve(t *testing.T, method, path, body string, responses ...bson.D) *httptest.ResponseRecorder {
+	sessionID := primitive.NewObjectID()
+	token, err := utils.GenerateToken(rt.userID, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	rt.mt.AddMockResponses(
+		// Session, auto-logout setting and account status
+		mtest.CreateCursorResponse(0, "test.sessions", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: sessionID},
+			{Key: "user_id", Value: rt.userID},
+			{Key: "last_active", Value: now},
+			{Key: "expires_at", Value: now.Add(time.Hour)},
+		}),
+		mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch),
+		mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: rt.userID},
+			{Key: "account_status", Value: "active"},
+		}),
+	)
+	for _, response := range responses {
+		if response == nil {
+			rt.mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.coll", mtest.FirstBatch))
+			continue
+		}
+		rt.mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.coll", mtest.FirstBatch, response))
+	}
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	rt.engine.ServeHTTP(w, req)
+	return w
+}
+
+// expectNotMember fails unless the request was refused for lack of
+// membership.
+func expectNotMember(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "not a member") {
+		t.Fatalf("got %d %s, want %d for a non-member", w.Code, w.Body.String(), http.StatusForbidden)
+	}
+}
+
+func chatDoc(chatID primitive.ObjectID, chatType, publicLink string, members ...primitive.ObjectID) bson.D {
+	doc := bson.D{
+		{Key: "_id", Value: chatID},
+		{Key: "type", Value: chatType},
+		{Key: "members", Value: members},
+	}
+	if publicLink != "" {
+		doc = append(doc, bson.E{Key: "public_link", Value: publicLink})
+	}
+	return doc
+}
+
+func messageDoc(messageID, chatID primitive.ObjectID) bson.D {
+	return bson.D{{Key: "_id", Value: messageID}, {Key: "chat_id", Value: chatID}}
+}
+
+func TestChatRoutesRejectNonMembers(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("routes", func(mt *mtest.T) {
+		rt := newRouteTest(mt.T, mt)
+		otherID := primitive.NewObjectID()
+
+		tested := 0
+		for _, route := range rt.engine.Routes() {
+			name := route.Method + " " + route.Path
+			byChat := false
+			for _, param := range chatParams {
+				byChat = byChat || strings.Contains(route.Path, param)
+			}
+			byMessage := strings.Contains(route.Path, ":message_id")
+			if openRoutes[name] || (!byChat && !byMessage) {
+				continue
+			}
+
+			mt.T.Run(name, func(t *testing.T) {
+				chatID := primitive.NewObjectID()
+				path := route.Path
+				for _, param := range chatParams {
+					path = strings.ReplaceAll(path, param, chatID.Hex())
+				}
+				// Remaining parameters name users, messages, links and so on
+				for strings.Contains(path, ":") {
+					start := strings.Index(path, ":")
+					end := strings.Index(path[start:], "/")
+					if end < 0 {
+						end = len(path) - start
+					}
+					path = path[:start] + primitive.NewObjectID().Hex() + path[start+end:]
+				}
+
+				var responses []bson.D
+				if !byChat {
+					responses = append(responses, messageDoc(primitive.NewObjectID(), chatID))
+				}
+				responses = append(responses, chatDoc(chatID, "group", "", otherID))
+
+				expectNotMember(t, rt.serve(t, route.Method, path, "{}", responses...))
+			})
+			tested++
+		}
+		if tested == 0 {
+			mt.Fatal("no chat-scoped routes found")
+		}
+	})
+}
+
+func TestHandlersRejectNonMembers(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	otherID := primitive.NewObjectID()
+
+	mt.Run("mark as read", func(mt *mtest.T) {
+		rt := newRouteTest(mt.T, mt)
+		chatID := primitive.NewObjectID()
+		w := rt.serve(mt.T, http.MethodPost, "/api/v1/messages/read", `{"chat_id":"`+chatID.Hex()+`"}`,
+			chatDoc(chatID, "group", "", otherID))
+		expectNotMember(mt.T, w)
+	})
+
+	mt.Run("forward to a chat of others", func(mt *mtest.T) {
+		rt := newRouteTest(mt.T, mt)
+		sourceID, targetID, messageID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		w := rt.serve(mt.T, http.MethodPost, "/api/v1/messages/"+messageID.Hex()+"/forward", `{"chat_ids":["`+targetID.Hex()+`"]}`,
+			messageDoc(messageID, sourceID),
+			chatDoc(sourceID, "group", "", rt.userID, otherID),
+			messageDoc(messageID, sourceID),
+			chatDoc(targetID, "group", "", otherID),
+		)
+		expectNotMember(mt.T, w)
+	})
+
+	mt.Run("forward into a public channel the caller only reads", func(mt *mtest.T) {
+		rt := newRouteTest(mt.T, mt)
+		channelID, messageID := primitive.NewObjectID(), primitive.NewObjectID()
+		channel := chatDoc(channelID, "channel", "news", otherID)
+		w := rt.serve(mt.T, http.MethodPost, "/api/v1/messages/"+messageID.Hex()+"/forward", `{"chat_ids":["`+channelID.Hex()+`"]}`,
+			messageDoc(messageID, channelID),
+			channel,
+			nil, // not banned
+			messageDoc(messageID, channelID),
+			channel,
+		)
+		expectNotMember(mt.T, w)
+	})
+
+	mt.Run("search", func(mt *mtest.T) {
+		rt := newRouteTest(mt.T, mt)
+		chatID := primitive.NewObjectID()
+		w := rt.serve(mt.T, http.MethodGet, "/api/v1/messages/search?q=hello&chat_id="+chatID.Hex(), "",
+			chatDoc(chatID, "group", "", otherID))
+		expectNotMember(mt.T, w)
+	})
+
+	mt.Run("call", func(mt *mtest.T) {
+		rt := newRouteTest(mt.T, mt)
+		chatID := primitive.NewObjectID()
+		w := rt.serve(mt.T, http.MethodPost, "/api/v1/calls", `{"type":"voice","chat_id":"`+chatID.Hex()+`"}`,
+			chatDoc(chatID, "direct", "", otherID, primitive.NewObjectID()))
+		expectNotMember(mt.T, w)
+	})
+}
@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Allowed range for the inactive-account self-destruct TTL, in days. 0 disables it.
+const (
+	MinSelfDestructTTL = 30
+	MaxSelfDestructTTL = 730
+)
+
+// ValidSelfDestructTTL reports whether days is an accepted self-destruct TTL.
+func ValidSelfDestructTTL(days int) bool {
+	return days == 0 || (days >= MinSelfDestructTTL && days <= MaxSelfDestructTTL)
+}
+
+// Allowed range for the idle auto-logout, in minutes. 0 disables it.
+const (
+	MinAutoLogout = 5
+	MaxAutoLogout = 365 * 24 * 60
+)
+
+// ValidAutoLogout reports whether minutes is an accepted auto-logout period.
+func ValidAutoLogout(minutes int) bool {
+	return minutes == 0 || (minutes >= MinAutoLogout && minutes <= MaxAutoLogout)
+}
+
+// AccountStatus returns the user's account status: active, suspended or
+// deleted. Users created before statuses existed count as active.
+func AccountStatus(ctx context.Context, db *database.Database, userID primitive.ObjectID) (string, error) {
+	var user struct {
+		AccountStatus string `bson:"account_status"`
+	}
+	err := db.MongoDB.Collection("users").FindOne(
+		ctx,
+		bson.M{"_id": userID},
+		options.FindOne().SetProjection(bson.M{"account_status": 1}),
+	).Decode(&user)
+	if err != nil {
+		return "", err
+	}
+	if user.AccountStatus == "" {
+		return "active", nil
+	}
+	return user.AccountStatus, nil
+}
+
+// TouchUser records activity on the user, which postpones self-destruction.
+func TouchUser(ctx context.Context, db *database.Database, userID primitive.ObjectID) error {
+	_, err := db.MongoDB.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"last_active": time.Now()}},
+	)
+	return err
+}
+
+// DeleteAccountData permanently removes a user and everything they own:
+// sessions and credentials, settings, contacts, messages, products, comments,
+// likes, proposals, calls, the service chat and the username. The user is also removed
+// from all other chats, after handing over the groups and channels they own.
+func DeleteAccountData(ctx context.Context, db *database.Database, userID primitive.ObjectID) error {
+	mongoDB := db.MongoDB
+
+	// Credentials first so no session survives a partial failure
+	byUser := bson.M{"user_id": userID}
+	for _, name := range []string{"sessions", "refresh_tokens", "auth_challenges", "email_codes", "qr_login_tokens", "passkeys", "webauthn_challenges"} {
+		if _, err := mongoDB.Collection(name).DeleteMany(ctx, byUser); err != nil {
+			return err
+		}
+	}
+
+	// Products and everything attached to them
+	cursor, err := mongoDB.Collection("products").Find(ctx, bson.M{"owner_id": userID})
+	if err != nil {
+		return err
+	}
+	var products []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &products); err != nil {
+		return err
+	}
+	if len(products) > 0 {
+		productIDs := make([]primitive.ObjectID, 0, len(products))
+		for _, p := range products {
+			productIDs = append(productIDs, p.ID)
+		}
+		byProduct := bson.M{"product_id": bson.M{"$in": productIDs}}
+		if _, err := mongoDB.Collection("comments").DeleteMany(ctx, byProduct); err != nil {
+			return err
+		}
+		if _, err := mongoDB.Collection("likes").DeleteMany(ctx, byProduct); err != nil {
+			return err
+		}
+		if _, err := mongoDB.Collection("products").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": productIDs}}); err != nil {
+			return err
+		}
+	}
+
+	deletes := []struct {
+		collection string
+		filter     bson.M
+	}{
+		{"user_settings", byUser},
+		{"contacts", bson.M{"$or": []bson.M{{"user_id": userID}, {"contact_id": userID}}}},
+		{"messages", bson.M{"sender_id": userID}},
+		{"comments", byUser},
+		{"likes", byUser},
+		{"proposals", bson.M{"$or": []bson.M{{"sender_id": userID}, {"receiver_id": userID}}}},
+		{"calls", bson.M{"caller_id": userID}},
+		{"typing_indicators", byUser},
+		{"qr_code_cache", bson.M{"user_id": userID.Hex()}},
+	}
+	for _, d := range deletes {
+		if _, err := mongoDB.Collection(d.collection).DeleteMany(ctx, d.filter); err != nil {
+			return err
+		}
+	}
+
+	// The service chat only ever belongs to this user
+	var serviceChat struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err = mongoDB.Collection("chats").FindOneAndDelete(ctx, bson.M{"type": "service", "members": userID}).Decode(&serviceChat)
+	if err == nil {
+		if _, err := mongoDB.Collection("messages").DeleteMany(ctx, bson.M{"chat_id": serviceChat.ID}); err != nil {
+			return err
+		}
+	} else if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	if err := handOverOwnedChats(ctx, db, userID); err != nil {
+		return err
+	}
+
+	_, err = mongoDB.Collection("chats").UpdateMany(
+		ctx,
+		bson.M{"$or": []bson.M{{"members": userID}, {"admins.user_id": userID}}},
+		bson.M{"$pull": bson.M{
+			"members": userID,
+			"admins":  bson.M{"user_id": userID},
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := ReleaseUsername(ctx, db, "user", userID); err != nil {
+		return err
+	}
+
+	_, err = mongoDB.Collection("users").DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
+
+// handOverOwnedChats keeps the groups and channels the user owns usable once
+// the user is gone: ownership passes to another admin, or to another member
+// if there is no admin. Chats with no one else in them are deleted.
+func handOverOwnedChats(ctx context.Context, db *database.Database, userID primitive.ObjectID) error {
+	chatsColl := db.MongoDB.Collection("chats")
+	cursor, err := chatsColl.Find(ctx, bson.M{
+		"admins": bson.M{"$elemMatch": bson.M{"user_id": userID, "role": "owner"}},
+	})
+	if err != nil {
+		return err
+	}
+	var chats []models.Chat
+	if err := cursor.All(ctx, &chats); err != nil {
+		return err
+	}
+
+	for i := range chats {
+		chat := &chats[i]
+		successor := primitive.NilObjectID
+		for _, admin := range chat.Admins {
+			if admin.UserID != userID && IsChatMember(chat, admin.UserID) {
+				successor = admin.UserID
+				break
+			}
+		}
+		if successor.IsZero() {
+			for _, member := range chat.Members {
+				if member != userID {
+					successor = member
+					break
+				}
+			}
+		}
+
+		if successor.IsZero() {
+			if _, err := chatsColl.DeleteOne(ctx, bson.M{"_id": chat.ID}); err != nil {
+				return err
+			}
+			if _, err := db.MongoDB.Collection("messages").DeleteMany(ctx, bson.M{"chat_id": chat.ID}); err != nil {
+				return err
+			}
+			if err := ReleaseUsername(ctx, db, chat.Type, chat.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		now := time.Now()
+		admins := make([]models.AdminRole, 0, len(chat.Admins)+1)
+		for _, admin := range chat.Admins {
+			if admin.UserID != userID && admin.UserID != successor {
+				admins = append(admins, admin)
+			}
+		}
+		admins = append(admins, models.AdminRole{
+			UserID:      successor,
+			Role:        "owner",
+			Permissions: []models.AdminPermission{models.PermAll},
+			GrantedAt:   now,
+			GrantedBy:   userID,
+		})
+		_, err := chatsColl.UpdateOne(
+			ctx,
+			bson.M{"_id": chat.ID},
+			bson.M{"$set": bson.M{"admins": admins, "updated_at": now}},
+		)
+		if err != nil {
+			return err
+		}
+		LogMemberEvent(ctx, db, chat.ID, userID, models.EventOwnershipTransferred, successor)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+
+	"chat-backend/internal/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IsBlocked reports whether either user blocked the other. Blocks apply both
+// ways: neither user can reach the other.
+func IsBlocked(ctx context.Context, db *database.Database, a, b primitive.ObjectID) (bool, error) {
+	count, err := db.MongoDB.Collection("user_settings").CountDocuments(ctx, bson.M{"$or": []bson.M{
+		{"user_id": a, "privacy.blocked_users": b},
+		{"user_id": b, "privacy.blocked_users": a},
+	}}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// BlockedWith returns the users the user blocked or was blocked by.
+func BlockedWith(ctx context.Context, db *database.Database, userID primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	blocked := make(map[primitive.ObjectID]bool)
+
+	blockers, err := db.MongoDB.Collection("user_settings").Distinct(ctx, "user_id", bson.M{"privacy.blocked_users": userID})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range blockers {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			blocked[oid] = true
+		}
+	}
+
+	own, err := db.MongoDB.Collection("user_settings").Distinct(ctx, "privacy.blocked_users", bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range own {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			blocked[oid] = true
+		}
+	}
+	return blocked, nil
+}
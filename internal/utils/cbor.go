@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	errCBORTruncated   = errors.New("cbor: unexpected end of data")
+	errCBORUnsupported = errors.New("cbor: unsupported encoding")
+)
+
+// maxCBORDepth bounds nesting so hostile input cannot exhaust the stack.
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first CBOR (RFC 8949) data item in data and returns
+// it with the number of bytes it used. Only what WebAuthn attestation objects
+// and COSE keys need is supported: integers (int64), byte strings ([]byte),
+// text strings, arrays, maps keyed by integers or text, booleans and null.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, d.pos, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// head reads an item's initial byte and argument.
+func (d *cborDecoder) head() (major, info byte, arg uint64, err error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, 0, errCBORTruncated
+	}
+	b := d.data[d.pos]
+	d.pos++
+	major, info = b>>5, b&0x1f
+
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		n := 1 << (info - 24)
+		if len(d.data)-d.pos < n {
+			return 0, 0, 0, errCBORTruncated
+		}
+		for _, c := range d.data[d.pos : d.pos+n] {
+			arg = arg<<8 | uint64(c)
+		}
+		d.pos += n
+	default:
+		// Indefinite lengths and reserved values
+		return 0, 0, 0, errCBORUnsupported
+	}
+	return major, info, arg, nil
+}
+
+// remaining reports whether at least n more bytes are available; every item
+// takes at least one byte, which bounds declared lengths before allocating.
+func (d *cborDecoder) remaining(n uint64) bool {
+	return n <= uint64(len(d.data)-d.pos)
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > maxCBORDepth {
+		return nil, errCBORUnsupported
+	}
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, errCBORUnsupported
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, errCBORUnsupported
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		if !d.remaining(arg) {
+			return nil, errCBORTruncated
+		}
+		b := d.data[d.pos : d.pos+int(arg)]
+		d.pos += int(arg)
+		if major == 3 {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case 4:
+		if !d.remaining(arg) {
+			return nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case 5:
+		if !d.remaining(arg) {
+			return nil, errCBORTruncated
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, errCBORUnsupported
+			}
+			val, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = val
+		}
+		return m, nil
+	case 7:
+		if info < 24 {
+			switch arg {
+			case 20:
+				return false, nil
+			case 21:
+				return true, nil
+			case 22:
+				return nil, nil
+			}
+		}
+	}
+	// Tags, floats and other simple values
+	return nil, errCBORUnsupported
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotChatMember is returned when a user tries to use a chat they do not
+// belong to.
+var ErrNotChatMember = errors.New("not a member of this chat")
+
+// IsChatMember reports whether the user belongs to the chat.
+func IsChatMember(chat *models.Chat, userID primitive.ObjectID) bool {
+	for _, member := range chat.Members {
+		if member == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// CanReadChat reports whether the user may read the chat: members can, and
+// so can anyone for channels with a public username.
+func CanReadChat(chat *models.Chat, userID primitive.ObjectID) bool {
+	if IsChatMember(chat, userID) {
+		return true
+	}
+	return chat.Type == "channel" && chat.PublicLink != ""
+}
+
+// ChatForMember loads a chat the user belongs to. mongo.ErrNoDocuments is
+// returned when the chat does not exist and ErrNotChatMember when the user
+// is not in it.
+func ChatForMember(ctx context.Context, db *database.Database, chatID, userID primitive.ObjectID) (*models.Chat, error) {
+	return chatFor(ctx, db, chatID, userID, IsChatMember)
+}
+
+// ChatForReader is ChatForMember for read-only access, see CanReadChat.
+// Users banned from a public channel cannot read it either.
+func ChatForReader(ctx context.Context, db *database.Database, chatID, userID primitive.ObjectID) (*models.Chat, error) {
+	chat, err := chatFor(ctx, db, chatID, userID, CanReadChat)
+	if err != nil || IsChatMember(chat, userID) {
+		return chat, err
+	}
+	ban, err := ActiveBan(ctx, db, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if ban != nil {
+		return nil, ErrNotChatMember
+	}
+	return chat, nil
+}
+
+func chatFor(ctx context.Context, db *database.Database, chatID, userID primitive.ObjectID, allowed func(*models.Chat, primitive.ObjectID) bool) (*models.Chat, error) {
+	var chat models.Chat
+	if err := db.MongoDB.Collection("chats").FindOne(ctx, bson.M{"_id": chatID}).Decode(&chat); err != nil {
+		return nil, err
+	}
+	if !allowed(&chat, userID) {
+		return nil, ErrNotChatMember
+	}
+	return &chat, nil
+}
+
+// MemberChatIDs returns the IDs of every chat the user belongs to.
+func MemberChatIDs(ctx context.Context, db *database.Database, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	ids, err := db.MongoDB.Collection("chats").Distinct(ctx, "_id", bson.M{"members": userID})
+	if err != nil {
+		return nil, err
+	}
+	chatIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			chatIDs = append(chatIDs, oid)
+		}
+	}
+	return chatIDs, nil
+}
+
+// DirectChat returns the direct chat between two users, creating it if they
+// have none yet.
+func DirectChat(ctx context.Context, db *database.Database, a, b primitive.ObjectID) (*models.Chat, error) {
+	var chat models.Chat
+	err := db.MongoDB.Collection("chats").FindOne(ctx, bson.M{
+		"type":    "direct",
+		"members": bson.M{"$all": []primitive.ObjectID{a, b}, "$size": 2},
+	}).Decode(&chat)
+	if err == nil {
+		return &chat, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	now := time.Now()
+	chat = models.Chat{
+		ID:        primitive.NewObjectID(),
+		Type:      "direct",
+		Members:   []primitive.ObjectID{a, b},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := db.MongoDB.Collection("chats").InsertOne(ctx, chat); err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"errors"
+
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AdminPermissions lists every permission an admin can be granted. Posting
+// and editing others' posts only apply to channels.
+var AdminPermissions = []models.AdminPermission{
+	models.PermChangeInfo,
+	models.PermDeleteMessages,
+	models.PermBanUsers,
+	models.PermInviteUsers,
+	models.PermPinMessages,
+	models.PermManageCalls,
+	models.PermAddAdmins,
+	models.PermPostMessages,
+	models.PermEditMessages,
+}
+
+// legacyAdminPermissions maps the free-form names stored before permissions
+// were typed.
+var legacyAdminPermissions = map[models.AdminPermission]models.AdminPermission{
+	"delete": models.PermDeleteMessages,
+	"ban":    models.PermBanUsers,
+	"invite": models.PermInviteUsers,
+	"pin":    models.PermPinMessages,
+}
+
+var (
+	ErrUnknownAdminPermission = errors.New("unknown admin permission")
+	ErrPermissionNotHeld      = errors.New("you cannot grant a permission you do not have")
+)
+
+// ValidateAdminPermissions checks that every permission is known and returns
+// them without duplicates.
+func ValidateAdminPermissions(permissions []models.AdminPermission) ([]models.AdminPermission, error) {
+	seen := make(map[models.AdminPermission]bool, len(permissions))
+	valid := make([]models.AdminPermission, 0, len(permissions))
+	for _, p := range permissions {
+		known := false
+		for _, q := range AdminPermissions {
+			if p == q {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, ErrUnknownAdminPermission
+		}
+		if !seen[p] {
+			seen[p] = true
+			valid = append(valid, p)
+		}
+	}
+	return valid, nil
+}
+
+// ChatAdmin returns the user's admin role in the chat, or nil.
+func ChatAdmin(chat *models.Chat, userID primitive.ObjectID) *models.AdminRole {
+	for i := range chat.Admins {
+		if chat.Admins[i].UserID == userID {
+			return &chat.Admins[i]
+		}
+	}
+	return nil
+}
+
+// IsChatOwner reports whether the user owns the chat.
+func IsChatOwner(chat *models.Chat, userID primitive.ObjectID) bool {
+	admin := ChatAdmin(chat, userID)
+	return admin != nil && admin.Role == "owner"
+}
+
+// HasAdminPermission reports whether the user is an admin of the chat who
+// holds the permission. Owners hold every permission.
+func HasAdminPermission(chat *models.Chat, userID primitive.ObjectID, permission models.AdminPermission) bool {
+	admin := ChatAdmin(chat, userID)
+	if admin == nil {
+		return false
+	}
+	if admin.Role == "owner" {
+		return true
+	}
+	for _, p := range admin.Permissions {
+		if legacy, ok := legacyAdminPermissions[p]; ok {
+			p = legacy
+		}
+		if p == permission || p == models.PermAll {
+			return true
+		}
+	}
+	return false
+}
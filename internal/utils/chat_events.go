@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"chat-backend/internal/config"
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultChatEventRetention matches CHAT_EVENT_RETENTION's default.
+const defaultChatEventRetention = 48 * time.Hour
+
+// chatEventRetention is set once by ConfigureChatEvents before serving.
+var chatEventRetention = defaultChatEventRetention
+
+// ConfigureChatEvents sets how long chat events are kept, once at startup.
+func ConfigureChatEvents(cfg *config.Config) error {
+	retention := defaultChatEventRetention
+	if cfg.ChatEventRetention != "" {
+		d, err := time.ParseDuration(cfg.ChatEventRetention)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("retention must be positive, got %s", d)
+		}
+		retention = d
+	}
+	chatEventRetention = retention
+	return nil
+}
+
+// LogChatEvent appends an event to the chat's log. Logging never fails the
+// action it records, so errors are only logged.
+func LogChatEvent(ctx context.Context, db *database.Database, event models.ChatEvent) {
+	event.ID = primitive.NewObjectID()
+	event.CreatedAt = time.Now()
+	event.ExpiresAt = event.CreatedAt.Add(chatEventRetention)
+	if _, err := db.MongoDB.Collection("chat_events").InsertOne(ctx, event); err != nil {
+		log.Printf("Failed to log %s event for chat %s: %v", event.Action, event.ChatID.Hex(), err)
+	}
+}
+
+// LogMemberEvent records an action by actor on a member of the chat.
+func LogMemberEvent(ctx context.Context, db *database.Database, chatID, actorID primitive.ObjectID, action string, targetID primitive.ObjectID) {
+	LogChatEvent(ctx, db, models.ChatEvent{
+		ChatID:       chatID,
+		ActorID:      actorID,
+		Action:       action,
+		TargetUserID: &targetID,
+	})
+}
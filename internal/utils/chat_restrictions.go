@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Names of the rights a message can need, as they appear in
+// GroupRestrictions' JSON.
+const (
+	RightSendMessages = "can_send_messages"
+	RightSendMedia    = "can_send_media"
+	RightSendLinks    = "can_send_links"
+	RightSendPolls    = "can_send_polls"
+)
+
+// mediaMessageTypes are the message types that need can_send_media.
+var mediaMessageTypes = map[string]bool{
+	"image":         true,
+	"audio":         true,
+	"video":         true,
+	"voice_message": true,
+	"video_message": true,
+	"file":          true,
+	"sticker":       true,
+	"gif":           true,
+	"music":         true,
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://|www\.|t\.me/)\S+|\b[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:com|net|org|io|me|app|dev|info|ru|az|tr|co|xyz|link|ly)\b`)
+
+// RestrictedError is returned when a member lacks the right to send a
+// message.
+type RestrictedError struct {
+	Right     string
+	UntilDate *time.Time // set when a member restriction is the cause
+}
+
+func (e *RestrictedError) Error() string {
+	return "you are not allowed to send this in the group (" + e.Right + ")"
+}
+
+// DefaultGroupRestrictions are the member rights of a group whose admins
+// never configured them: everything except changing the group info.
+func DefaultGroupRestrictions() models.GroupRestrictions {
+	return models.GroupRestrictions{
+		CanSendMessages: true,
+		CanSendMedia:    true,
+		CanSendLinks:    true,
+		CanSendPolls:    true,
+		CanInviteUsers:  true,
+	}
+}
+
+// EffectiveGroupRestrictions returns the rights members of the group have.
+// Groups created before restrictions were enforced stored them all unset,
+// which is not a choice anyone made, so they get the defaults.
+func EffectiveGroupRestrictions(chat *models.Chat) models.GroupRestrictions {
+	if chat.Restrictions.UpdatedAt == nil {
+		return DefaultGroupRestrictions()
+	}
+	return chat.Restrictions
+}
+
+// ActiveMemberRestriction returns the user's restriction in the chat, or nil
+// when there is none or it has expired.
+func ActiveMemberRestriction(ctx context.Context, db *database.Database, chatID, userID primitive.ObjectID) (*models.MemberRestriction, error) {
+	var restriction models.MemberRestriction
+	err := db.MongoDB.Collection("chat_restrictions").FindOne(ctx, bson.M{
+		"chat_id": chatID,
+		"user_id": userID,
+		"$or": []bson.M{
+			{"until_date": nil},
+			{"until_date": bson.M{"$gt": time.Now()}},
+		},
+	}).Decode(&restriction)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &restriction, nil
+}
+
+// ActiveBan returns the user's ban from the chat, or nil when they are not
+// banned.
+func ActiveBan(ctx context.Context, db *database.Database, chatID, userID primitive.ObjectID) (*models.MemberRestriction, error) {
+	restriction, err := ActiveMemberRestriction(ctx, db, chatID, userID)
+	if err != nil || restriction == nil || restriction.Kind != models.RestrictionBan {
+		return nil, err
+	}
+	return restriction, nil
+}
+
+// SaveMemberRestriction bans, mutes or restricts the user, replacing what
+// they had in the chat before. restriction is updated with the stored record.
+func SaveMemberRestriction(ctx context.Context, db *database.Database, restriction *models.MemberRestriction) error {
+	return db.MongoDB.Collection("chat_restrictions").FindOneAndUpdate(
+		ctx,
+		bson.M{"chat_id": restriction.ChatID, "user_id": restriction.UserID},
+		bson.M{"$set": bson.M{
+			"kind":          restriction.Kind,
+			"rights":        restriction.Rights,
+			"until_date":    restriction.UntilDate,
+			"restricted_by": restriction.RestrictedBy,
+			"created_at":    restriction.CreatedAt,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(restriction)
+}
+
+// MemberRights returns what the user may do in the group: the group's
+// restrictions narrowed by their own, if any. Admins may always send, and
+// may change the info or invite users when members may or their admin
+// permissions allow it. The restriction is returned too so callers can tell
+// when it ends.
+func MemberRights(ctx context.Context, db *database.Database, chat *models.Chat, userID primitive.ObjectID) (models.GroupRestrictions, *models.MemberRestriction, error) {
+	if ChatAdmin(chat, userID) != nil {
+		members := EffectiveGroupRestrictions(chat)
+		return models.GroupRestrictions{
+			CanSendMessages: true,
+			CanSendMedia:    true,
+			CanSendLinks:    true,
+			CanSendPolls:    true,
+			CanChangeInfo:   members.CanChangeInfo || HasAdminPermission(chat, userID, models.PermChangeInfo),
+			CanInviteUsers:  members.CanInviteUsers || HasAdminPermission(chat, userID, models.PermInviteUsers),
+		}, nil, nil
+	}
+
+	rights := EffectiveGroupRestrictions(chat)
+	restriction, err := ActiveMemberRestriction(ctx, db, chat.ID, userID)
+	if err != nil || restriction == nil {
+		return rights, nil, err
+	}
+	if restriction.Kind == models.RestrictionBan || restriction.Kind == models.RestrictionMute {
+		restriction.Rights = models.GroupRestrictions{}
+	}
+	rights.CanSendMessages = rights.CanSendMessages && restriction.Rights.CanSendMessages
+	rights.CanSendMedia = rights.CanSendMedia && restriction.Rights.CanSendMedia
+	rights.CanSendLinks = rights.CanSendLinks && restriction.Rights.CanSendLinks
+	rights.CanSendPolls = rights.CanSendPolls && restriction.Rights.CanSendPolls
+	rights.CanChangeInfo = rights.CanChangeInfo && restriction.Rights.CanChangeInfo
+	rights.CanInviteUsers = rights.CanInviteUsers && restriction.Rights.CanInviteUsers
+	return rights, restriction, nil
+}
+
+// ContainsLink reports whether the message carries a link, in its text,
+// formatting or preview.
+func ContainsLink(message *models.Message) bool {
+	if message.LinkPreview != nil {
+		return true
+	}
+	if len(message.Formatting.Links) > 0 {
+		return true
+	}
+	return linkPattern.MatchString(message.Content)
+}
+
+// RequiredRights lists the rights needed to send the message.
+func RequiredRights(message *models.Message) []string {
+	rights := []string{RightSendMessages}
+	if mediaMessageTypes[message.MessageType] {
+		rights = append(rights, RightSendMedia)
+	}
+	if message.MessageType == "poll" || message.Poll != nil {
+		rights = append(rights, RightSendPolls)
+	}
+	if ContainsLink(message) {
+		rights = append(rights, RightSendLinks)
+	}
+	return rights
+}
+
+// CheckSendRights returns a *RestrictedError if the user may not send the
+// message to the chat. Only groups have member restrictions.
+func CheckSendRights(ctx context.Context, db *database.Database, chat *models.Chat, userID primitive.ObjectID, message *models.Message) error {
+	if chat.Type != "group" {
+		return nil
+	}
+	rights, restriction, err := MemberRights(ctx, db, chat, userID)
+	if err != nil {
+		return err
+	}
+	allowed := map[string]bool{
+		RightSendMessages: rights.CanSendMessages,
+		RightSendMedia:    rights.CanSendMedia,
+		RightSendLinks:    rights.CanSendLinks,
+		RightSendPolls:    rights.CanSendPolls,
+	}
+	for _, right := range RequiredRights(message) {
+		if allowed[right] {
+			continue
+		}
+		denied := &RestrictedError{Right: right}
+		if restriction != nil && !memberRestrictionAllows(restriction, right) {
+			denied.UntilDate = restriction.UntilDate
+		}
+		return denied
+	}
+	return nil
+}
+
+func memberRestrictionAllows(restriction *models.MemberRestriction, right string) bool {
+	switch right {
+	case RightSendMessages:
+		return restriction.Rights.CanSendMessages
+	case RightSendMedia:
+		return restriction.Rights.CanSendMedia
+	case RightSendLinks:
+		return restriction.Rights.CanSendLinks
+	case RightSendPolls:
+		return restriction.Rights.CanSendPolls
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemberRightsLimitedAdmin(t *testing.T) {
+	adminID := primitive.NewObjectID()
+	now := time.Now()
+	chat := &models.Chat{
+		ID:   primitive.NewObjectID(),
+		Type: "group",
+		// Members may only send messages
+		Restrictions: models.GroupRestrictions{CanSendMessages: true, UpdatedAt: &now},
+		Admins: []models.AdminRole{
+			{UserID: adminID, Role: "admin", Permissions: []models.AdminPermission{models.PermPinMessages}},
+		},
+	}
+
+	rights, _, err := MemberRights(context.Background(), nil, chat, adminID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rights.CanChangeInfo || rights.CanInviteUsers {
+		t.Fatalf("admin without change_info or invite_users got %+v", rights)
+	}
+	if !rights.CanSendMessages || !rights.CanSendMedia || !rights.CanSendLinks || !rights.CanSendPolls {
+		t.Fatalf("admin cannot send: %+v", rights)
+	}
+
+	chat.Admins[0].Permissions = []models.AdminPermission{models.PermChangeInfo, models.PermInviteUsers}
+	rights, _, _ = MemberRights(context.Background(), nil, chat, adminID)
+	if !rights.CanChangeInfo || !rights.CanInviteUsers {
+		t.Fatalf("admin with change_info and invite_users got %+v", rights)
+	}
+
+	// Admins can do what every member can
+	chat.Admins[0].Permissions = nil
+	chat.Restrictions.CanInviteUsers = true
+	rights, _, _ = MemberRights(context.Background(), nil, chat, adminID)
+	if !rights.CanInviteUsers || rights.CanChangeInfo {
+		t.Fatalf("admin without permissions got %+v", rights)
+	}
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// validDeviceTypes are the device types a client may report.
+var validDeviceTypes = map[string]bool{
+	"mobile":  true,
+	"tablet":  true,
+	"desktop": true,
+	"web":     true,
+}
+
+// DeviceType returns the reported device type if it is valid, otherwise a
+// best guess from the user agent.
+func DeviceType(reported, userAgent string) string {
+	reported = strings.ToLower(strings.TrimSpace(reported))
+	if validDeviceTypes[reported] {
+		return reported
+	}
+
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return "tablet"
+	case strings.Contains(ua, "mobile") || strings.Contains(ua, "iphone") ||
+		strings.Contains(ua, "android") || strings.Contains(ua, "okhttp") || strings.Contains(ua, "dart"):
+		return "mobile"
+	case strings.Contains(ua, "electron"):
+		return "desktop"
+	case strings.Contains(ua, "mozilla"):
+		return "web"
+	}
+	return "desktop"
+}
+
+// DeviceID returns the client-provided device ID, or one derived from the
+// user agent for clients that do not send X-Device-ID. The ID only names the
+// device; KnownDevice requires the device secret as proof.
+func DeviceID(reported, userAgent string) string {
+	reported = strings.TrimSpace(reported)
+	if reported != "" {
+		if len(reported) > 128 {
+			reported = reported[:128]
+		}
+		return reported
+	}
+	sum := sha256.Sum256([]byte(userAgent))
+	return "ua-" + hex.EncodeToString(sum[:8])
+}
+
+// KnownDevice reports whether the device is in the user's device registry and
+// the client presented the secret that was issued to it.
+func KnownDevice(user models.User, deviceID, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	hash := HashToken(secret)
+	for _, device := range user.ActiveDevices {
+		if device.DeviceID == deviceID && device.SecretHash != "" &&
+			subtle.ConstantTimeCompare([]byte(device.SecretHash), []byte(hash)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordDevice adds the device to the user's registry or refreshes its
+// details and last activity. A non-empty secretHash replaces the device secret.
+func RecordDevice(ctx context.Context, db *database.Database, userID primitive.ObjectID, info SessionInfo, secretHash string) error {
+	if info.DeviceID == "" {
+		return nil
+	}
+	users := db.MongoDB.Collection("users")
+	now := time.Now()
+
+	set := bson.M{
+		"active_devices.$.device_name": info.DeviceName,
+		"active_devices.$.device_type": info.DeviceType,
+		"active_devices.$.ip_address":  info.IPAddress,
+		"active_devices.$.user_agent":  info.UserAgent,
+		"active_devices.$.last_active": now,
+	}
+	if secretHash != "" {
+		set["active_devices.$.secret_hash"] = secretHash
+	}
+	result, err := users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "active_devices.device_id": info.DeviceID},
+		bson.M{"$set": set},
+	)
+	if err != nil || result.MatchedCount > 0 {
+		return err
+	}
+
+	_, err = users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "active_devices.device_id": bson.M{"$ne": info.DeviceID}},
+		bson.M{"$push": bson.M{"active_devices": models.DeviceInfo{
+			DeviceID:   info.DeviceID,
+			DeviceName: info.DeviceName,
+			DeviceType: info.DeviceType,
+			IPAddress:  info.IPAddress,
+			UserAgent:  info.UserAgent,
+			LastActive: now,
+			SecretHash: secretHash,
+		}}},
+	)
+	return err
+}
+
+// touchDevice records activity on a registered device.
+func touchDevice(ctx context.Context, db *database.Database, userID primitive.ObjectID, deviceID string, now time.Time) error {
+	_, err := db.MongoDB.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "active_devices.device_id": deviceID},
+		bson.M{"$set": bson.M{"active_devices.$.last_active": now}},
+	)
+	return err
+}
+
+// ForgetDevice removes a device from the registry once none of the user's
+// sessions use it anymore.
+func ForgetDevice(ctx context.Context, db *database.Database, userID primitive.ObjectID, deviceID string) error {
+	count, err := db.MongoDB.Collection("sessions").CountDocuments(ctx, bson.M{
+		"user_id":    userID,
+		"device_id":  deviceID,
+		"revoked":    false,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = db.MongoDB.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$pull": bson.M{"active_devices": bson.M{"device_id": deviceID}}},
+	)
+	return err
+}
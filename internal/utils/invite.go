@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrInviteLinkInvalid is returned for invite links that are unknown,
+// revoked, expired or used up.
+var ErrInviteLinkInvalid = errors.New("invite link is invalid or expired")
+
+// GenerateInviteCode returns a random code for an invite link.
+func GenerateInviteCode() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// InviteLinkUsable reports whether people can still join through the link.
+func InviteLinkUsable(link *models.InviteLink) bool {
+	if link.Revoked {
+		return false
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return false
+	}
+	return link.MemberLimit == 0 || link.UsageCount < link.MemberLimit
+}
+
+// ActiveInviteLink loads a usable invite link by its code.
+func ActiveInviteLink(ctx context.Context, db *database.Database, code string) (*models.InviteLink, error) {
+	var link models.InviteLink
+	err := db.MongoDB.Collection("invite_links").FindOne(ctx, bson.M{"code": code}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInviteLinkInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !InviteLinkUsable(&link) {
+		return nil, ErrInviteLinkInvalid
+	}
+	return &link, nil
+}
+
+// UseInviteLink counts a join against the link, failing with
+// ErrInviteLinkInvalid if it stopped being usable in the meantime.
+func UseInviteLink(ctx context.Context, db *database.Database, link *models.InviteLink) error {
+	filter := bson.M{
+		"_id":     link.ID,
+		"revoked": false,
+		"$and": []bson.M{
+			{"$or": []bson.M{{"expires_at": nil}, {"expires_at": bson.M{"$gt": time.Now()}}}},
+			{"$or": []bson.M{{"member_limit": 0}, {"$expr": bson.M{"$lt": []string{"$usage_count", "$member_limit"}}}}},
+		},
+	}
+	result, err := db.MongoDB.Collection("invite_links").UpdateOne(ctx, filter, bson.M{
+		"$inc": bson.M{"usage_count": 1},
+		"$set": bson.M{"updated_at": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInviteLinkInvalid
+	}
+	return nil
+}
+
+// AddChatMember adds the user to the group or channel, counting channel
+// subscribers. It reports whether the user was not a member yet.
+func AddChatMember(ctx context.Context, db *database.Database, chat *models.Chat, userID primitive.ObjectID) (bool, error) {
+	update := bson.M{
+		"$addToSet": bson.M{"members": userID},
+		"$set":      bson.M{"updated_at": time.Now()},
+	}
+	if chat.Type == "channel" {
+		update["$inc"] = bson.M{"subscriber_count": 1}
+	}
+	result, err := db.MongoDB.Collection("chats").UpdateOne(
+		ctx,
+		bson.M{"_id": chat.ID, "members": bson.M{"$ne": userID}},
+		update,
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// SendChatInvite sends the user a single-use invite link to the chat in a
+// direct message from the inviter, for users whose privacy settings keep
+// the inviter from adding them.
+func SendChatInvite(ctx context.Context, db *database.Database, chat *models.Chat, inviterID, userID primitive.ObjectID) (*models.Message, error) {
+	code, err := GenerateInviteCode()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	link := models.InviteLink{
+		ID:          primitive.NewObjectID(),
+		ChatID:      chat.ID,
+		Code:        code,
+		Name:        "Invitation",
+		CreatorID:   inviterID,
+		MemberLimit: 1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := db.MongoDB.Collection("invite_links").InsertOne(ctx, link); err != nil {
+		return nil, err
+	}
+
+	direct, err := DirectChat(ctx, db, inviterID, userID)
+	if err != nil {
+		return nil, err
+	}
+	message := models.Message{
+		ID:          primitive.NewObjectID(),
+		ChatID:      direct.ID,
+		SenderID:    inviterID,
+		Content:     chat.GroupName,
+		MessageType: "invite",
+		Status:      "sent",
+		Invite: &models.ChatInvite{
+			ChatID: chat.ID,
+			Type:   chat.Type,
+			Title:  chat.GroupName,
+			Code:   code,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := db.MongoDB.Collection("messages").InsertOne(ctx, message); err != nil {
+		return nil, err
+	}
+
+	_, err = db.MongoDB.Collection("chats").UpdateOne(
+		ctx,
+		bson.M{"_id": direct.ID},
+		bson.M{"$set": bson.M{
+			"last_message_id": message.ID,
+			"last_message_at": now,
+			"updated_at":      now,
+		}},
+	)
+	return &message, err
+}
@@ -1,7 +1,18 @@
 package utils
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"chat-backend/internal/config"
@@ -11,33 +22,207 @@ import (
 )
 
 type Claims struct {
-	UserID primitive.ObjectID `json:"user_id"`
+	UserID    primitive.ObjectID `json:"user_id"`
+	SessionID primitive.ObjectID `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID primitive.ObjectID) (string, error) {
-	cfg := config.Load()
-	
-	expirationTime := time.Now().Add(24 * time.Hour)
+// AccessTokenTTL returns the configured access token lifetime (15 minutes if unset or invalid).
+func AccessTokenTTL(cfg *config.Config) time.Duration {
+	ttl, err := time.ParseDuration(cfg.JWTExpiration)
+	if err != nil || ttl <= 0 {
+		return 15 * time.Minute
+	}
+	return ttl
+}
+
+// verificationKey is a key tokens may be verified with, identified by its kid.
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// JWTKeys signs access tokens with one key and verifies them against every
+// configured key, so a new signing key can be rolled out while tokens signed
+// by the previous one are still valid.
+type JWTKeys struct {
+	method  jwt.SigningMethod
+	signKID string
+	signKey interface{}
+	verify  map[string]verificationKey
+	ttl     time.Duration
+}
+
+// LoadJWTKeys builds the key set from configuration. HS256 uses JWT_SECRET;
+// RS256 and EdDSA use a PEM private key plus optional older public keys.
+func LoadJWTKeys(cfg *config.Config) (*JWTKeys, error) {
+	keys := &JWTKeys{
+		verify: make(map[string]verificationKey),
+		ttl:    AccessTokenTTL(cfg),
+	}
+
+	switch strings.ToUpper(cfg.JWTAlgorithm) {
+	case "", "HS256":
+		if cfg.JWTSecret == "" {
+			return nil, errors.New("JWT_SECRET is required for HS256")
+		}
+		keys.method = jwt.SigningMethodHS256
+		keys.signKID = "hs256"
+		keys.signKey = []byte(cfg.JWTSecret)
+		keys.verify[keys.signKID] = verificationKey{method: keys.method, key: keys.signKey}
+		return keys, nil
+	case "RS256":
+		keys.method = jwt.SigningMethodRS256
+	case "EDDSA":
+		keys.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q (use HS256, RS256 or EdDSA)", cfg.JWTAlgorithm)
+	}
+
+	pemData, err := readPEM(cfg.JWTPrivateKey, cfg.JWTPrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if pemData == nil {
+		return nil, fmt.Errorf("JWT_PRIVATE_KEY or JWT_PRIVATE_KEY_FILE is required for %s", keys.method.Alg())
+	}
+
+	var public crypto.PublicKey
+	if keys.method == jwt.SigningMethodRS256 {
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA private key: %w", err)
+		}
+		keys.signKey, public = private, &private.PublicKey
+	} else {
+		private, err := jwt.ParseEdPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ed25519 private key: %w", err)
+		}
+		edPrivate, ok := private.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("EdDSA private key must be Ed25519")
+		}
+		keys.signKey, public = edPrivate, edPrivate.Public()
+	}
+
+	keys.signKID = cfg.JWTKeyID
+	if keys.signKID == "" {
+		keys.signKID = keyThumbprint(public)
+	}
+	keys.verify[keys.signKID] = verificationKey{method: keys.method, key: public}
+
+	// Previous keys stay valid for verification until their tokens expire
+	for _, entry := range strings.Split(cfg.JWTVerificationKeyFiles, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// Either "path" (kid is the thumbprint) or "kid=path"
+		kid, path := "", entry
+		if i := strings.Index(entry, "="); i > 0 {
+			kid, path = entry[:i], entry[i+1:]
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read verification key %s: %w", path, err)
+		}
+		key, err := parsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid verification key %s: %w", path, err)
+		}
+		if kid == "" {
+			kid = keyThumbprint(key.key)
+		}
+		keys.verify[kid] = key
+	}
+
+	return keys, nil
+}
+
+func readPEM(inline, path string) ([]byte, error) {
+	if inline != "" {
+		// Environment variables often carry escaped newlines
+		return []byte(strings.ReplaceAll(inline, `\n`, "\n")), nil
+	}
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	return nil, nil
+}
+
+func parsePublicKey(data []byte) (verificationKey, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return verificationKey{method: jwt.SigningMethodRS256, key: key}, nil
+	}
+	key, err := jwt.ParseEdPublicKeyFromPEM(data)
+	if err != nil {
+		return verificationKey{}, errors.New("not an RSA or Ed25519 public key")
+	}
+	return verificationKey{method: jwt.SigningMethodEdDSA, key: key}, nil
+}
+
+// jwk returns the public JSON Web Key fields (without kid, alg and use).
+func jwk(key crypto.PublicKey) map[string]string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(k),
+		}
+	}
+	return nil
+}
+
+// keyThumbprint is the RFC 7638 JWK thumbprint, used as the default kid.
+func keyThumbprint(key crypto.PublicKey) string {
+	// json.Marshal sorts map keys, which gives the canonical member order
+	data, _ := json.Marshal(jwk(key))
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Sign issues an access token for the session.
+func (k *JWTKeys) Sign(userID, sessionID primitive.ObjectID) (string, error) {
+	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(now.Add(k.ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(cfg.JWTSecret))
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.signKID
+	return token.SignedString(k.signKey)
 }
 
-func ValidateToken(tokenString string) (*Claims, error) {
-	cfg := config.Load()
-	
+// Parse verifies a token against the key named by its kid header.
+func (k *JWTKeys) Parse(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(cfg.JWTSecret), nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" && k.method == jwt.SigningMethodHS256 {
+			kid = k.signKID // tokens issued before kids were added
+		}
+		key, ok := k.verify[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.key, nil
+	}, jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}))
 
 	if err != nil {
 		return nil, err
@@ -50,7 +235,72 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
+// JWKS returns the public verification keys as a JSON Web Key Set. Shared
+// secrets (HS256) are never published.
+func (k *JWTKeys) JWKS() map[string]interface{} {
+	set := []map[string]string{}
+	for kid, key := range k.verify {
+		fields := jwk(key.key)
+		if fields == nil {
+			continue
+		}
+		fields["kid"] = kid
+		fields["alg"] = key.method.Alg()
+		fields["use"] = "sig"
+		set = append(set, fields)
+	}
+	return map[string]interface{}{"keys": set}
+}
+
+var (
+	jwtKeysMu sync.RWMutex
+	jwtKeys   *JWTKeys
+)
+
+// ConfigureJWT loads the key set once at startup for GenerateToken and
+// ValidateToken.
+func ConfigureJWT(cfg *config.Config) (*JWTKeys, error) {
+	keys, err := LoadJWTKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+	jwtKeysMu.Lock()
+	jwtKeys = keys
+	jwtKeysMu.Unlock()
+	return keys, nil
+}
 
+func currentJWTKeys() (*JWTKeys, error) {
+	jwtKeysMu.RLock()
+	keys := jwtKeys
+	jwtKeysMu.RUnlock()
+	if keys != nil {
+		return keys, nil
+	}
+	return ConfigureJWT(config.Load())
+}
 
+func GenerateToken(userID, sessionID primitive.ObjectID) (string, error) {
+	keys, err := currentJWTKeys()
+	if err != nil {
+		return "", err
+	}
+	return keys.Sign(userID, sessionID)
+}
 
+func ValidateToken(tokenString string) (*Claims, error) {
+	keys, err := currentJWTKeys()
+	if err != nil {
+		return nil, err
+	}
+	return keys.Parse(tokenString)
+}
 
+// JWKS returns the JSON Web Key Set of the configured keys.
+func JWKS() map[string]interface{} {
+	keys, err := currentJWTKeys()
+	if err != nil {
+		return map[string]interface{}{"keys": []interface{}{}}
+	}
+	return keys.JWKS()
+}
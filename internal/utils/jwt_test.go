@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"chat-backend/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func privatePEM(t *testing.T, key crypto.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func publicPEM(t *testing.T, key crypto.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// writePublicKey stores the public key as a PEM file and returns its path.
+func writePublicKey(t *testing.T, key crypto.PublicKey) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pub")
+	if err := os.WriteFile(path, publicPEM(t, key), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func loadKeys(t *testing.T, cfg *config.Config) *JWTKeys {
+	t.Helper()
+	keys, err := LoadJWTKeys(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestJWTRotationKeepsOldTokensValid(t *testing.T) {
+	oldRSA, newRSA := newRSAKey(t), newRSAKey(t)
+	_, oldEd, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		old    *config.Config
+		verify string
+	}{
+		{
+			name:   "RS256 with kid",
+			old:    &config.Config{JWTAlgorithm: "RS256", JWTPrivateKey: privatePEM(t, oldRSA), JWTKeyID: "2025-01"},
+			verify: "2025-01=" + writePublicKey(t, &oldRSA.PublicKey),
+		},
+		{
+			name:   "RS256 with thumbprint",
+			old:    &config.Config{JWTAlgorithm: "RS256", JWTPrivateKey: privatePEM(t, oldRSA)},
+			verify: writePublicKey(t, &oldRSA.PublicKey),
+		},
+		{
+			name:   "EdDSA with thumbprint",
+			old:    &config.Config{JWTAlgorithm: "EdDSA", JWTPrivateKey: privatePEM(t, oldEd)},
+			verify: writePublicKey(t, oldEd.Public()),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			userID, sessionID := primitive.NewObjectID(), primitive.NewObjectID()
+			token, err := loadKeys(t, tc.old).Sign(userID, sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rotated := loadKeys(t, &config.Config{
+				JWTAlgorithm:            "RS256",
+				JWTPrivateKey:           privatePEM(t, newRSA),
+				JWTKeyID:                "2025-02",
+				JWTVerificationKeyFiles: tc.verify,
+			})
+			claims, err := rotated.Parse(token)
+			if err != nil {
+				t.Fatalf("token of the previous key rejected: %v", err)
+			}
+			if claims.UserID != userID || claims.SessionID != sessionID {
+				t.Fatalf("got claims for %s/%s", claims.UserID.Hex(), claims.SessionID.Hex())
+			}
+
+			// New tokens are signed with the new key
+			fresh, err := rotated.Sign(userID, sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rotated.Parse(fresh); err != nil {
+				t.Fatalf("token of the new key rejected: %v", err)
+			}
+			if _, err := loadKeys(t, tc.old).Parse(fresh); err == nil {
+				t.Fatal("old key set accepted a token of the new key")
+			}
+		})
+	}
+}
+
+func TestJWTRejectsUnknownKid(t *testing.T) {
+	keys := loadKeys(t, &config.Config{JWTAlgorithm: "RS256", JWTPrivateKey: privatePEM(t, newRSAKey(t)), JWTKeyID: "current"})
+	other := newRSAKey(t)
+
+	for _, kid := range []string{"retired", ""} {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, &Claims{
+			UserID:           primitive.NewObjectID(),
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+		})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := keys.Parse(signed); err == nil {
+			t.Fatalf("token with kid %q accepted", kid)
+		}
+	}
+
+	// A known kid does not help a token signed by another key
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	token.Header["kid"] = "current"
+	signed, err := token.SignedString(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Parse(signed); err == nil {
+		t.Fatal("token signed by another key accepted")
+	}
+}
+
+func TestJWTRejectsHS256ForRSAKid(t *testing.T) {
+	private := newRSAKey(t)
+	keys := loadKeys(t, &config.Config{JWTAlgorithm: "RS256", JWTPrivateKey: privatePEM(t, private), JWTKeyID: "current"})
+
+	// The classic algorithm confusion: HMAC keyed with the published public key
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID:           primitive.NewObjectID(),
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	token.Header["kid"] = "current"
+	signed, err := token.SignedString(publicPEM(t, &private.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Parse(signed); err == nil {
+		t.Fatal("HS256 token naming an RS256 key accepted")
+	}
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MailMessage is an email kept by LocalMailbox.
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+	SentAt  time.Time
+}
+
+// LocalMailbox keeps sent email in memory and, when dir is set, writes each
+// message to a file there. It replaces SMTP in development and tests.
+type LocalMailbox struct {
+	dir      string
+	mu       sync.Mutex
+	messages []MailMessage
+}
+
+func NewLocalMailbox(dir string) *LocalMailbox {
+	return &LocalMailbox{dir: dir}
+}
+
+func (m *LocalMailbox) Enabled() bool { return true }
+
+func (m *LocalMailbox) SendMail(to, subject, body string) error {
+	msg := MailMessage{To: to, Subject: subject, Body: body, SentAt: time.Now()}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+
+	if m.dir == "" {
+		log.Printf("[mailbox] to=%s subject=%q\n%s", to, subject, body)
+		return nil
+	}
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.txt", msg.SentAt.UnixNano(), filepath.Base(to))
+	content := "To: " + to + "\nSubject: " + subject + "\n\n" + body + "\n"
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0600)
+}
+
+// Messages returns the messages sent to the address, oldest first.
+func (m *LocalMailbox) Messages(to string) []MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []MailMessage
+	for _, msg := range m.messages {
+		if msg.To == to {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+
+	"chat-backend/internal/config"
+)
+
+// Mailer sends plain-text email. SMTPMailer is the real implementation and
+// LocalMailbox a stand-in for development and tests.
+type Mailer interface {
+	Enabled() bool
+	SendMail(to, subject, body string) error
+}
+
+// NewMailer returns the mailer selected by MAIL_DRIVER. An unconfigured SMTP
+// mailer is returned as is, which disables the email flows, so that codes are
+// never kept in a mailbox nobody reads.
+func NewMailer(cfg *config.Config) Mailer {
+	if cfg.MailDriver == "mailbox" {
+		return NewLocalMailbox(cfg.MailboxDir)
+	}
+	smtpMailer := NewSMTPMailer(cfg)
+	if !smtpMailer.Enabled() {
+		log.Println("WARNING: SMTP is not configured. Email verification and recovery are disabled.")
+	}
+	return smtpMailer
+}
+
+// SMTPMailer sends plain-text email through an SMTP server.
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(cfg *config.Config) *SMTPMailer {
+	return &SMTPMailer{
+		host:     cfg.SMTPHost,
+		port:     cfg.SMTPPort,
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword,
+		from:     cfg.SMTPFrom,
+	}
+}
+
+func (m *SMTPMailer) Enabled() bool {
+	return m.host != "" && m.from != ""
+}
+
+func (m *SMTPMailer) SendMail(to, subject, body string) error {
+	if !m.Enabled() {
+		return fmt.Errorf("SMTP is not configured")
+	}
+	if to == "" || strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient address")
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	msg := "From: " + m.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body + "\r\n"
+
+	return smtp.SendMail(m.host+":"+m.port, auth, m.from, []string{to}, []byte(msg))
+}
+
+// EmailOTPProvider delivers codes to the account's email address.
+type EmailOTPProvider struct {
+	mailer Mailer
+}
+
+func NewEmailOTPProvider(mailer Mailer) *EmailOTPProvider {
+	return &EmailOTPProvider{mailer: mailer}
+}
+
+func (p *EmailOTPProvider) Name() string    { return "smtp" }
+func (p *EmailOTPProvider) Channel() string { return OTPChannelEmail }
+func (p *EmailOTPProvider) Enabled() bool   { return p.mailer.Enabled() }
+
+func (p *EmailOTPProvider) SendOTP(ctx context.Context, to OTPRecipient, code string) (string, error) {
+	return "", p.mailer.SendMail(to.Email, "Your verification code", OTPMessage(code))
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"chat-backend/internal/config"
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OTPChannelSMS   = "sms"
+	OTPChannelEmail = "email"
+	OTPChannelDev   = "dev"
+)
+
+var ErrOTPNotDelivered = errors.New("verification code could not be delivered")
+
+// OTPRecipient is where a code should go. Providers use the field matching
+// their channel and skip recipients they cannot reach.
+type OTPRecipient struct {
+	PhoneNumber string
+	Email       string
+}
+
+// OTPProvider delivers one-time codes over a single channel.
+type OTPProvider interface {
+	Name() string
+	Channel() string
+	Enabled() bool
+	// SendOTP delivers the code and returns the provider's message ID, if any.
+	SendOTP(ctx context.Context, to OTPRecipient, code string) (string, error)
+}
+
+// OTPMessage is the text sent with a verification code.
+func OTPMessage(code string) string {
+	return fmt.Sprintf("Your verification code is: %s. This code will expire in 5 minutes.", code)
+}
+
+// OTPService sends codes through the configured providers, falling back to
+// the next provider when one fails, and records every delivery.
+type OTPService struct {
+	db        *database.Database
+	providers []OTPProvider
+}
+
+func NewOTPService(db *database.Database, cfg *config.Config) *OTPService {
+	var providers []OTPProvider
+	for _, name := range strings.Split(cfg.OTPProviders, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		provider := newOTPProvider(name, cfg)
+		if provider == nil {
+			log.Printf("Unknown OTP provider %q ignored", name)
+			continue
+		}
+		if !provider.Enabled() {
+			log.Printf("OTP provider %q is not configured and will be skipped", name)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	if len(providers) == 0 {
+		log.Println("WARNING: No OTP provider is configured. Verification codes cannot be delivered.")
+	}
+	return &OTPService{db: db, providers: providers}
+}
+
+func newOTPProvider(name string, cfg *config.Config) OTPProvider {
+	switch name {
+	case "twilio":
+		return NewTwilioService(cfg)
+	case "http_sms":
+		return NewHTTPSMSGateway(cfg)
+	case "smtp":
+		return NewEmailOTPProvider(NewSMTPMailer(cfg))
+	case "dev":
+		return NewDevOTPSink(cfg.OTPDevSinkFile, cfg.OTPDevSinkEnabled)
+	}
+	return nil
+}
+
+// Send delivers the code with the first provider that succeeds. The returned
+// delivery is stored in otp_deliveries whether or not delivery succeeded.
+func (s *OTPService) Send(ctx context.Context, to OTPRecipient, code, purpose string) (*models.OTPDelivery, error) {
+	now := time.Now()
+	delivery := &models.OTPDelivery{
+		ID:          primitive.NewObjectID(),
+		PhoneNumber: to.PhoneNumber,
+		Email:       to.Email,
+		Purpose:     purpose,
+		Status:      "failed",
+		Attempts:    []models.OTPDeliveryAttempt{},
+		CreatedAt:   now,
+	}
+
+	for _, provider := range s.providers {
+		attempt := models.OTPDeliveryAttempt{
+			Provider: provider.Name(),
+			Channel:  provider.Channel(),
+			At:       time.Now(),
+		}
+
+		if provider.Channel() == OTPChannelEmail && to.Email == "" {
+			attempt.Status = "skipped"
+			attempt.Error = "no email address"
+			delivery.Attempts = append(delivery.Attempts, attempt)
+			continue
+		}
+
+		messageID, err := provider.SendOTP(ctx, to, code)
+		if err != nil {
+			log.Printf("OTP provider %s failed: %v", provider.Name(), err)
+			attempt.Status = "failed"
+			attempt.Error = err.Error()
+			delivery.Attempts = append(delivery.Attempts, attempt)
+			continue
+		}
+
+		attempt.Status = "sent"
+		delivery.Attempts = append(delivery.Attempts, attempt)
+		delivery.Status = "sent"
+		delivery.Provider = provider.Name()
+		delivery.Channel = provider.Channel()
+		delivery.ProviderMessageID = messageID
+		break
+	}
+
+	delivery.UpdatedAt = time.Now()
+	if _, err := s.db.MongoDB.Collection("otp_deliveries").InsertOne(ctx, delivery); err != nil {
+		log.Printf("Failed to record OTP delivery: %v", err)
+	}
+
+	if delivery.Status != "sent" {
+		return delivery, ErrOTPNotDelivered
+	}
+	return delivery, nil
+}
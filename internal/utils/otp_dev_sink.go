@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DevOTPSink "delivers" codes by appending them to a file, or to the log when
+// no file is set. It is meant for local development and CI only, and is off
+// unless OTP_DEV_SINK is set.
+type DevOTPSink struct {
+	path    string
+	enabled bool
+	mu      sync.Mutex
+}
+
+func NewDevOTPSink(path string, enabled bool) *DevOTPSink {
+	return &DevOTPSink{path: path, enabled: enabled}
+}
+
+func (s *DevOTPSink) Name() string    { return "dev" }
+func (s *DevOTPSink) Channel() string { return OTPChannelDev }
+func (s *DevOTPSink) Enabled() bool   { return s.enabled }
+
+func (s *DevOTPSink) SendOTP(ctx context.Context, to OTPRecipient, code string) (string, error) {
+	line := fmt.Sprintf("%s phone=%s email=%s code=%s\n", time.Now().Format(time.RFC3339), to.PhoneNumber, to.Email, code)
+	if s.path == "" {
+		log.Printf("[dev OTP] %s", line)
+		return "", nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = f.WriteString(line)
+	return "", err
+}
@@ -0,0 +1,27 @@
+package utils
+
+import "strings"
+
+// NormalizePhone returns the phone number in E.164 form (+ and 8 to 15
+// digits), or "" if it is not one. Spaces, dashes and parentheses are
+// dropped so every spelling of a number maps to the same accounts, codes
+// and throttling counters.
+func NormalizePhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	if !strings.HasPrefix(phone, "+") {
+		return ""
+	}
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		if r == ' ' || r == '-' || r == '(' || r == ')' {
+			return -1
+		}
+		return 'x'
+	}, phone[1:])
+	if strings.Contains(digits, "x") || len(digits) < 8 || len(digits) > 15 {
+		return ""
+	}
+	return "+" + digits
+}
@@ -0,0 +1,20 @@
+package utils
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	cases := map[string]string{
+		"+905551234567":       "+905551234567",
+		" +90 555 123 45 67 ": "+905551234567",
+		"+1 (555) 123-4567":   "+15551234567",
+		"905551234567":        "",
+		"+90555abc4567":       "",
+		"+1234567":            "",
+		"+1234567890123456":   "",
+	}
+	for in, want := range cases {
+		if got := NormalizePhone(in); got != want {
+			t.Errorf("NormalizePhone(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Privacy keys, named like their PrivacySettings fields. Calls are governed
+// by CallSettings.WhoCanCall.
+const (
+	PrivacyLastSeen     = "last_seen"
+	PrivacyOnlineStatus = "online_status"
+	PrivacyProfilePhoto = "profile_photo"
+	PrivacyBio          = "bio_visibility"
+	PrivacyCalls        = "calls"
+	PrivacyGroupInvites = "group_invites"
+	PrivacyForwards     = "forwards"
+)
+
+// PrivacyKeys are the rules that accept exceptions.
+var PrivacyKeys = map[string]bool{
+	PrivacyLastSeen:     true,
+	PrivacyOnlineStatus: true,
+	PrivacyProfilePhoto: true,
+	PrivacyBio:          true,
+	PrivacyCalls:        true,
+	PrivacyGroupInvites: true,
+	PrivacyForwards:     true,
+}
+
+// ValidPrivacyRule reports whether rule is one of the values privacy rules
+// may be saved with.
+func ValidPrivacyRule(rule string) bool {
+	return rule == "everyone" || rule == "contacts" || rule == "nobody"
+}
+
+// onlineWindow is how recently a user must have been active to show online.
+const onlineWindow = 5 * time.Minute
+
+// defaultPrivacy applies to users who never saved their settings, and
+// matches the defaults settings are created with.
+var defaultPrivacy = models.UserSettings{
+	Privacy: models.PrivacySettings{
+		LastSeen:       "everyone",
+		OnlineStatus:   "everyone",
+		ProfilePhoto:   "everyone",
+		BioVisibility:  "everyone",
+		GroupInvites:   "everyone",
+		Forwards:       "everyone",
+		FindByPhone:    true,
+		FindByUsername: true,
+	},
+	Calls: models.CallSettings{WhoCanCall: "everyone"},
+}
+
+// closedPrivacy is used when a user's settings cannot be loaded, so that a
+// failed lookup never exposes more than the user allows.
+var closedPrivacy = models.UserSettings{
+	Privacy: models.PrivacySettings{
+		LastSeen:      "nobody",
+		OnlineStatus:  "nobody",
+		ProfilePhoto:  "nobody",
+		BioVisibility: "nobody",
+		GroupInvites:  "nobody",
+		Forwards:      "nobody",
+	},
+	Calls: models.CallSettings{WhoCanCall: "nobody"},
+}
+
+// ProfileViewer projects users into the PublicProfile one viewer may see,
+// and evaluates the users' other privacy rules for that viewer. It caches
+// settings, contact status and the viewer's group memberships, so reuse it
+// for every user in a response. A nil viewer ID is an anonymous viewer.
+type ProfileViewer struct {
+	db       *database.Database
+	viewerID primitive.ObjectID
+	settings map[primitive.ObjectID]*models.UserSettings
+	contacts map[primitive.ObjectID]bool // users who have the viewer as a contact
+	inChat   map[primitive.ObjectID]bool // chats named in exceptions, by viewer membership
+	blocked  map[primitive.ObjectID]bool // users the viewer blocked, loaded on first use
+}
+
+func NewProfileViewer(db *database.Database, viewerID primitive.ObjectID) *ProfileViewer {
+	return &ProfileViewer{
+		db:       db,
+		viewerID: viewerID,
+		settings: make(map[primitive.ObjectID]*models.UserSettings),
+		contacts: make(map[primitive.ObjectID]bool),
+		inChat:   make(map[primitive.ObjectID]bool),
+	}
+}
+
+// Load fetches the privacy settings and contact status of the users in two
+// queries. Profile loads missing users one by one otherwise.
+func (v *ProfileViewer) Load(ctx context.Context, userIDs ...primitive.ObjectID) {
+	missing := make([]primitive.ObjectID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if _, ok := v.settings[id]; !ok && id != v.viewerID {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	for _, id := range missing {
+		settings := defaultPrivacy
+		v.settings[id] = &settings
+	}
+
+	cursor, err := v.db.MongoDB.Collection("user_settings").Find(
+		ctx,
+		bson.M{"user_id": bson.M{"$in": missing}},
+		options.Find().SetProjection(bson.M{"user_id": 1, "privacy": 1, "calls.who_can_call": 1}),
+	)
+	var settings []models.UserSettings
+	if err == nil {
+		err = cursor.All(ctx, &settings)
+	}
+	if err != nil {
+		for _, id := range missing {
+			settings := closedPrivacy
+			v.settings[id] = &settings
+		}
+		return
+	}
+	for i := range settings {
+		v.settings[settings[i].UserID] = &settings[i]
+	}
+
+	if v.viewerID.IsZero() {
+		return
+	}
+	ids, err := v.db.MongoDB.Collection("contacts").Distinct(ctx, "user_id", bson.M{
+		"user_id":    bson.M{"$in": missing},
+		"contact_id": v.viewerID,
+	})
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			v.contacts[oid] = true
+		}
+	}
+}
+
+// IsContact reports whether the user has the viewer in their contacts.
+func (v *ProfileViewer) IsContact(ctx context.Context, userID primitive.ObjectID) bool {
+	v.Load(ctx, userID)
+	return v.contacts[userID]
+}
+
+// BlockedBy reports whether the user blocked the viewer.
+func (v *ProfileViewer) BlockedBy(ctx context.Context, userID primitive.ObjectID) bool {
+	if userID == v.viewerID || v.viewerID.IsZero() {
+		return false
+	}
+	v.Load(ctx, userID)
+	return containsObjectID(v.settings[userID].Privacy.BlockedUsers, v.viewerID)
+}
+
+// Blocked reports whether either the user or the viewer blocked the other.
+// A failed lookup of the viewer's blocks counts as blocked.
+func (v *ProfileViewer) Blocked(ctx context.Context, userID primitive.ObjectID) bool {
+	if v.BlockedBy(ctx, userID) {
+		return true
+	}
+	if userID == v.viewerID || v.viewerID.IsZero() {
+		return false
+	}
+	if v.blocked == nil {
+		var settings models.UserSettings
+		err := v.db.MongoDB.Collection("user_settings").FindOne(
+			ctx,
+			bson.M{"user_id": v.viewerID},
+			options.FindOne().SetProjection(bson.M{"privacy.blocked_users": 1}),
+		).Decode(&settings)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return true
+		}
+		v.blocked = make(map[primitive.ObjectID]bool, len(settings.Privacy.BlockedUsers))
+		for _, id := range settings.Privacy.BlockedUsers {
+			v.blocked[id] = true
+		}
+	}
+	return v.blocked[userID]
+}
+
+// Allows reports whether the user's privacy rule for key lets the viewer
+// through, taking the user's exceptions for key into account. Users always
+// pass their own rules, and users who blocked the viewer never do.
+func (v *ProfileViewer) Allows(ctx context.Context, userID primitive.ObjectID, key string) bool {
+	if userID == v.viewerID {
+		return true
+	}
+	v.Load(ctx, userID)
+	if v.BlockedBy(ctx, userID) {
+		return false
+	}
+	settings := v.settings[userID]
+	privacy := &settings.Privacy
+
+	if exceptions, ok := privacy.Exceptions[key]; ok && !v.viewerID.IsZero() {
+		if containsObjectID(exceptions.NeverAllowUsers, v.viewerID) {
+			return false
+		}
+		if containsObjectID(exceptions.AlwaysAllowUsers, v.viewerID) {
+			return true
+		}
+		// A failed membership lookup denies rather than risk a never-allow
+		if in, err := v.inAnyChat(ctx, exceptions.NeverAllowChats); in || err != nil {
+			return false
+		}
+		if in, _ := v.inAnyChat(ctx, exceptions.AlwaysAllowChats); in {
+			return true
+		}
+	}
+
+	var rule string
+	switch key {
+	case PrivacyLastSeen:
+		rule = privacy.LastSeen
+	case PrivacyOnlineStatus:
+		rule = privacy.OnlineStatus
+	case PrivacyProfilePhoto:
+		rule = privacy.ProfilePhoto
+	case PrivacyBio:
+		rule = privacy.BioVisibility
+	case PrivacyCalls:
+		rule = settings.Calls.WhoCanCall
+	case PrivacyGroupInvites:
+		rule = privacy.GroupInvites
+	case PrivacyForwards:
+		rule = privacy.Forwards
+	}
+	switch rule {
+	case "contacts":
+		return v.contacts[userID]
+	case "everyone", "":
+		// Settings saved before a rule existed leave it empty
+		return true
+	default:
+		// "nobody", and values that are not rules at all
+		return false
+	}
+}
+
+// inAnyChat reports whether the viewer is a member of any of the chats,
+// looking up the chats it has not seen yet in one query.
+func (v *ProfileViewer) inAnyChat(ctx context.Context, chatIDs []primitive.ObjectID) (bool, error) {
+	var unknown []primitive.ObjectID
+	for _, id := range chatIDs {
+		member, ok := v.inChat[id]
+		if member {
+			return true, nil
+		}
+		if !ok {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) == 0 {
+		return false, nil
+	}
+
+	ids, err := v.db.MongoDB.Collection("chats").Distinct(ctx, "_id", bson.M{
+		"_id":     bson.M{"$in": unknown},
+		"members": v.viewerID,
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, id := range unknown {
+		v.inChat[id] = false
+	}
+	for _, id := range ids {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			v.inChat[oid] = true
+		}
+	}
+	return len(ids) > 0, nil
+}
+
+func containsObjectID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// CanFindByUsername reports whether the viewer may look the user up by
+// username. Users who turned it off can still be found by their contacts,
+// and users who blocked the viewer cannot be found at all.
+func (v *ProfileViewer) CanFindByUsername(ctx context.Context, userID primitive.ObjectID) bool {
+	if userID == v.viewerID {
+		return true
+	}
+	v.Load(ctx, userID)
+	if v.BlockedBy(ctx, userID) {
+		return false
+	}
+	return v.settings[userID].Privacy.FindByUsername || v.contacts[userID]
+}
+
+// Profile returns what the viewer may see of the user.
+func (v *ProfileViewer) Profile(ctx context.Context, user *models.User) models.PublicProfile {
+	profile := models.PublicProfile{
+		ID:              user.ID,
+		Username:        user.Username,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		IsPremium:       user.IsPremium,
+		UserType:        user.UserType,
+		CompanyName:     user.CompanyName,
+		CompanyCategory: user.CompanyCategory,
+	}
+	if v.Allows(ctx, user.ID, PrivacyProfilePhoto) {
+		profile.Avatar = user.Avatar
+	}
+	if v.Allows(ctx, user.ID, PrivacyBio) {
+		profile.Bio = user.Bio
+	}
+	blockedBy := v.BlockedBy(ctx, user.ID)
+	if user.ID == v.viewerID || (!user.HidePhoneNumber && !blockedBy && v.IsContact(ctx, user.ID)) {
+		profile.PhoneNumber = user.PhoneNumber
+	}
+	switch {
+	case v.Allows(ctx, user.ID, PrivacyLastSeen):
+		if !user.LastActive.IsZero() {
+			lastActive := user.LastActive
+			profile.LastActive = &lastActive
+		}
+	case blockedBy:
+		// Blocked users see no sign of recent activity
+		profile.LastSeen = "long_ago"
+	default:
+		profile.LastSeen = approximateLastSeen(user.LastActive)
+	}
+	if v.Allows(ctx, user.ID, PrivacyOnlineStatus) {
+		online := time.Since(user.LastActive) < onlineWindow
+		profile.IsOnline = &online
+	}
+	return profile
+}
+
+// Profiles projects the users in order.
+func (v *ProfileViewer) Profiles(ctx context.Context, users []models.User) []models.PublicProfile {
+	ids := make([]primitive.ObjectID, len(users))
+	for i := range users {
+		ids[i] = users[i].ID
+	}
+	v.Load(ctx, ids...)
+
+	profiles := make([]models.PublicProfile, len(users))
+	for i := range users {
+		profiles[i] = v.Profile(ctx, &users[i])
+	}
+	return profiles
+}
+
+// UserProfile loads the user and returns what the viewer may see of them.
+func (v *ProfileViewer) UserProfile(ctx context.Context, userID primitive.ObjectID) (models.PublicProfile, error) {
+	var user models.User
+	if err := v.db.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return models.PublicProfile{}, err
+	}
+	return v.Profile(ctx, &user), nil
+}
+
+// approximateLastSeen tells roughly when a user whose last seen time is
+// hidden was active.
+func approximateLastSeen(lastActive time.Time) string {
+	since := time.Since(lastActive)
+	switch {
+	case lastActive.IsZero():
+		return "long_ago"
+	case since < 3*24*time.Hour:
+		return "recently"
+	case since < 7*24*time.Hour:
+		return "within_week"
+	case since < 30*24*time.Hour:
+		return "within_month"
+	default:
+		return "long_ago"
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"chat-backend/internal/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAnonymousFindByUsername(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+
+	mt.Run("default settings", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.user_settings", mtest.FirstBatch))
+		viewer := NewProfileViewer(&database.Database{MongoDB: mt.DB}, primitive.NilObjectID)
+		if !viewer.CanFindByUsername(context.Background(), userID) {
+			t.Fatal("users without settings should be findable")
+		}
+	})
+
+	mt.Run("find by username off", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.user_settings", mtest.FirstBatch, bson.D{
+			{Key: "user_id", Value: userID},
+			{Key: "privacy", Value: bson.D{{Key: "find_by_username", Value: false}}},
+		}))
+		viewer := NewProfileViewer(&database.Database{MongoDB: mt.DB}, primitive.NilObjectID)
+		if viewer.CanFindByUsername(context.Background(), userID) {
+			t.Fatal("users with find_by_username off should not be findable")
+		}
+	})
+
+	mt.Run("allows", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.user_settings", mtest.FirstBatch))
+		viewer := NewProfileViewer(&database.Database{MongoDB: mt.DB}, primitive.NilObjectID)
+		if !viewer.Allows(context.Background(), userID, PrivacyProfilePhoto) {
+			t.Fatal("default profile photo rule should allow everyone")
+		}
+	})
+}
+
+func TestAllowsUnknownRule(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+	viewerID := primitive.NewObjectID()
+
+	for rule, want := range map[string]bool{"everyone": true, "": true, "nobody": false, "Nobody": false, "contact": false} {
+		mt.Run("rule "+rule, func(mt *mtest.T) {
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "test.user_settings", mtest.FirstBatch, bson.D{
+					{Key: "user_id", Value: userID},
+					{Key: "privacy", Value: bson.D{{Key: "last_seen", Value: rule}}},
+				}),
+				mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{}}),
+			)
+			viewer := NewProfileViewer(&database.Database{MongoDB: mt.DB}, viewerID)
+			if got := viewer.Allows(context.Background(), userID, PrivacyLastSeen); got != want {
+				t.Fatalf("last_seen %q: got %v, want %v", rule, got, want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/skip2/go-qrcode"
@@ -12,35 +13,55 @@ func GenerateQRCode(userID string) (string, string, error) {
 	// Generate unique QR code data
 	qrData := fmt.Sprintf("CHATAPP:%s:%s", userID, uuid.New().String())
 	
-	// Generate QR code image
-	qr, err := qrcode.New(qrData, qrcode.Medium)
+	qrBase64, err := GenerateQRImage(qrData)
 	if err != nil {
 		return "", "", err
 	}
+	
+	return qrData, qrBase64, nil
+}
+
+// GenerateQRImage renders arbitrary data as a base64-encoded 256px PNG QR code.
+func GenerateQRImage(data string) (string, error) {
+	// Generate QR code image
+	qr, err := qrcode.New(data, qrcode.Medium)
+	if err != nil {
+		return "", err
+	}
 
 	// Convert to PNG bytes
 	png, err := qr.PNG(256)
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
 
 	// Convert to base64 string for storage
-	qrBase64 := base64.StdEncoding.EncodeToString(png)
-	
-	return qrData, qrBase64, nil
+	return base64.StdEncoding.EncodeToString(png), nil
 }
 
+// ParseQRCode returns the user ID of a contact QR code. Only the full
+// CHATAPP:user_id:uuid form is accepted; the random part is what makes a
+// code unguessable.
 func ParseQRCode(qrData string) (string, error) {
-	// Parse QR code format: CHATAPP:user_id:uuid
-	var userID string
-	_, err := fmt.Sscanf(qrData, "CHATAPP:%s", &userID)
-	if err != nil {
-		return "", err
+	parts := strings.Split(qrData, ":")
+	if len(parts) != 3 || parts[0] != "CHATAPP" || parts[1] == "" || parts[2] == "" {
+		return "", fmt.Errorf("not a contact QR code")
 	}
-	return userID, nil
+	return parts[1], nil
 }
 
+// loginQRPrefix marks QR codes used for QR login, as opposed to contact codes.
+const loginQRPrefix = "CHATAPP-LOGIN:"
 
+// LoginQRData builds the QR payload for a QR login token.
+func LoginQRData(token string) string {
+	return loginQRPrefix + token
+}
 
-
-
+// ParseLoginQRCode extracts the login token from a QR login payload.
+func ParseLoginQRCode(qrData string) (string, error) {
+	if !strings.HasPrefix(qrData, loginQRPrefix) || len(qrData) == len(loginQRPrefix) {
+		return "", fmt.Errorf("not a login QR code")
+	}
+	return strings.TrimPrefix(qrData, loginQRPrefix), nil
+}
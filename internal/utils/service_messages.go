@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ServiceChat returns the user's service notifications chat (login alerts
+// and other account notices), creating it on first use.
+func ServiceChat(ctx context.Context, db *database.Database, userID primitive.ObjectID) (*models.Chat, error) {
+	now := time.Now()
+	var chat models.Chat
+	err := db.MongoDB.Collection("chats").FindOneAndUpdate(
+		ctx,
+		bson.M{"type": "service", "members": []primitive.ObjectID{userID}},
+		bson.M{"$setOnInsert": bson.M{
+			"group_name": "Service Notifications",
+			"is_secret":  false,
+			"created_at": now,
+			"updated_at": now,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&chat)
+	if err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
+
+// SendServiceMessage posts a system message to the user's service chat.
+func SendServiceMessage(ctx context.Context, db *database.Database, userID primitive.ObjectID, content string) (*models.Message, error) {
+	chat, err := ServiceChat(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	message := models.Message{
+		ID:          primitive.NewObjectID(),
+		ChatID:      chat.ID,
+		SenderID:    primitive.NilObjectID,
+		Content:     content,
+		MessageType: "service",
+		Status:      "sent",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := db.MongoDB.Collection("messages").InsertOne(ctx, message); err != nil {
+		return nil, err
+	}
+
+	_, err = db.MongoDB.Collection("chats").UpdateOne(
+		ctx,
+		bson.M{"_id": chat.ID},
+		bson.M{
+			"$set": bson.M{
+				"last_message_id": message.ID,
+				"last_message_at": now,
+				"updated_at":      now,
+			},
+			"$inc": bson.M{"unread_count." + userID.Hex(): 1},
+		},
+	)
+	return &message, err
+}
@@ -0,0 +1,375 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"chat-backend/internal/config"
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionRevoked      = errors.New("session revoked or expired")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrSessionIdle         = errors.New("session ended after inactivity")
+)
+
+// TokenPair is returned to clients after login or refresh.
+type TokenPair struct {
+	AccessToken  string             `json:"token"`
+	RefreshToken string             `json:"refresh_token"`
+	ExpiresAt    time.Time          `json:"expires_at"`
+	SessionID    primitive.ObjectID `json:"session_id"`
+	DeviceSecret string             `json:"device_secret,omitempty"`
+}
+
+// SessionInfo describes the client a session is opened for.
+type SessionInfo struct {
+	DeviceID   string
+	DeviceName string
+	DeviceType string
+	IPAddress  string
+	UserAgent  string
+	// DeviceSecret is the secret the client was issued on its last login
+	DeviceSecret string
+}
+
+// activityResolution limits how often API use is written to last_active.
+const activityResolution = time.Minute
+
+// SessionService manages login sessions and their rotating refresh tokens.
+// A session is the refresh token family: presenting an already rotated
+// refresh token revokes the whole session.
+type SessionService struct {
+	db         *database.Database
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewSessionService(db *database.Database, cfg *config.Config) *SessionService {
+	refreshTTL, err := time.ParseDuration(cfg.RefreshTokenExpiration)
+	if err != nil || refreshTTL <= 0 {
+		refreshTTL = 30 * 24 * time.Hour
+	}
+	return &SessionService{
+		db:         db,
+		accessTTL:  AccessTokenTTL(cfg),
+		refreshTTL: refreshTTL,
+	}
+}
+
+func (s *SessionService) sessions() *mongo.Collection {
+	return s.db.MongoDB.Collection("sessions")
+}
+
+func (s *SessionService) refreshTokens() *mongo.Collection {
+	return s.db.MongoDB.Collection("refresh_tokens")
+}
+
+// CreateSession opens a new session for the user and issues its first token pair.
+func (s *SessionService) CreateSession(ctx context.Context, userID primitive.ObjectID, info SessionInfo) (*TokenPair, error) {
+	now := time.Now()
+	session := models.AuthSession{
+		ID:         primitive.NewObjectID(),
+		UserID:     userID,
+		DeviceID:   info.DeviceID,
+		DeviceName: info.DeviceName,
+		DeviceType: info.DeviceType,
+		IPAddress:  info.IPAddress,
+		UserAgent:  info.UserAgent,
+		LastActive: now,
+		ExpiresAt:  now.Add(s.refreshTTL),
+		CreatedAt:  now,
+	}
+	if _, err := s.sessions().InsertOne(ctx, session); err != nil {
+		return nil, err
+	}
+	_ = TouchUser(ctx, s.db, userID)
+
+	// Every login issues a new device secret, which proves the device on
+	// its next login
+	secret, err := GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	_ = RecordDevice(ctx, s.db, userID, info, HashToken(secret))
+
+	tokens, err := s.issue(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	tokens.DeviceSecret = secret
+	return tokens, nil
+}
+
+// Refresh rotates a refresh token. The presented token is consumed; reusing it
+// later revokes the session it belongs to.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string, info SessionInfo) (*TokenPair, error) {
+	now := time.Now()
+	hash := HashToken(refreshToken)
+
+	var token models.RefreshToken
+	err := s.refreshTokens().FindOneAndUpdate(
+		ctx,
+		bson.M{"token_hash": hash, "used_at": nil},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		// Either unknown or already rotated. A rotated token means it leaked.
+		var used models.RefreshToken
+		if err := s.refreshTokens().FindOne(ctx, bson.M{"token_hash": hash}).Decode(&used); err == nil {
+			_ = s.Revoke(ctx, used.UserID, used.SessionID, "token_reuse")
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.ExpiresAt.Before(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var session models.AuthSession
+	if err := s.sessions().FindOne(ctx, bson.M{"_id": token.SessionID}).Decode(&session); err == nil {
+		if err := s.expireIfIdle(ctx, &session); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.sessions().FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": token.SessionID, "revoked": false, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{
+			"ip_address":  info.IPAddress,
+			"user_agent":  info.UserAgent,
+			"last_active": now,
+			"expires_at":  now.Add(s.refreshTTL),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSessionRevoked
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = TouchUser(ctx, s.db, session.UserID)
+	if session.DeviceID != "" {
+		_ = RecordDevice(ctx, s.db, session.UserID, SessionInfo{
+			DeviceID:   session.DeviceID,
+			DeviceName: session.DeviceName,
+			DeviceType: session.DeviceType,
+			IPAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+		}, "")
+	}
+
+	return s.issue(ctx, session)
+}
+
+// Validate checks that the session referenced by an access token is still active.
+func (s *SessionService) Validate(ctx context.Context, claims *Claims) (*models.AuthSession, error) {
+	var session models.AuthSession
+	err := s.sessions().FindOne(ctx, bson.M{
+		"_id":     claims.SessionID,
+		"user_id": claims.UserID,
+	}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.Revoked && session.RevokedReason == "auto_logout" {
+		return nil, ErrSessionIdle
+	}
+	if session.Revoked || session.ExpiresAt.Before(time.Now()) {
+		return nil, ErrSessionRevoked
+	}
+	if err := s.expireIfIdle(ctx, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// expireIfIdle revokes the session when it has been idle longer than the
+// user's auto-logout period. last_active is written with activityResolution,
+// which is added as slack so active sessions are never cut short.
+func (s *SessionService) expireIfIdle(ctx context.Context, session *models.AuthSession) error {
+	var user struct {
+		AutoLogout int `bson:"auto_logout"`
+	}
+	err := s.db.MongoDB.Collection("users").FindOne(
+		ctx,
+		bson.M{"_id": session.UserID},
+		options.FindOne().SetProjection(bson.M{"auto_logout": 1}),
+	).Decode(&user)
+	if err != nil || user.AutoLogout <= 0 {
+		return nil
+	}
+
+	idle := time.Duration(user.AutoLogout)*time.Minute + activityResolution
+	if time.Since(session.LastActive) <= idle {
+		return nil
+	}
+	if err := s.Revoke(ctx, session.UserID, session.ID, "auto_logout"); err != nil && err != ErrSessionNotFound {
+		return err
+	}
+	return ErrSessionIdle
+}
+
+// Touch records API use on the session, its device and the user. Writes are
+// skipped when the session was marked active within activityResolution.
+func (s *SessionService) Touch(ctx context.Context, session *models.AuthSession) error {
+	now := time.Now()
+	if now.Sub(session.LastActive) < activityResolution {
+		return nil
+	}
+	result, err := s.sessions().UpdateOne(
+		ctx,
+		bson.M{"_id": session.ID, "last_active": bson.M{"$lt": now.Add(-activityResolution)}},
+		bson.M{"$set": bson.M{"last_active": now}},
+	)
+	if err != nil || result.ModifiedCount == 0 {
+		// Another request already recorded this minute
+		return err
+	}
+	session.LastActive = now
+	if err := TouchUser(ctx, s.db, session.UserID); err != nil {
+		return err
+	}
+	if session.DeviceID != "" {
+		return touchDevice(ctx, s.db, session.UserID, session.DeviceID, now)
+	}
+	return nil
+}
+
+// ListActive returns the user's sessions that have not been revoked or expired.
+func (s *SessionService) ListActive(ctx context.Context, userID primitive.ObjectID) ([]models.AuthSession, error) {
+	cursor, err := s.sessions().Find(
+		ctx,
+		bson.M{"user_id": userID, "revoked": false, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.M{"last_active": -1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []models.AuthSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Revoke terminates a session of the user and burns its refresh tokens.
+func (s *SessionService) Revoke(ctx context.Context, userID, sessionID primitive.ObjectID, reason string) error {
+	now := time.Now()
+	var session models.AuthSession
+	err := s.sessions().FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": sessionID, "user_id": userID, "revoked_at": nil},
+		bson.M{"$set": bson.M{
+			"revoked":        true,
+			"revoked_at":     now,
+			"revoked_reason": reason,
+		}},
+	).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.refreshTokens().UpdateMany(
+		ctx,
+		bson.M{"session_id": sessionID, "used_at": nil},
+		bson.M{"$set": bson.M{"used_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if session.DeviceID != "" {
+		return ForgetDevice(ctx, s.db, userID, session.DeviceID)
+	}
+	return nil
+}
+
+// RevokeAll terminates every session of the user except the given one.
+func (s *SessionService) RevokeAll(ctx context.Context, userID primitive.ObjectID, except primitive.ObjectID, reason string) error {
+	sessions, err := s.ListActive(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.ID == except {
+			continue
+		}
+		if err := s.Revoke(ctx, userID, session.ID, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionService) issue(ctx context.Context, session models.AuthSession) (*TokenPair, error) {
+	accessToken, err := GenerateToken(session.UserID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = s.refreshTokens().InsertOne(ctx, models.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		TokenHash: HashToken(refreshToken),
+		ExpiresAt: session.ExpiresAt,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    now.Add(s.accessTTL),
+		SessionID:    session.ID,
+	}, nil
+}
+
+// GenerateOpaqueToken returns a random URL-safe token.
+func GenerateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex SHA-256 of a token, used to store tokens at rest.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"chat-backend/internal/config"
+)
+
+// HTTPSMSGateway sends SMS through a generic HTTP gateway. It POSTs
+// {"to", "from", "message"} as JSON with a bearer API key and expects a 2xx
+// response, optionally carrying the message ID as "id" or "message_id".
+type HTTPSMSGateway struct {
+	url    string
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+func NewHTTPSMSGateway(cfg *config.Config) *HTTPSMSGateway {
+	return &HTTPSMSGateway{
+		url:    cfg.SMSGatewayURL,
+		apiKey: cfg.SMSGatewayAPIKey,
+		from:   cfg.SMSGatewayFrom,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (g *HTTPSMSGateway) Name() string    { return "http_sms" }
+func (g *HTTPSMSGateway) Channel() string { return OTPChannelSMS }
+func (g *HTTPSMSGateway) Enabled() bool   { return g.url != "" }
+
+func (g *HTTPSMSGateway) SendOTP(ctx context.Context, to OTPRecipient, code string) (string, error) {
+	phone := normalizePhoneNumber(to.PhoneNumber)
+	if phone == "" {
+		return "", fmt.Errorf("recipient phone number is required")
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"to":      phone,
+		"from":    g.from,
+		"message": OTPMessage(code),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.apiKey)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("SMS gateway request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("SMS gateway returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		ID        string `json:"id"`
+		MessageID string `json:"message_id"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&result)
+	if result.MessageID != "" {
+		return result.MessageID, nil
+	}
+	return result.ID, nil
+}
@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ThrottleError is returned when a phone number or IP address has to wait.
+type ThrottleError struct {
+	Reason     string // cooldown, limit, locked
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	return fmt.Sprintf("too many requests (%s), retry in %s", e.Reason, e.RetryAfter.Round(time.Second))
+}
+
+type throttlePolicy struct {
+	prefix        string
+	sendWindow    time.Duration
+	maxSends      int             // codes per send window
+	cooldowns     []time.Duration // wait after the n-th send in the window; the last value repeats
+	failureWindow time.Duration
+	maxFailures   int // failed verifications per failure window before a lockout
+	lockout       time.Duration
+	maxLockout    time.Duration
+}
+
+var (
+	phonePolicy = throttlePolicy{
+		prefix:        "phone:",
+		sendWindow:    24 * time.Hour,
+		maxSends:      10,
+		cooldowns:     []time.Duration{time.Minute, 2 * time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour},
+		failureWindow: time.Hour,
+		maxFailures:   10,
+		lockout:       time.Hour,
+		maxLockout:    24 * time.Hour,
+	}
+	// IPs can be shared (NAT, offices), so they get a higher budget and only
+	// start cooling down after a burst.
+	ipPolicy = throttlePolicy{
+		prefix:        "ip:",
+		sendWindow:    time.Hour,
+		maxSends:      20,
+		cooldowns:     []time.Duration{0, 0, 0, 0, 0, time.Minute, 5 * time.Minute, 15 * time.Minute},
+		failureWindow: time.Hour,
+		maxFailures:   30,
+		lockout:       time.Hour,
+		maxLockout:    24 * time.Hour,
+	}
+)
+
+func (p throttlePolicy) cooldown(sends int) time.Duration {
+	if sends <= 0 {
+		return 0
+	}
+	if sends > len(p.cooldowns) {
+		return p.cooldowns[len(p.cooldowns)-1]
+	}
+	return p.cooldowns[sends-1]
+}
+
+// VerificationGuard throttles sending and guessing of verification codes per
+// phone number and per IP address, and audits failed attempts.
+type VerificationGuard struct {
+	db *database.Database
+}
+
+func NewVerificationGuard(db *database.Database) *VerificationGuard {
+	return &VerificationGuard{db: db}
+}
+
+func (g *VerificationGuard) throttles() *mongo.Collection {
+	return g.db.MongoDB.Collection("auth_throttles")
+}
+
+func (g *VerificationGuard) load(ctx context.Context, key string) (models.AuthThrottle, error) {
+	var t models.AuthThrottle
+	err := g.throttles().FindOne(ctx, bson.M{"_id": key}).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return models.AuthThrottle{ID: key}, nil
+	}
+	return t, err
+}
+
+// resetWindow restarts a counter whose window has passed. Counters are only
+// changed with atomic updates, so concurrent requests cannot lose counts.
+func (g *VerificationGuard) resetWindow(ctx context.Context, key, count, start string, window time.Duration, now time.Time) error {
+	_, err := g.throttles().UpdateOne(
+		ctx,
+		bson.M{"_id": key, "$or": []bson.M{
+			bson.M{start: bson.M{"$exists": false}},
+			bson.M{start: bson.M{"$lte": now.Add(-window)}},
+		}},
+		bson.M{"$set": bson.M{count: 0, start: now, "updated_at": now}},
+	)
+	return err
+}
+
+type throttleTarget struct {
+	policy throttlePolicy
+	value  string
+}
+
+func targets(phone, ip string) []throttleTarget {
+	list := []throttleTarget{{phonePolicy, phone}}
+	if ip != "" {
+		list = append(list, throttleTarget{ipPolicy, ip})
+	}
+	return list
+}
+
+// AllowSend checks the send budget of the phone number and IP and records the
+// send. Each send pushes the next allowed send further out.
+func (g *VerificationGuard) AllowSend(ctx context.Context, phone, ip string) error {
+	now := time.Now()
+	var reserved []throttleTarget
+	var counts []int
+	release := func() {
+		for _, target := range reserved {
+			_, _ = g.throttles().UpdateOne(ctx, bson.M{"_id": target.policy.prefix + target.value}, bson.M{"$inc": bson.M{"send_count": -1}})
+		}
+	}
+
+	for _, target := range targets(phone, ip) {
+		key := target.policy.prefix + target.value
+		_, err := g.throttles().UpdateOne(
+			ctx,
+			bson.M{"_id": key},
+			bson.M{"$setOnInsert": bson.M{"send_count": 0, "send_window_start": now, "updated_at": now}},
+			options.Update().SetUpsert(true),
+		)
+		if err == nil {
+			err = g.resetWindow(ctx, key, "send_count", "send_window_start", target.policy.sendWindow, now)
+		}
+		if err != nil {
+			release()
+			return err
+		}
+
+		// Reserve a send only while the target is neither locked, cooling
+		// down nor out of sends
+		var t models.AuthThrottle
+		err = g.throttles().FindOneAndUpdate(
+			ctx,
+			bson.M{
+				"_id":          key,
+				"locked_until": bson.M{"$not": bson.M{"$gt": now}},
+				"next_send_at": bson.M{"$not": bson.M{"$gt": now}},
+				"send_count":   bson.M{"$lt": target.policy.maxSends},
+			},
+			bson.M{"$inc": bson.M{"send_count": 1}, "$set": bson.M{"updated_at": now}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&t)
+		if err == mongo.ErrNoDocuments {
+			release()
+			return g.refusal(ctx, key, target.policy, phone, ip, now)
+		}
+		if err != nil {
+			release()
+			return err
+		}
+		reserved = append(reserved, target)
+		counts = append(counts, t.SendCount)
+	}
+
+	for i, target := range reserved {
+		_, err := g.throttles().UpdateOne(
+			ctx,
+			bson.M{"_id": target.policy.prefix + target.value},
+			bson.M{"$max": bson.M{"next_send_at": now.Add(target.policy.cooldown(counts[i]))}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refusal explains why a send could not be reserved.
+func (g *VerificationGuard) refusal(ctx context.Context, key string, policy throttlePolicy, phone, ip string, now time.Time) error {
+	t, err := g.load(ctx, key)
+	if err != nil {
+		return err
+	}
+	switch {
+	case now.Before(t.LockedUntil):
+		g.audit(ctx, phone, ip, "locked")
+		return &ThrottleError{Reason: "locked", RetryAfter: t.LockedUntil.Sub(now)}
+	case now.Before(t.NextSendAt):
+		g.audit(ctx, phone, ip, "send_throttled")
+		return &ThrottleError{Reason: "cooldown", RetryAfter: t.NextSendAt.Sub(now)}
+	default:
+		g.audit(ctx, phone, ip, "send_throttled")
+		return &ThrottleError{Reason: "limit", RetryAfter: t.SendWindowStart.Add(policy.sendWindow).Sub(now)}
+	}
+}
+
+// CheckVerify refuses verification while the phone number or IP is locked out.
+func (g *VerificationGuard) CheckVerify(ctx context.Context, phone, ip string) error {
+	now := time.Now()
+	for _, target := range targets(phone, ip) {
+		t, err := g.load(ctx, target.policy.prefix+target.value)
+		if err != nil {
+			return err
+		}
+		if now.Before(t.LockedUntil) {
+			g.audit(ctx, phone, ip, "locked")
+			return &ThrottleError{Reason: "locked", RetryAfter: t.LockedUntil.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// RecordFailure audits a failed verification and locks the phone number or IP
+// out once it has too many failures. Every lockout doubles the next one.
+func (g *VerificationGuard) RecordFailure(ctx context.Context, phone, ip, reason string) {
+	g.audit(ctx, phone, ip, reason)
+
+	now := time.Now()
+	for _, target := range targets(phone, ip) {
+		key := target.policy.prefix + target.value
+		if err := g.resetWindow(ctx, key, "failed_count", "failed_window_start", target.policy.failureWindow, now); err != nil {
+			log.Printf("Failed to update throttle state: %v", err)
+			continue
+		}
+
+		var t models.AuthThrottle
+		err := g.throttles().FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": key},
+			bson.M{
+				"$inc":         bson.M{"failed_count": 1},
+				"$set":         bson.M{"updated_at": now},
+				"$setOnInsert": bson.M{"failed_window_start": now},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&t)
+		if err != nil {
+			log.Printf("Failed to update throttle state: %v", err)
+			continue
+		}
+		if t.FailedCount < target.policy.maxFailures {
+			continue
+		}
+
+		// Only the failure that still finds the count over the limit locks
+		lockout := target.policy.lockout << uint(t.Lockouts)
+		if lockout <= 0 || lockout > target.policy.maxLockout {
+			lockout = target.policy.maxLockout
+		}
+		_, err = g.throttles().UpdateOne(
+			ctx,
+			bson.M{"_id": key, "failed_count": bson.M{"$gte": target.policy.maxFailures}},
+			bson.M{
+				"$set": bson.M{"locked_until": now.Add(lockout), "failed_count": 0, "updated_at": now},
+				"$inc": bson.M{"lockouts": 1},
+			},
+		)
+		if err != nil {
+			log.Printf("Failed to update throttle state: %v", err)
+		}
+	}
+}
+
+// RecordSuccess clears the phone number's failure history.
+func (g *VerificationGuard) RecordSuccess(ctx context.Context, phone string) {
+	_, _ = g.throttles().UpdateOne(
+		ctx,
+		bson.M{"_id": phonePolicy.prefix + phone},
+		bson.M{"$set": bson.M{"failed_count": 0, "lockouts": 0, "updated_at": time.Now()}},
+	)
+}
+
+func (g *VerificationGuard) audit(ctx context.Context, phone, ip, reason string) {
+	_, err := g.db.MongoDB.Collection("verification_failures").InsertOne(ctx, models.VerificationFailure{
+		ID:          primitive.NewObjectID(),
+		PhoneNumber: phone,
+		IPAddress:   ip,
+		Reason:      reason,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to audit verification failure: %v", err)
+	}
+}
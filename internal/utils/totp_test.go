@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the RFC 6238 SHA-1 test key "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B vectors, cut to the last six digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		code, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("T=%d: got %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateTOTPRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		now := time.Unix(v.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, now)
+		if !ok {
+			t.Errorf("T=%d: %s rejected", v.unix, v.code)
+			continue
+		}
+		if step != TOTPStep(now) {
+			t.Errorf("T=%d: matched step %d, want %d", v.unix, step, TOTPStep(now))
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := TOTPStep(now)
+	for offset := int64(-2); offset <= 2; offset++ {
+		code, err := TOTPCode(rfc6238Secret, step+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := ValidateTOTP(rfc6238Secret, code, now)
+		want := offset >= -totpSkew && offset <= totpSkew
+		if ok != want {
+			t.Errorf("offset %d: accepted=%v, want %v", offset, ok, want)
+		}
+		if ok && got != step+offset {
+			t.Errorf("offset %d: matched step %d, want %d", offset, got, step+offset)
+		}
+	}
+}
+
+func TestValidateTOTPMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "94287082"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, now); ok {
+			t.Errorf("%q accepted", code)
+		}
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, " 287082 ", now); !ok {
+		t.Error("code with surrounding spaces rejected")
+	}
+}
+
+func TestValidateTOTPAfterRejectsReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step, ok := ValidateTOTPAfter(rfc6238Secret, "050471", 0, now)
+	if !ok {
+		t.Fatal("fresh code rejected")
+	}
+	// The same code again, once its step is recorded as totp_last_step
+	if _, ok := ValidateTOTPAfter(rfc6238Secret, "050471", step, now); ok {
+		t.Fatal("replayed code accepted")
+	}
+
+	// An older code inside the skew window is a replay too
+	previous, err := TOTPCode(rfc6238Secret, step-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ValidateTOTPAfter(rfc6238Secret, previous, step, now); ok {
+		t.Fatal("code older than the last accepted step accepted")
+	}
+
+	// The next step's code is still accepted within the skew window
+	next, err := TOTPCode(rfc6238Secret, step+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := ValidateTOTPAfter(rfc6238Secret, next, step, now); !ok || got != step+1 {
+		t.Fatalf("next step: got %d, %v", got, ok)
+	}
+}
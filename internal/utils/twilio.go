@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -59,27 +60,33 @@ func normalizePhoneNumber(phone string) string {
 }
 
 func (ts *TwilioService) SendSMS(to, message string) error {
+	_, err := ts.sendSMS(to, message)
+	return err
+}
+
+// sendSMS sends the message and returns the Twilio message SID.
+func (ts *TwilioService) sendSMS(to, message string) (string, error) {
 	if !ts.enabled {
-		return fmt.Errorf("Twilio is not enabled or configured")
+		return "", fmt.Errorf("Twilio is not enabled or configured")
 	}
 
 	if to == "" {
-		return fmt.Errorf("recipient phone number is required")
+		return "", fmt.Errorf("recipient phone number is required")
 	}
 
 	if message == "" {
-		return fmt.Errorf("message body is required")
+		return "", fmt.Errorf("message body is required")
 	}
 
 	// Normalize phone numbers to E.164 format
 	normalizedTo := normalizePhoneNumber(to)
 	if normalizedTo == "" || !strings.HasPrefix(normalizedTo, "+") {
-		return fmt.Errorf("invalid phone number format. Phone number must be in E.164 format (e.g., +18777804236)")
+		return "", fmt.Errorf("invalid phone number format. Phone number must be in E.164 format (e.g., +18777804236)")
 	}
 
 	normalizedFrom := normalizePhoneNumber(ts.from)
 	if normalizedFrom == "" || !strings.HasPrefix(normalizedFrom, "+") {
-		return fmt.Errorf("invalid Twilio phone number format. Must be in E.164 format")
+		return "", fmt.Errorf("invalid Twilio phone number format. Must be in E.164 format")
 	}
 
 	// Create message parameters (equivalent to curl --data-urlencode)
@@ -91,18 +98,17 @@ func (ts *TwilioService) SendSMS(to, message string) error {
 	// Send SMS via Twilio API
 	resp, err := ts.client.Api.CreateMessage(params)
 	if err != nil {
-		return fmt.Errorf("failed to send SMS to %s: %w", normalizedTo, err)
+		return "", fmt.Errorf("failed to send SMS to %s: %w", normalizedTo, err)
 	}
 
 	// Check response
 	if resp.Sid != nil {
 		log.Printf("SMS sent successfully. SID: %s, To: %s, From: %s, Status: %s\n", 
 			*resp.Sid, normalizedTo, normalizedFrom, getStatus(resp))
-	} else {
-		log.Printf("SMS sent but no SID returned. To: %s, From: %s\n", normalizedTo, normalizedFrom)
+		return *resp.Sid, nil
 	}
-
-	return nil
+	log.Printf("SMS sent but no SID returned. To: %s, From: %s\n", normalizedTo, normalizedFrom)
+	return "", nil
 }
 
 // Helper function to safely get status from response
@@ -114,10 +120,19 @@ func getStatus(resp *twilioApi.ApiV2010Message) string {
 }
 
 func (ts *TwilioService) SendVerificationCode(phoneNumber, code string) error {
-	message := fmt.Sprintf("Your verification code is: %s. This code will expire in 5 minutes.", code)
-	return ts.SendSMS(phoneNumber, message)
+	return ts.SendSMS(phoneNumber, OTPMessage(code))
 }
 
 func (ts *TwilioService) IsEnabled() bool {
 	return ts.enabled
 }
+
+// TwilioService as an OTPProvider
+
+func (ts *TwilioService) Name() string    { return "twilio" }
+func (ts *TwilioService) Channel() string { return OTPChannelSMS }
+func (ts *TwilioService) Enabled() bool   { return ts.enabled }
+
+func (ts *TwilioService) SendOTP(ctx context.Context, to OTPRecipient, code string) (string, error) {
+	return ts.sendSMS(to.PhoneNumber, OTPMessage(code))
+}
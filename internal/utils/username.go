@@ -0,0 +1,350 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Username length limits, in characters.
+const (
+	MinUsernameLength = 5
+	MaxUsernameLength = 32
+)
+
+// UsernameChangeCooldown is how long an owner has to wait between changes
+// of its username, so names cannot be churned or squatted in bulk.
+const UsernameChangeCooldown = 24 * time.Hour
+
+// freshClaimGrace protects a claim whose owner is still being created from
+// being mistaken for a leftover of a deleted owner.
+const freshClaimGrace = time.Minute
+
+var (
+	ErrUsernameInvalid  = errors.New("username must be 5-32 characters of letters, digits and underscores, start with a letter and not end with an underscore")
+	ErrUsernameBotName  = errors.New("bot usernames must end in 'bot'")
+	ErrUsernameReserved = errors.New("username is reserved")
+	ErrUsernameTaken    = errors.New("username is already taken")
+)
+
+// UsernameCooldownError is returned when an owner changed its username too
+// recently.
+type UsernameCooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *UsernameCooldownError) Error() string {
+	return fmt.Sprintf("username was changed recently, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// reservedUsernames cannot be claimed by anyone.
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "admins": true, "support": true,
+	"help": true, "helpdesk": true, "official": true, "moderator": true,
+	"security": true, "service": true, "system": true, "settings": true,
+	"notifications": true, "resolve": true, "login": true, "logout": true,
+	"signup": true, "register": true, "account": true, "accounts": true,
+	"privacy": true, "terms": true, "about": true, "contact": true,
+	"everyone": true, "username": true, "undefined": true, "chatapp": true,
+	"botfather": true, "channel": true, "channels": true, "groups": true,
+}
+
+// usernameTarget is where an owner type keeps its username.
+type usernameTarget struct {
+	collection string
+	field      string
+	chatType   string
+}
+
+var usernameTargets = map[string]usernameTarget{
+	"user":    {collection: "users", field: "username"},
+	"group":   {collection: "chats", field: "public_link", chatType: "group"},
+	"channel": {collection: "chats", field: "public_link", chatType: "channel"},
+	"bot":     {collection: "bots", field: "username"},
+}
+
+func (t usernameTarget) filter(ownerID primitive.ObjectID) bson.M {
+	filter := bson.M{"_id": ownerID}
+	if t.chatType != "" {
+		filter["type"] = t.chatType
+	}
+	return filter
+}
+
+// NormalizeUsername strips the @ prefix or link part clients may send along
+// with a username, e.g. "@name" or "t.me/name".
+func NormalizeUsername(username string) string {
+	username = strings.TrimSpace(username)
+	if i := strings.LastIndex(username, "/"); i >= 0 {
+		username = username[i+1:]
+	}
+	return strings.TrimPrefix(username, "@")
+}
+
+// ValidateUsername checks a normalized username against the format rules and
+// the reserved list. Bot usernames must end in "bot".
+func ValidateUsername(ownerType, username string) error {
+	if len(username) < MinUsernameLength || len(username) > MaxUsernameLength {
+		return ErrUsernameInvalid
+	}
+	for i, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9', r == '_':
+			if i == 0 {
+				return ErrUsernameInvalid
+			}
+		default:
+			return ErrUsernameInvalid
+		}
+	}
+	if strings.HasSuffix(username, "_") || strings.Contains(username, "__") {
+		return ErrUsernameInvalid
+	}
+
+	name := strings.ToLower(username)
+	if reservedUsernames[name] {
+		return ErrUsernameReserved
+	}
+	if ownerType == "bot" && !strings.HasSuffix(name, "bot") {
+		return ErrUsernameBotName
+	}
+	return nil
+}
+
+// LookupUsername finds the claim for a username, case-insensitively.
+// mongo.ErrNoDocuments is returned when nobody owns it.
+func LookupUsername(ctx context.Context, db *database.Database, username string) (*models.UsernameClaim, error) {
+	var claim models.UsernameClaim
+	err := db.MongoDB.Collection("usernames").FindOne(
+		ctx,
+		bson.M{"name": strings.ToLower(NormalizeUsername(username))},
+	).Decode(&claim)
+	if err != nil {
+		return nil, err
+	}
+	return &claim, nil
+}
+
+// ClaimUsername reserves a validated username for an owner without touching
+// the owner's record; use it while creating the owner and ChangeUsername
+// afterwards. Claiming a name the owner already holds updates its spelling.
+func ClaimUsername(ctx context.Context, db *database.Database, ownerType string, ownerID primitive.ObjectID, username string) (string, error) {
+	username = NormalizeUsername(username)
+	if err := ValidateUsername(ownerType, username); err != nil {
+		return "", err
+	}
+
+	claims := db.MongoDB.Collection("usernames")
+	claim := models.UsernameClaim{
+		Name:      strings.ToLower(username),
+		Username:  username,
+		OwnerType: ownerType,
+		OwnerID:   ownerID,
+		ClaimedAt: time.Now(),
+	}
+	_, err := claims.InsertOne(ctx, claim)
+	if err == nil {
+		return username, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return "", err
+	}
+
+	existing, err := LookupUsername(ctx, db, username)
+	if err == mongo.ErrNoDocuments {
+		// Released in the meantime
+		return ClaimUsername(ctx, db, ownerType, ownerID, username)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if existing.OwnerType == ownerType && existing.OwnerID == ownerID {
+		_, err := claims.UpdateOne(ctx, bson.M{"_id": existing.ID}, bson.M{"$set": bson.M{"username": username}})
+		return username, err
+	}
+
+	// Owners deleted without releasing their name leave a stale claim behind
+	if stale, err := staleClaim(ctx, db, existing); err != nil || !stale {
+		if err != nil {
+			return "", err
+		}
+		return "", ErrUsernameTaken
+	}
+	result, err := claims.UpdateOne(
+		ctx,
+		bson.M{"_id": existing.ID, "owner_type": existing.OwnerType, "owner_id": existing.OwnerID},
+		bson.M{"$set": bson.M{
+			"username":   username,
+			"owner_type": ownerType,
+			"owner_id":   ownerID,
+			"claimed_at": claim.ClaimedAt,
+		}},
+	)
+	if err != nil {
+		return "", err
+	}
+	if result.ModifiedCount == 0 {
+		return "", ErrUsernameTaken
+	}
+	return username, nil
+}
+
+// staleClaim reports whether the claim's owner no longer exists or no longer
+// uses the name.
+func staleClaim(ctx context.Context, db *database.Database, claim *models.UsernameClaim) (bool, error) {
+	if time.Since(claim.ClaimedAt) < freshClaimGrace {
+		return false, nil
+	}
+	target, ok := usernameTargets[claim.OwnerType]
+	if !ok {
+		return true, nil
+	}
+
+	var owner bson.M
+	err := db.MongoDB.Collection(target.collection).FindOne(
+		ctx,
+		target.filter(claim.OwnerID),
+		options.FindOne().SetProjection(bson.M{target.field: 1}),
+	).Decode(&owner)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	current, _ := owner[target.field].(string)
+	return !strings.EqualFold(NormalizeUsername(current), claim.Name), nil
+}
+
+// ChangeUsername sets, changes or (with an empty username) removes an
+// existing owner's username, in the namespace and on the owner's record.
+// Changes other than capitalization are subject to UsernameChangeCooldown.
+func ChangeUsername(ctx context.Context, db *database.Database, ownerType string, ownerID primitive.ObjectID, username string) (string, error) {
+	target, ok := usernameTargets[ownerType]
+	if !ok {
+		return "", fmt.Errorf("unknown username owner type %q", ownerType)
+	}
+	username = NormalizeUsername(username)
+	if username != "" {
+		if err := ValidateUsername(ownerType, username); err != nil {
+			return "", err
+		}
+	}
+
+	owners := db.MongoDB.Collection(target.collection)
+	var owner bson.M
+	err := owners.FindOne(
+		ctx,
+		target.filter(ownerID),
+		options.FindOne().SetProjection(bson.M{target.field: 1, "username_changed_at": 1}),
+	).Decode(&owner)
+	if err != nil {
+		return "", err
+	}
+	current, _ := owner[target.field].(string)
+	current = NormalizeUsername(current)
+
+	renamed := !strings.EqualFold(current, username)
+	if !renamed && current == username {
+		return username, nil
+	}
+	if renamed {
+		if changedAt, ok := owner["username_changed_at"].(primitive.DateTime); ok {
+			if wait := time.Until(changedAt.Time().Add(UsernameChangeCooldown)); wait > 0 {
+				return "", &UsernameCooldownError{RetryAfter: wait}
+			}
+		}
+	}
+
+	if username != "" {
+		if _, err := ClaimUsername(ctx, db, ownerType, ownerID, username); err != nil {
+			return "", err
+		}
+	}
+
+	set := bson.M{target.field: username, "updated_at": time.Now()}
+	if renamed {
+		set["username_changed_at"] = time.Now()
+	}
+	if _, err := owners.UpdateOne(ctx, target.filter(ownerID), bson.M{"$set": set}); err != nil {
+		if renamed && username != "" {
+			_, _ = db.MongoDB.Collection("usernames").DeleteOne(ctx, bson.M{
+				"name":       strings.ToLower(username),
+				"owner_type": ownerType,
+				"owner_id":   ownerID,
+			})
+		}
+		return "", err
+	}
+
+	// Free the previous name
+	_, err = db.MongoDB.Collection("usernames").DeleteMany(ctx, bson.M{
+		"owner_type": ownerType,
+		"owner_id":   ownerID,
+		"name":       bson.M{"$ne": strings.ToLower(username)},
+	})
+	return username, err
+}
+
+// ReleaseUsername frees every name held by an owner that is being deleted.
+func ReleaseUsername(ctx context.Context, db *database.Database, ownerType string, ownerID primitive.ObjectID) error {
+	_, err := db.MongoDB.Collection("usernames").DeleteMany(ctx, bson.M{"owner_type": ownerType, "owner_id": ownerID})
+	return err
+}
+
+// BackfillUsernames claims the usernames that were set before the shared
+// namespace existed. The oldest owner of a duplicated name keeps the claim;
+// names that cannot be claimed are logged and stay unresolvable.
+func BackfillUsernames(ctx context.Context, db *database.Database) error {
+	for _, ownerType := range []string{"user", "bot", "channel", "group"} {
+		target := usernameTargets[ownerType]
+		filter := bson.M{target.field: bson.M{"$nin": []interface{}{"", nil}}}
+		if target.chatType != "" {
+			filter["type"] = target.chatType
+		}
+		cursor, err := db.MongoDB.Collection(target.collection).Find(
+			ctx,
+			filter,
+			options.Find().SetProjection(bson.M{target.field: 1}).SetSort(bson.M{"_id": 1}),
+		)
+		if err != nil {
+			return err
+		}
+
+		for cursor.Next(ctx) {
+			var owner bson.M
+			if err := cursor.Decode(&owner); err != nil {
+				continue
+			}
+			ownerID, _ := owner["_id"].(primitive.ObjectID)
+			username, _ := owner[target.field].(string)
+
+			count, err := db.MongoDB.Collection("usernames").CountDocuments(ctx, bson.M{"owner_type": ownerType, "owner_id": ownerID})
+			if err != nil || count > 0 {
+				continue
+			}
+			if _, err := ClaimUsername(ctx, db, ownerType, ownerID, username); err != nil {
+				log.Printf("Username %q of %s %s not claimed: %v", username, ownerType, ownerID.Hex(), err)
+			}
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"chat-backend/internal/config"
+)
+
+// COSE algorithm identifiers of the supported passkey keys.
+const (
+	COSEAlgES256 = -7
+	COSEAlgEdDSA = -8
+	COSEAlgRS256 = -257
+)
+
+// Authenticator data flags (WebAuthn §6.1).
+const (
+	authFlagUserPresent    = 0x01
+	authFlagUserVerified   = 0x04
+	authFlagBackupEligible = 0x08
+	authFlagBackupState    = 0x10
+	authFlagAttestedData   = 0x40
+)
+
+var (
+	ErrWebAuthnInvalid = errors.New("invalid WebAuthn response")
+	// ErrPasskeySignCount means the authenticator's counter did not advance,
+	// which indicates a cloned credential.
+	ErrPasskeySignCount = errors.New("passkey sign counter did not increase")
+)
+
+// WebAuthn runs passkey registration and assertion ceremonies for one relying
+// party. Attestation is "none": authenticators are not vetted, only their
+// credential public keys are stored.
+type WebAuthn struct {
+	rpID    string
+	rpName  string
+	origins map[string]bool
+}
+
+func NewWebAuthn(cfg *config.Config) *WebAuthn {
+	origins := make(map[string]bool)
+	for _, origin := range strings.Split(cfg.WebAuthnOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins[strings.TrimSuffix(origin, "/")] = true
+		}
+	}
+	return &WebAuthn{
+		rpID:    cfg.WebAuthnRPID,
+		rpName:  cfg.WebAuthnRPName,
+		origins: origins,
+	}
+}
+
+// PasskeyDescriptor identifies an existing credential in ceremony options.
+type PasskeyDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// NewWebAuthnChallenge returns a random base64url challenge.
+func NewWebAuthnChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeBase64URL accepts base64url with or without padding, which is how
+// browsers and client libraries encode WebAuthn buffers.
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// RegistrationOptions returns PublicKeyCredentialCreationOptions for
+// navigator.credentials.create().
+func (w *WebAuthn) RegistrationOptions(challenge string, userHandle []byte, name, displayName string, exclude []PasskeyDescriptor) map[string]interface{} {
+	if exclude == nil {
+		exclude = []PasskeyDescriptor{}
+	}
+	return map[string]interface{}{
+		"challenge": challenge,
+		"rp":        map[string]string{"id": w.rpID, "name": w.rpName},
+		"user": map[string]string{
+			"id":          base64.RawURLEncoding.EncodeToString(userHandle),
+			"name":        name,
+			"displayName": displayName,
+		},
+		"pubKeyCredParams": []map[string]interface{}{
+			{"type": "public-key", "alg": COSEAlgES256},
+			{"type": "public-key", "alg": COSEAlgEdDSA},
+			{"type": "public-key", "alg": COSEAlgRS256},
+		},
+		"timeout":     300000,
+		"attestation": "none",
+		// Passkeys are discoverable, so logins need no username or phone number
+		"authenticatorSelection": map[string]interface{}{
+			"residentKey":        "required",
+			"requireResidentKey": true,
+			"userVerification":   "preferred",
+		},
+		"excludeCredentials": exclude,
+	}
+}
+
+// AssertionOptions returns PublicKeyCredentialRequestOptions for
+// navigator.credentials.get(). An empty allow list lets the authenticator
+// offer any passkey it holds for this relying party.
+func (w *WebAuthn) AssertionOptions(challenge string, allow []PasskeyDescriptor) map[string]interface{} {
+	if allow == nil {
+		allow = []PasskeyDescriptor{}
+	}
+	return map[string]interface{}{
+		"challenge":        challenge,
+		"rpId":             w.rpID,
+		"timeout":          300000,
+		"userVerification": "preferred",
+		"allowCredentials": allow,
+	}
+}
+
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ClientDataChallenge returns the challenge a response was created for, so
+// the pending ceremony can be looked up before the response is verified.
+func ClientDataChallenge(clientDataJSON []byte) (string, error) {
+	var clientData collectedClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil || clientData.Challenge == "" {
+		return "", ErrWebAuthnInvalid
+	}
+	return clientData.Challenge, nil
+}
+
+func (w *WebAuthn) verifyClientData(clientDataJSON []byte, ceremony, challenge string) error {
+	var clientData collectedClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return ErrWebAuthnInvalid
+	}
+	if clientData.Type != ceremony {
+		return fmt.Errorf("%w: unexpected ceremony type %q", ErrWebAuthnInvalid, clientData.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(clientData.Challenge), []byte(challenge)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrWebAuthnInvalid)
+	}
+	if !w.origins[clientData.Origin] || clientData.CrossOrigin {
+		return fmt.Errorf("%w: origin %q is not allowed", ErrWebAuthnInvalid, clientData.Origin)
+	}
+	return nil
+}
+
+// authenticatorData is the parsed binary authenticator data (WebAuthn §6.1).
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte // COSE_Key
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrWebAuthnInvalid)
+	}
+	ad := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.flags&authFlagAttestedData == 0 {
+		return ad, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrWebAuthnInvalid)
+	}
+	ad.aaguid = rest[:16]
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return nil, fmt.Errorf("%w: invalid credential ID", ErrWebAuthnInvalid)
+	}
+	ad.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	_, n, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid credential public key", ErrWebAuthnInvalid)
+	}
+	ad.publicKey = rest[:n]
+	return ad, nil
+}
+
+func (w *WebAuthn) verifyAuthenticatorData(ad *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(w.rpID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return fmt.Errorf("%w: relying party mismatch", ErrWebAuthnInvalid)
+	}
+	if ad.flags&authFlagUserPresent == 0 {
+		return fmt.Errorf("%w: user not present", ErrWebAuthnInvalid)
+	}
+	return nil
+}
+
+// RegisteredPasskey is a credential created by a verified registration.
+type RegisteredPasskey struct {
+	CredentialID   []byte
+	PublicKey      []byte // COSE_Key
+	Algorithm      int64
+	SignCount      uint32
+	AAGUID         []byte
+	UserVerified   bool
+	BackupEligible bool
+	BackupState    bool
+}
+
+// VerifyRegistration checks a navigator.credentials.create() response
+// against the challenge it was issued for. Attestation statements are not
+// verified, matching the "none" conveyance requested.
+func (w *WebAuthn) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*RegisteredPasskey, error) {
+	if err := w.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrWebAuthnInvalid)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrWebAuthnInvalid)
+	}
+	if _, ok := attestation["fmt"].(string); !ok {
+		return nil, fmt.Errorf("%w: missing attestation format", ErrWebAuthnInvalid)
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authenticator data", ErrWebAuthnInvalid)
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.verifyAuthenticatorData(ad); err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, fmt.Errorf("%w: no credential in response", ErrWebAuthnInvalid)
+	}
+
+	key, err := parseCOSEKey(ad.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RegisteredPasskey{
+		CredentialID:   ad.credentialID,
+		PublicKey:      ad.publicKey,
+		Algorithm:      key.alg,
+		SignCount:      ad.signCount,
+		AAGUID:         ad.aaguid,
+		UserVerified:   ad.flags&authFlagUserVerified != 0,
+		BackupEligible: ad.flags&authFlagBackupEligible != 0,
+		BackupState:    ad.flags&authFlagBackupState != 0,
+	}, nil
+}
+
+// PasskeyAssertion is the verified result of a navigator.credentials.get() response.
+type PasskeyAssertion struct {
+	SignCount    uint32
+	UserVerified bool
+	BackupState  bool
+}
+
+// VerifyAssertion checks a navigator.credentials.get() response signed by a
+// stored credential. Authenticators without counters always report 0;
+// otherwise the counter must increase on every use.
+func (w *WebAuthn) VerifyAssertion(challenge string, publicKey []byte, storedSignCount uint32, clientDataJSON, rawAuthData, signature []byte) (*PasskeyAssertion, error) {
+	if err := w.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.verifyAuthenticatorData(ad); err != nil {
+		return nil, err
+	}
+
+	key, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return nil, fmt.Errorf("%w: bad signature", ErrWebAuthnInvalid)
+	}
+
+	if (ad.signCount != 0 || storedSignCount != 0) && ad.signCount <= storedSignCount {
+		return nil, ErrPasskeySignCount
+	}
+
+	return &PasskeyAssertion{
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&authFlagUserVerified != 0,
+		BackupState:  ad.flags&authFlagBackupState != 0,
+	}, nil
+}
+
+// coseKey is a parsed credential public key (RFC 9053).
+type coseKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+func parseCOSEKey(data []byte) (*coseKey, error) {
+	decoded, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed public key", ErrWebAuthnInvalid)
+	}
+	m, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed public key", ErrWebAuthnInvalid)
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	crv, _ := m[int64(-1)].(int64)
+	unsupported := fmt.Errorf("%w: unsupported public key (kty %d, alg %d)", ErrWebAuthnInvalid, kty, alg)
+
+	switch {
+	case kty == 2 && alg == COSEAlgES256 && crv == 1:
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, unsupported
+		}
+		// ecdh validates that the point is on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, unsupported
+		}
+		return &coseKey{alg: alg, key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+
+	case kty == 1 && alg == COSEAlgEdDSA && crv == 6:
+		x, _ := m[int64(-2)].([]byte)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, unsupported
+		}
+		return &coseKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == 3 && alg == COSEAlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, unsupported
+		}
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+		if exponent < 3 {
+			return nil, unsupported
+		}
+		return &coseKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, nil
+	}
+	return nil, unsupported
+}
+
+func (k *coseKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
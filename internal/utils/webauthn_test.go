@@ -0,0 +1,379 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"chat-backend/internal/config"
+)
+
+const (
+	testRPID   = "chat.example.com"
+	testOrigin = "https://chat.example.com"
+)
+
+// cborMap keeps the key order of an encoded map.
+type cborMap []cborPair
+
+type cborPair struct {
+	key, value interface{}
+}
+
+// encodeCBOR encodes the subset of CBOR that decodeCBOR reads.
+func encodeCBOR(v interface{}) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+		}
+		b := []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		return b
+	}
+
+	switch v := v.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []interface{}:
+		out := head(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case cborMap:
+		out := head(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(out, encodeCBOR(pair.key)...)
+			out = append(out, encodeCBOR(pair.value)...)
+		}
+		return out
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+// softAuthenticator is a software passkey holding one credential.
+type softAuthenticator struct {
+	alg          int64
+	key          crypto.Signer
+	credentialID []byte
+	signCount    uint32
+	counterless  bool // always reports a sign count of 0
+}
+
+func newSoftAuthenticator(t *testing.T, alg int64) *softAuthenticator {
+	t.Helper()
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case COSEAlgES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case COSEAlgEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case COSEAlgRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return &softAuthenticator{alg: alg, key: key, credentialID: id}
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	switch pub := a.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		return encodeCBOR(cborMap{
+			{1, 2}, {3, COSEAlgES256}, {-1, 1},
+			{-2, pub.X.FillBytes(make([]byte, 32))},
+			{-3, pub.Y.FillBytes(make([]byte, 32))},
+		})
+	case ed25519.PublicKey:
+		return encodeCBOR(cborMap{{1, 1}, {3, COSEAlgEdDSA}, {-1, 6}, {-2, []byte(pub)}})
+	case *rsa.PublicKey:
+		return encodeCBOR(cborMap{{1, 3}, {3, COSEAlgRS256}, {-1, pub.N.Bytes()}, {-2, big.NewInt(int64(pub.E)).Bytes()}})
+	}
+	return nil
+}
+
+func (a *softAuthenticator) authData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags := byte(authFlagUserPresent | authFlagUserVerified)
+	if attested {
+		flags |= authFlagAttestedData
+	}
+	data := append(rpIDHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func clientData(ceremony, challenge, origin string) []byte {
+	data, _ := json.Marshal(collectedClientData{Type: ceremony, Challenge: challenge, Origin: origin})
+	return data
+}
+
+// create answers navigator.credentials.create().
+func (a *softAuthenticator) create(challenge, origin, rpID string) (clientDataJSON, attestationObject []byte) {
+	attestationObject = encodeCBOR(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", a.authData(rpID, true)},
+	})
+	return clientData("webauthn.create", challenge, origin), attestationObject
+}
+
+// get answers navigator.credentials.get(), advancing the sign counter.
+func (a *softAuthenticator) get(t *testing.T, challenge, origin, rpID string) (clientDataJSON, authData, signature []byte) {
+	t.Helper()
+	if !a.counterless {
+		a.signCount++
+	}
+	clientDataJSON = clientData("webauthn.get", challenge, origin)
+	authData = a.authData(rpID, false)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authData...), clientDataHash[:]...)
+
+	var err error
+	switch key := a.key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, signed)
+	default:
+		digest := sha256.Sum256(signed)
+		signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientDataJSON, authData, signature
+}
+
+func testWebAuthn() *WebAuthn {
+	return NewWebAuthn(&config.Config{
+		WebAuthnRPID:    testRPID,
+		WebAuthnRPName:  "ChatApp",
+		WebAuthnOrigins: testOrigin + "/, http://localhost:3000",
+	})
+}
+
+func TestWebAuthnCeremonies(t *testing.T) {
+	w := testWebAuthn()
+	for name, alg := range map[string]int64{"ES256": COSEAlgES256, "EdDSA": COSEAlgEdDSA, "RS256": COSEAlgRS256} {
+		t.Run(name, func(t *testing.T) {
+			a := newSoftAuthenticator(t, alg)
+
+			challenge, _ := NewWebAuthnChallenge()
+			clientDataJSON, attestationObject := a.create(challenge, testOrigin, testRPID)
+			passkey, err := w.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+			if err != nil {
+				t.Fatalf("registration: %v", err)
+			}
+			if passkey.Algorithm != alg || string(passkey.CredentialID) != string(a.credentialID) || !passkey.UserVerified {
+				t.Fatalf("unexpected passkey %+v", passkey)
+			}
+
+			signCount := passkey.SignCount
+			for i := 0; i < 2; i++ {
+				challenge, _ = NewWebAuthnChallenge()
+				clientDataJSON, authData, signature := a.get(t, challenge, testOrigin, testRPID)
+				assertion, err := w.VerifyAssertion(challenge, passkey.PublicKey, signCount, clientDataJSON, authData, signature)
+				if err != nil {
+					t.Fatalf("assertion %d: %v", i, err)
+				}
+				if assertion.SignCount != a.signCount {
+					t.Fatalf("got sign count %d, want %d", assertion.SignCount, a.signCount)
+				}
+				signCount = assertion.SignCount
+			}
+		})
+	}
+}
+
+func TestWebAuthnRegistrationRejects(t *testing.T) {
+	w := testWebAuthn()
+	a := newSoftAuthenticator(t, COSEAlgES256)
+	challenge, _ := NewWebAuthnChallenge()
+
+	tests := []struct {
+		name              string
+		challenge         string
+		clientDataJSON    []byte
+		attestationObject []byte
+	}{
+		{"bad origin", challenge, clientData("webauthn.create", challenge, "https://evil.example.com"), nil},
+		{"bad challenge", "other", clientData("webauthn.create", challenge, testOrigin), nil},
+		{"wrong ceremony", challenge, clientData("webauthn.get", challenge, testOrigin), nil},
+		{"bad rpID", challenge, nil, encodeCBOR(cborMap{{"fmt", "none"}, {"authData", a.authData("evil.example.com", true)}})},
+		{"malformed attestation", challenge, nil, []byte{0xa1, 0x63, 'f', 'm'}},
+		{"attestation not a map", challenge, nil, encodeCBOR([]interface{}{"none"})},
+		{"no credential", challenge, nil, encodeCBOR(cborMap{{"fmt", "none"}, {"authData", a.authData(testRPID, false)}})},
+		{"malformed public key", challenge, nil, encodeCBOR(cborMap{{"fmt", "none"}, {"authData", a.authData(testRPID, true)[:len(a.authData(testRPID, true))-10]}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientDataJSON, attestationObject := a.create(challenge, testOrigin, testRPID)
+			if tt.clientDataJSON != nil {
+				clientDataJSON = tt.clientDataJSON
+			}
+			if tt.attestationObject != nil {
+				attestationObject = tt.attestationObject
+			}
+			if _, err := w.VerifyRegistration(tt.challenge, clientDataJSON, attestationObject); !errors.Is(err, ErrWebAuthnInvalid) {
+				t.Fatalf("got %v, want ErrWebAuthnInvalid", err)
+			}
+		})
+	}
+}
+
+func TestWebAuthnAssertionRejects(t *testing.T) {
+	w := testWebAuthn()
+	a := newSoftAuthenticator(t, COSEAlgES256)
+	challenge, _ := NewWebAuthnChallenge()
+	clientDataJSON, attestationObject := a.create(challenge, testOrigin, testRPID)
+	passkey, err := w.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("bad origin", func(t *testing.T) {
+		clientDataJSON, authData, signature := a.get(t, challenge, "https://evil.example.com", testRPID)
+		if _, err := w.VerifyAssertion(challenge, passkey.PublicKey, 0, clientDataJSON, authData, signature); !errors.Is(err, ErrWebAuthnInvalid) {
+			t.Fatalf("got %v, want ErrWebAuthnInvalid", err)
+		}
+	})
+
+	t.Run("bad challenge", func(t *testing.T) {
+		clientDataJSON, authData, signature := a.get(t, challenge, testOrigin, testRPID)
+		if _, err := w.VerifyAssertion("other", passkey.PublicKey, 0, clientDataJSON, authData, signature); !errors.Is(err, ErrWebAuthnInvalid) {
+			t.Fatalf("got %v, want ErrWebAuthnInvalid", err)
+		}
+	})
+
+	t.Run("bad rpID", func(t *testing.T) {
+		clientDataJSON, authData, signature := a.get(t, challenge, testOrigin, "evil.example.com")
+		if _, err := w.VerifyAssertion(challenge, passkey.PublicKey, 0, clientDataJSON, authData, signature); !errors.Is(err, ErrWebAuthnInvalid) {
+			t.Fatalf("got %v, want ErrWebAuthnInvalid", err)
+		}
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		clientDataJSON, authData, signature := a.get(t, challenge, testOrigin, testRPID)
+		other := newSoftAuthenticator(t, COSEAlgES256)
+		if _, err := w.VerifyAssertion(challenge, other.coseKey(), 0, clientDataJSON, authData, signature); !errors.Is(err, ErrWebAuthnInvalid) {
+			t.Fatalf("got %v, want ErrWebAuthnInvalid", err)
+		}
+	})
+
+	t.Run("sign counter not increased", func(t *testing.T) {
+		clientDataJSON, authData, signature := a.get(t, challenge, testOrigin, testRPID)
+		if _, err := w.VerifyAssertion(challenge, passkey.PublicKey, a.signCount, clientDataJSON, authData, signature); err != ErrPasskeySignCount {
+			t.Fatalf("got %v, want ErrPasskeySignCount", err)
+		}
+	})
+
+	t.Run("sign counter went back", func(t *testing.T) {
+		clientDataJSON, authData, signature := a.get(t, challenge, testOrigin, testRPID)
+		if _, err := w.VerifyAssertion(challenge, passkey.PublicKey, a.signCount+10, clientDataJSON, authData, signature); err != ErrPasskeySignCount {
+			t.Fatalf("got %v, want ErrPasskeySignCount", err)
+		}
+	})
+
+	t.Run("counterless authenticator", func(t *testing.T) {
+		counterless := newSoftAuthenticator(t, COSEAlgEdDSA)
+		counterless.counterless = true
+		clientDataJSON, authData, signature := counterless.get(t, challenge, testOrigin, testRPID)
+		if _, err := w.VerifyAssertion(challenge, counterless.coseKey(), 0, clientDataJSON, authData, signature); err != nil {
+			t.Fatalf("got %v, want success", err)
+		}
+	})
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	data := encodeCBOR(cborMap{
+		{"fmt", "none"},
+		{-3, []byte{1, 2, 3}},
+		{"list", []interface{}{int64(1), int64(-500), true, nil, "x"}},
+	})
+	v, n, err := decodeCBOR(append(data, 0xff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data) {
+		t.Fatalf("used %d bytes, want %d", n, len(data))
+	}
+	m := v.(map[interface{}]interface{})
+	list := m["list"].([]interface{})
+	if m["fmt"] != "none" || string(m[int64(-3)].([]byte)) != "\x01\x02\x03" || list[1] != int64(-500) || list[2] != true || list[3] != nil {
+		t.Fatalf("unexpected value %#v", v)
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	deep := make([]byte, maxCBORDepth+2)
+	for i := range deep {
+		deep[i] = 0x81 // array of one item
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, errCBORTruncated},
+		{"truncated argument", []byte{0x19, 0x01}, errCBORTruncated},
+		{"truncated byte string", []byte{0x45, 1, 2}, errCBORTruncated},
+		{"huge byte string", []byte{0x5b, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, errCBORTruncated},
+		{"huge array", []byte{0x9b, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, errCBORTruncated},
+		{"huge map", []byte{0xba, 0xff, 0xff, 0xff, 0xff}, errCBORTruncated},
+		{"truncated map", []byte{0xa2, 0x01, 0x02, 0x03}, errCBORTruncated},
+		{"indefinite array", []byte{0x9f, 0x01, 0xff}, errCBORUnsupported},
+		{"integer overflow", []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, errCBORUnsupported},
+		{"negative overflow", []byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, errCBORUnsupported},
+		{"byte string map key", []byte{0xa1, 0x41, 0x00, 0x01}, errCBORUnsupported},
+		{"tag", []byte{0xc0, 0x01}, errCBORUnsupported},
+		{"float", []byte{0xfb, 0, 0, 0, 0, 0, 0, 0, 0}, errCBORUnsupported},
+		{"too deep", append(deep, 0x01), errCBORUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(tt.data); err != tt.want {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
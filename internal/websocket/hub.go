@@ -1,35 +1,121 @@
 package websocket
 
 import (
+	"sync"
+
+	"chat-backend/internal/database"
 	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
 
 	"github.com/gorilla/websocket"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Client struct {
-	ID     primitive.ObjectID
-	Conn   *websocket.Conn
-	Hub    *Hub
-	Send   chan []byte
-	Chats  map[primitive.ObjectID]bool
+	ID    primitive.ObjectID
+	Conn  *websocket.Conn
+	Hub   *Hub
+	Send  chan []byte
+	Chats map[primitive.ObjectID]bool
+
+	// The session the connection was opened with; it is kept active by
+	// client traffic and the connection closes when the session ends.
+	Claims   *utils.Claims
+	Session  *models.AuthSession
+	Sessions *utils.SessionService
+
+	// Used to check chat membership before joining a room
+	DB *database.Database
+
+	// Users this user blocked or was blocked by; their messages are dropped
+	blockedMu sync.RWMutex
+	blocked   map[primitive.ObjectID]bool
+}
+
+// isBlocked reports whether the client's user and the other user are
+// separated by a block.
+func (c *Client) isBlocked(userID primitive.ObjectID) bool {
+	c.blockedMu.RLock()
+	defer c.blockedMu.RUnlock()
+	return c.blocked[userID]
+}
+
+func (c *Client) setBlocked(userID primitive.ObjectID, blocked bool) {
+	c.blockedMu.Lock()
+	defer c.blockedMu.Unlock()
+	if c.blocked == nil {
+		c.blocked = make(map[primitive.ObjectID]bool)
+	}
+	if blocked {
+		c.blocked[userID] = true
+	} else {
+		delete(c.blocked, userID)
+	}
+}
+
+// roomChange adds a client to a chat room or removes it. Without a client it
+// removes every connection of the user.
+type roomChange struct {
+	client *Client
+	userID primitive.ObjectID
+	chatID primitive.ObjectID
+	join   bool
+}
+
+// blockChange records whether a block separates two users.
+type blockChange struct {
+	a, b    primitive.ObjectID
+	blocked bool
+}
+
+// roomMessage is a chat message for every connection in the chat's room.
+type roomMessage struct {
+	chatID  primitive.ObjectID
+	message models.Message
+}
+
+// clientMessage is an event for one connection.
+type clientMessage struct {
+	client  *Client
+	payload []byte
+}
+
+// directMessage is an event for every connection of one user.
+type directMessage struct {
+	userID  primitive.ObjectID
+	payload []byte
 }
 
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
-	unregister chan *Client
-	rooms      map[primitive.ObjectID]map[*Client]bool
+	clients        map[*Client]bool
+	broadcast      chan []byte
+	register       chan *Client
+	unregister     chan *Client
+	rooms          map[primitive.ObjectID]map[*Client]bool
+	direct         chan directMessage
+	clientMessages chan clientMessage
+	roomMessages   chan roomMessage
+	roomChanges    chan roomChange
+	blockChanges   chan blockChange
+
+	// QR login waiters, keyed by login token hash
+	qrMu      sync.Mutex
+	qrWaiters map[string]chan []byte
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		rooms:      make(map[primitive.ObjectID]map[*Client]bool),
+		clients:        make(map[*Client]bool),
+		broadcast:      make(chan []byte),
+		register:       make(chan *Client),
+		unregister:     make(chan *Client),
+		rooms:          make(map[primitive.ObjectID]map[*Client]bool),
+		direct:         make(chan directMessage, 64),
+		clientMessages: make(chan clientMessage, 64),
+		roomMessages:   make(chan roomMessage, 256),
+		roomChanges:    make(chan roomChange, 64),
+		blockChanges:   make(chan blockChange, 64),
+		qrWaiters:      make(map[string]chan []byte),
 	}
 }
 
@@ -47,15 +133,62 @@ func (h *Hub) Run() {
 
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.Send)
-				for chatID := range client.Chats {
-					if room, ok := h.rooms[chatID]; ok {
-						delete(room, client)
-						if len(room) == 0 {
-							delete(h.rooms, chatID)
-						}
-					}
+				h.drop(client)
+			}
+
+		case change := <-h.roomChanges:
+			if change.client != nil {
+				if _, ok := h.clients[change.client]; ok {
+					h.applyRoomChange(change.client, change.chatID, change.join)
+				}
+				continue
+			}
+			for client := range h.clients {
+				if client.ID == change.userID {
+					h.applyRoomChange(client, change.chatID, false)
+				}
+			}
+
+		case change := <-h.blockChanges:
+			for client := range h.clients {
+				switch client.ID {
+				case change.a:
+					client.setBlocked(change.b, change.blocked)
+				case change.b:
+					client.setBlocked(change.a, change.blocked)
+				}
+			}
+
+		case message := <-h.roomMessages:
+			for client := range h.rooms[message.chatID] {
+				if !message.message.SenderID.IsZero() && client.isBlocked(message.message.SenderID) {
+					continue
+				}
+				select {
+				case client.Send <- []byte(message.message.Content):
+				default:
+					h.drop(client)
+				}
+			}
+
+		case message := <-h.clientMessages:
+			// The client may already be gone and its Send channel closed
+			if _, ok := h.clients[message.client]; !ok {
+				continue
+			}
+			select {
+			case message.client.Send <- message.payload:
+			default:
+			}
+
+		case message := <-h.direct:
+			for client := range h.clients {
+				if client.ID != message.userID {
+					continue
+				}
+				select {
+				case client.Send <- message.payload:
+				default:
 				}
 			}
 
@@ -64,28 +197,110 @@ func (h *Hub) Run() {
 				select {
 				case client.Send <- message:
 				default:
-					close(client.Send)
-					delete(h.clients, client)
+					h.drop(client)
 				}
 			}
 		}
 	}
 }
 
+// drop removes a client and closes its connection. It is only called from Run,
+// which owns the client and room maps.
+func (h *Hub) drop(client *Client) {
+	delete(h.clients, client)
+	close(client.Send)
+	for chatID := range client.Chats {
+		if room, ok := h.rooms[chatID]; ok {
+			delete(room, client)
+			if len(room) == 0 {
+				delete(h.rooms, chatID)
+			}
+		}
+	}
+}
+
+// BroadcastToRoom sends a message to every connection in the chat's room,
+// except those of users separated from the sender by a block.
 func (h *Hub) BroadcastToRoom(chatID primitive.ObjectID, message models.Message) {
+	h.roomMessages <- roomMessage{chatID: chatID, message: message}
+}
+
+// applyRoomChange is only called from Run, which owns the room maps.
+func (h *Hub) applyRoomChange(client *Client, chatID primitive.ObjectID, join bool) {
+	if join {
+		if h.rooms[chatID] == nil {
+			h.rooms[chatID] = make(map[*Client]bool)
+		}
+		h.rooms[chatID][client] = true
+		client.Chats[chatID] = true
+		return
+	}
+
+	delete(client.Chats, chatID)
 	if room, ok := h.rooms[chatID]; ok {
-		for client := range room {
-			select {
-			case client.Send <- []byte(message.Content):
-			default:
-				close(client.Send)
-				delete(h.clients, client)
-			}
+		delete(room, client)
+		if len(room) == 0 {
+			delete(h.rooms, chatID)
 		}
 	}
 }
 
+// LeaveRoom stops sending a chat's messages to the user's connections, e.g.
+// after they were removed from it.
+func (h *Hub) LeaveRoom(userID, chatID primitive.ObjectID) {
+	h.roomChanges <- roomChange{userID: userID, chatID: chatID}
+}
+
+// SetBlocked records whether a block still separates the two users, so that
+// their open connections stop or resume exchanging messages.
+func (h *Hub) SetBlocked(a, b primitive.ObjectID, blocked bool) {
+	h.blockChanges <- blockChange{a: a, b: b, blocked: blocked}
+}
+
+// SendToUser delivers an event to every connected client of the user.
+func (h *Hub) SendToUser(userID primitive.ObjectID, payload []byte) {
+	h.direct <- directMessage{userID: userID, payload: payload}
+}
 
+// WaitQRLogin registers a web client waiting for its QR login to be approved.
+// Only one client can wait for a token; ok is false if one already does.
+func (h *Hub) WaitQRLogin(tokenHash string) (ch chan []byte, ok bool) {
+	h.qrMu.Lock()
+	defer h.qrMu.Unlock()
+	if _, waiting := h.qrWaiters[tokenHash]; waiting {
+		return nil, false
+	}
+	ch = make(chan []byte, 1)
+	h.qrWaiters[tokenHash] = ch
+	return ch, true
+}
 
+// StopWaitingQRLogin removes the QR login waiter registered with ch.
+func (h *Hub) StopWaitingQRLogin(tokenHash string, ch chan []byte) {
+	h.qrMu.Lock()
+	defer h.qrMu.Unlock()
+	if h.qrWaiters[tokenHash] == ch {
+		delete(h.qrWaiters, tokenHash)
+	}
+}
 
+// HasQRLoginWaiter reports whether a web client is connected for the token.
+func (h *Hub) HasQRLoginWaiter(tokenHash string) bool {
+	h.qrMu.Lock()
+	defer h.qrMu.Unlock()
+	_, ok := h.qrWaiters[tokenHash]
+	return ok
+}
 
+// DeliverQRLogin hands the login result to the waiting web client.
+func (h *Hub) DeliverQRLogin(tokenHash string, payload []byte) bool {
+	h.qrMu.Lock()
+	defer h.qrMu.Unlock()
+	ch, ok := h.qrWaiters[tokenHash]
+	if !ok {
+		return false
+	}
+	delete(h.qrWaiters, tokenHash)
+	ch <- payload
+	return true
+}
@@ -2,14 +2,19 @@ package websocket
 
 import (
 	"chat-backend/internal/database"
+	"chat-backend/internal/models"
 	"chat-backend/internal/utils"
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var upgrader = websocket.Upgrader{
@@ -20,7 +25,7 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-func HandleWebSocket(hub *Hub, c *gin.Context, db *database.Database) {
+func HandleWebSocket(hub *Hub, c *gin.Context, db *database.Database, sessions *utils.SessionService) {
 	// Get user ID from token
 	token := c.Query("token")
 	if token == "" {
@@ -34,6 +39,32 @@ func HandleWebSocket(hub *Hub, c *gin.Context, db *database.Database) {
 		return
 	}
 
+	session, err := sessions.Validate(c.Request.Context(), claims)
+	if err == utils.ErrSessionIdle {
+		c.JSON(401, gin.H{"error": "Session ended after inactivity", "reason": "auto_logout"})
+		return
+	}
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Session expired or terminated"})
+		return
+	}
+
+	status, err := utils.AccountStatus(c.Request.Context(), db, claims.UserID)
+	if err != nil || status == "deleted" {
+		c.JSON(401, gin.H{"error": "Account not found or deleted"})
+		return
+	}
+	if status == "suspended" {
+		c.JSON(403, gin.H{"error": "Account is suspended", "account_status": status})
+		return
+	}
+
+	blocked, err := utils.BlockedWith(c.Request.Context(), db, claims.UserID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load blocked users"})
+		return
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -41,11 +72,16 @@ func HandleWebSocket(hub *Hub, c *gin.Context, db *database.Database) {
 	}
 
 	client := &Client{
-		ID:    claims.UserID,
-		Conn:  conn,
-		Hub:   hub,
-		Send:  make(chan []byte, 256),
-		Chats: make(map[primitive.ObjectID]bool),
+		ID:       claims.UserID,
+		Conn:     conn,
+		Hub:      hub,
+		Send:     make(chan []byte, 256),
+		Chats:    make(map[primitive.ObjectID]bool),
+		Claims:   claims,
+		Session:  session,
+		Sessions: sessions,
+		DB:       db,
+		blocked:  blocked,
 	}
 
 	client.Hub.register <- client
@@ -69,6 +105,9 @@ func (c *Client) readPump() {
 			break
 		}
 
+		// Client traffic counts as activity for auto-logout
+		_ = c.Sessions.Touch(context.Background(), c.Session)
+
 		var msg map[string]interface{}
 		if err := json.Unmarshal(message, &msg); err != nil {
 			continue
@@ -78,23 +117,90 @@ func (c *Client) readPump() {
 		switch msg["type"] {
 		case "join_chat":
 			if chatIDStr, ok := msg["chat_id"].(string); ok {
-				chatID, _ := primitive.ObjectIDFromHex(chatIDStr)
-				c.Chats[chatID] = true
+				c.joinChat(chatIDStr)
 			}
 		case "leave_chat":
 			if chatIDStr, ok := msg["chat_id"].(string); ok {
 				chatID, _ := primitive.ObjectIDFromHex(chatIDStr)
-				delete(c.Chats, chatID)
+				c.Hub.roomChanges <- roomChange{client: c, chatID: chatID}
 			}
 		}
 	}
 }
 
+// joinChat subscribes the connection to a chat's messages if the user may
+// read the chat, and tells the client why not otherwise.
+func (c *Client) joinChat(chatIDStr string) {
+	chatID, err := primitive.ObjectIDFromHex(chatIDStr)
+	if err != nil {
+		c.sendError(chatIDStr, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	_, err = utils.ChatForReader(context.Background(), c.DB, chatID, c.ID)
+	switch err {
+	case nil:
+		c.Hub.roomChanges <- roomChange{client: c, chatID: chatID, join: true}
+	case mongo.ErrNoDocuments:
+		c.sendError(chatIDStr, http.StatusNotFound, "Chat not found")
+	case utils.ErrNotChatMember:
+		c.sendError(chatIDStr, http.StatusForbidden, "You are not a member of this chat")
+	default:
+		c.sendError(chatIDStr, http.StatusInternalServerError, "Failed to load chat")
+	}
+}
+
+// sendError reports a rejected request to the client. It goes through the
+// hub, which owns the Send channel and closes it when dropping the client.
+func (c *Client) sendError(chatID string, status int, message string) {
+	payload, _ := json.Marshal(gin.H{"type": "error", "chat_id": chatID, "status": status, "error": message})
+	c.Hub.clientMessages <- clientMessage{client: c, payload: payload}
+}
+
+// sessionCheckInterval is how often an open connection re-validates its session.
+const sessionCheckInterval = 30 * time.Second
+
+// sessionEnded returns why the connection's session is no longer valid, or
+// "" while it is.
+func (c *Client) sessionEnded() string {
+	_, err := c.Sessions.Validate(context.Background(), c.Claims)
+	switch err {
+	case nil:
+		return ""
+	case utils.ErrSessionIdle:
+		return "auto_logout"
+	case utils.ErrSessionNotFound, utils.ErrSessionRevoked:
+		return "session_terminated"
+	}
+	return "" // transient lookup failures do not drop the connection
+}
+
+// closeForSession tells the client why its session ended and closes the connection.
+func (c *Client) closeForSession(reason string) {
+	payload, _ := json.Marshal(gin.H{"type": "session_ended", "reason": reason})
+	_ = c.Conn.WriteMessage(websocket.TextMessage, payload)
+	_ = c.Conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason),
+		time.Now().Add(time.Second),
+	)
+}
+
 func (c *Client) writePump() {
-	defer c.Conn.Close()
+	ticker := time.NewTicker(sessionCheckInterval)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
 
 	for {
 		select {
+		case <-ticker.C:
+			if reason := c.sessionEnded(); reason != "" {
+				c.closeForSession(reason)
+				return
+			}
+
 		case message, ok := <-c.Send:
 			if !ok {
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
@@ -109,3 +215,56 @@ func (c *Client) writePump() {
 	}
 }
 
+// HandleQRLoginWebSocket lets an unauthenticated web client wait for its QR
+// login to be approved. The approval (with tokens) is sent as a single
+// message, after which the connection is closed.
+func HandleQRLoginWebSocket(hub *Hub, c *gin.Context, db *database.Database) {
+	tokenHash := utils.HashToken(c.Query("qr_login"))
+
+	var login models.QRLoginToken
+	err := db.MongoDB.Collection("qr_login_tokens").FindOne(
+		context.Background(),
+		bson.M{"token_hash": tokenHash, "status": "pending", "expires_at": bson.M{"$gt": time.Now()}},
+	).Decode(&login)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid or expired login token"})
+		return
+	}
+
+	result, ok := hub.WaitQRLogin(tokenHash)
+	if !ok {
+		c.JSON(409, gin.H{"error": "Another client is already waiting for this login"})
+		return
+	}
+	defer hub.StopWaitingQRLogin(tokenHash, result)
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Detect the client going away while we wait.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	timer := time.NewTimer(time.Until(login.ExpiresAt))
+	defer timer.Stop()
+
+	select {
+	case payload := <-result:
+		conn.WriteMessage(websocket.TextMessage, payload)
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "approved"))
+	case <-timer.C:
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "expired"))
+	case <-closed:
+	}
+}
@@ -0,0 +1,183 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func testClient(hub *Hub, db *database.Database) *Client {
+	return &Client{
+		ID:    primitive.NewObjectID(),
+		Hub:   hub,
+		Send:  make(chan []byte, 8),
+		Chats: make(map[primitive.ObjectID]bool),
+		DB:    db,
+	}
+}
+
+// rejection reads the error the hub was asked to send the client.
+func rejection(t *testing.T, client *Client) int {
+	t.Helper()
+	select {
+	case message := <-client.Hub.clientMessages:
+		if message.client != client {
+			t.Fatal("error was addressed to another client")
+		}
+		payload := message.payload
+		var msg struct {
+			Type   string `json:"type"`
+			Status int    `json:"status"`
+		}
+		if err := json.Unmarshal(payload, &msg); err != nil || msg.Type != "error" {
+			t.Fatalf("unexpected payload %s", payload)
+		}
+		return msg.Status
+	default:
+		t.Fatal("client was not told about the rejection")
+	}
+	return 0
+}
+
+func TestJoinChat(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	chatID := primitive.NewObjectID()
+
+	mt.Run("not a member", func(mt *mtest.T) {
+		hub := NewHub()
+		client := testClient(hub, &database.Database{MongoDB: mt.DB})
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: chatID},
+			{Key: "type", Value: "group"},
+			{Key: "members", Value: []primitive.ObjectID{primitive.NewObjectID()}},
+		}))
+
+		client.joinChat(chatID.Hex())
+		if status := rejection(t, client); status != http.StatusForbidden {
+			t.Fatalf("got status %d, want %d", status, http.StatusForbidden)
+		}
+		if len(hub.roomChanges) != 0 {
+			t.Fatal("rejected client was added to the room")
+		}
+	})
+
+	mt.Run("missing chat", func(mt *mtest.T) {
+		hub := NewHub()
+		client := testClient(hub, &database.Database{MongoDB: mt.DB})
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch))
+
+		client.joinChat(chatID.Hex())
+		if status := rejection(t, client); status != http.StatusNotFound {
+			t.Fatalf("got status %d, want %d", status, http.StatusNotFound)
+		}
+		if len(hub.roomChanges) != 0 {
+			t.Fatal("rejected client was added to the room")
+		}
+	})
+
+	mt.Run("invalid ID", func(mt *mtest.T) {
+		hub := NewHub()
+		client := testClient(hub, &database.Database{MongoDB: mt.DB})
+
+		client.joinChat("nope")
+		if status := rejection(t, client); status != http.StatusBadRequest {
+			t.Fatalf("got status %d, want %d", status, http.StatusBadRequest)
+		}
+	})
+
+	mt.Run("member", func(mt *mtest.T) {
+		hub := NewHub()
+		client := testClient(hub, &database.Database{MongoDB: mt.DB})
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: chatID},
+			{Key: "type", Value: "group"},
+			{Key: "members", Value: []primitive.ObjectID{client.ID}},
+		}))
+
+		client.joinChat(chatID.Hex())
+		change := <-hub.roomChanges
+		if change.client != client || change.chatID != chatID || !change.join {
+			t.Fatalf("unexpected room change %+v", change)
+		}
+	})
+}
+
+func TestBroadcastToRoom(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	chatID := primitive.NewObjectID()
+	member := testClient(hub, nil)
+	member.Chats[chatID] = true
+	outsider := testClient(hub, nil)
+	hub.register <- member
+	hub.register <- outsider
+
+	hub.BroadcastToRoom(chatID, models.Message{ChatID: chatID, Content: "hello"})
+
+	select {
+	case payload := <-member.Send:
+		if string(payload) != "hello" {
+			t.Fatalf("got %q", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("room member did not get the message")
+	}
+	select {
+	case payload := <-outsider.Send:
+		t.Fatalf("client outside the room got %q", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestQRLoginWaiters(t *testing.T) {
+	hub := NewHub()
+
+	first, ok := hub.WaitQRLogin("token")
+	if !ok {
+		t.Fatal("first waiter was rejected")
+	}
+	if _, ok := hub.WaitQRLogin("token"); ok {
+		t.Fatal("second waiter was accepted")
+	}
+
+	hub.StopWaitingQRLogin("token", first)
+	second, ok := hub.WaitQRLogin("token")
+	if !ok {
+		t.Fatal("waiter was rejected after the first one left")
+	}
+
+	// A waiter that already left must not remove its successor
+	hub.StopWaitingQRLogin("token", first)
+	if !hub.DeliverQRLogin("token", []byte("approved")) {
+		t.Fatal("waiting client was removed")
+	}
+	if payload := <-second; string(payload) != "approved" {
+		t.Fatalf("got %q", payload)
+	}
+}
+
+func TestSendErrorAfterDrop(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	client := testClient(hub, nil)
+	hub.register <- client
+	hub.unregister <- client
+
+	// The hub closed Send; the error must be discarded instead of panicking
+	client.sendError("chat", http.StatusForbidden, "You are not a member of this chat")
+	hub.register <- testClient(hub, nil) // wait for the hub to handle the error
+
+	if _, ok := <-client.Send; ok {
+		t.Fatal("dropped client got a message")
+	}
+}
@@ -0,0 +1,179 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"chat-backend/internal/database"
+	"chat-backend/internal/models"
+	"chat-backend/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	selfDestructInterval = time.Hour
+	// selfDestructWarningLead is how long before deletion the warning goes out.
+	selfDestructWarningLead = 7 * 24 * time.Hour
+	// selfDestructMinNotice is the least time between the warning and the
+	// deletion, even when the account is already past its TTL.
+	selfDestructMinNotice = 24 * time.Hour
+)
+
+// SelfDestructWorker deletes accounts that have been inactive for longer
+// than their self-destruct TTL. Owners are warned in their service chat and
+// by email before deletion, and accounts whose warning could not be
+// delivered are not deleted; any activity after the warning cancels it. It also retries deletions of
+// accounts that were deleted by their owners.
+type SelfDestructWorker struct {
+	db     *database.Database
+	mailer utils.Mailer
+}
+
+func NewSelfDestructWorker(db *database.Database, mailer utils.Mailer) *SelfDestructWorker {
+	return &SelfDestructWorker{db: db, mailer: mailer}
+}
+
+// Run processes accounts periodically until ctx is cancelled.
+func (w *SelfDestructWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(selfDestructInterval)
+	defer ticker.Stop()
+
+	for {
+		w.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce warns and deletes inactive accounts that are due, and finishes
+// deletions that failed part way.
+func (w *SelfDestructWorker) RunOnce(ctx context.Context) {
+	w.purgeDeleted(ctx)
+
+	cursor, err := w.db.MongoDB.Collection("users").Find(ctx, bson.M{
+		"self_destruct_ttl": bson.M{"$gt": 0},
+		"account_status":    bson.M{"$ne": "deleted"},
+	})
+	if err != nil {
+		log.Printf("Self-destruct: failed to list users: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	now := time.Now()
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			continue
+		}
+
+		lastActive := user.LastActive
+		if lastActive.IsZero() {
+			lastActive = user.CreatedAt
+		}
+		ttl := user.SelfDestructTTL
+		if ttl < utils.MinSelfDestructTTL {
+			ttl = utils.MinSelfDestructTTL
+		}
+		deadline := lastActive.AddDate(0, 0, ttl)
+
+		// A warning sent before the latest activity no longer counts
+		warned := user.SelfDestructWarnedAt != nil && !user.SelfDestructWarnedAt.Before(lastActive)
+
+		switch {
+		case !warned && now.After(deadline.Add(-selfDestructWarningLead)):
+			w.warn(ctx, user, deadline)
+		case warned && now.After(deadline) && now.Sub(*user.SelfDestructWarnedAt) >= selfDestructMinNotice:
+			w.destroy(ctx, user)
+		}
+	}
+}
+
+func (w *SelfDestructWorker) warn(ctx context.Context, user models.User, deadline time.Time) {
+	if deadline.Before(time.Now().Add(selfDestructMinNotice)) {
+		deadline = time.Now().Add(selfDestructMinNotice)
+	}
+
+	body := fmt.Sprintf("Your ChatApp account has been inactive and will be deleted on %s together with all messages and contacts.\n\nLog in before then to keep it.", deadline.Format("2 January 2006"))
+	delivered := false
+	if _, err := utils.SendServiceMessage(ctx, w.db, user.ID, body); err != nil {
+		log.Printf("Self-destruct: failed to post warning to user %s: %v", user.ID.Hex(), err)
+	} else {
+		delivered = true
+	}
+	// One email is enough; the recovery address is tried if the account
+	// address fails
+	for _, email := range []string{user.Email, user.RecoveryEmail} {
+		if email == "" {
+			continue
+		}
+		if err := w.mailer.SendMail(email, "Your account will be deleted", body); err != nil {
+			log.Printf("Self-destruct: failed to email warning to user %s: %v", user.ID.Hex(), err)
+			continue
+		}
+		delivered = true
+		break
+	}
+
+	// Without a delivered warning the account is not marked, so it is not
+	// deleted and the warning is retried on the next run
+	if !delivered {
+		return
+	}
+
+	// The warning is also shown to the user by the apps via self_destruct_warned_at
+	_, err := w.db.MongoDB.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"self_destruct_warned_at": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("Self-destruct: failed to record warning for user %s: %v", user.ID.Hex(), err)
+		return
+	}
+	log.Printf("Self-destruct: warned user %s, deletion due %s", user.ID.Hex(), deadline.Format(time.RFC3339))
+}
+
+func (w *SelfDestructWorker) destroy(ctx context.Context, user models.User) {
+	// Make sure the user hasn't come back since the scan started
+	err := w.db.MongoDB.Collection("users").FindOne(ctx, bson.M{
+		"_id":         user.ID,
+		"last_active": user.LastActive,
+	}).Err()
+	if err != nil {
+		return
+	}
+
+	if err := utils.DeleteAccountData(ctx, w.db, user.ID); err != nil {
+		log.Printf("Self-destruct: failed to delete user %s: %v", user.ID.Hex(), err)
+		return
+	}
+	log.Printf("Self-destruct: deleted inactive user %s", user.ID.Hex())
+}
+
+// purgeDeleted removes the data of accounts marked deleted whose removal
+// did not complete.
+func (w *SelfDestructWorker) purgeDeleted(ctx context.Context) {
+	cursor, err := w.db.MongoDB.Collection("users").Find(ctx, bson.M{"account_status": "deleted"})
+	if err != nil {
+		log.Printf("Self-destruct: failed to list deleted users: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			continue
+		}
+		if err := utils.DeleteAccountData(ctx, w.db, user.ID); err != nil {
+			log.Printf("Self-destruct: failed to purge deleted user %s: %v", user.ID.Hex(), err)
+		}
+	}
+}
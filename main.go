@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"strings"
@@ -9,7 +10,9 @@ import (
 	"chat-backend/internal/database"
 	"chat-backend/internal/middleware"
 	"chat-backend/internal/router"
+	"chat-backend/internal/utils"
 	"chat-backend/internal/websocket"
+	"chat-backend/internal/workers"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -45,6 +48,14 @@ func main() {
 	db := database.Initialize(cfg)
 	defer db.Close()
 
+	// Unique indexes back the shared username namespace
+	if err := db.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create database indexes:", err)
+	}
+	if err := utils.BackfillUsernames(context.Background(), db); err != nil {
+		log.Printf("Username backfill incomplete: %v", err)
+	}
+
 	// Initialize WebSocket hub
 	hub := websocket.NewHub()
 	go hub.Run()
@@ -62,6 +73,31 @@ func main() {
 		gin.SetMode(ginMode)
 	}
 
+	// Access token keys; refuse to run in production with a well-known secret
+	if gin.Mode() == gin.ReleaseMode && cfg.InsecureJWTSecret() {
+		log.Fatal("Refusing to start: JWT_SECRET is unset or a default value. Set a strong JWT_SECRET or use JWT_ALGORITHM=RS256/EdDSA with a private key.")
+	}
+	// The local mailbox does not deliver email
+	if gin.Mode() == gin.ReleaseMode && cfg.MailDriver == "mailbox" {
+		log.Fatal("Refusing to start: MAIL_DRIVER=mailbox must not be used in release mode.")
+	}
+
+	// Development OTP delivery hands codes to whoever asks for them
+	if gin.Mode() == gin.ReleaseMode && cfg.OTPDevSinkEnabled {
+		log.Fatal("Refusing to start: OTP_DEV_SINK must not be enabled in release mode.")
+	}
+	if _, err := utils.ConfigureJWT(cfg); err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+	if err := utils.ConfigureChatEvents(cfg); err != nil {
+		log.Fatal("Invalid CHAT_EVENT_RETENTION:", err)
+	}
+
+	// Delete accounts inactive for longer than their self-destruct TTL. The
+	// worker sends email, so it only starts once the mail settings passed
+	// the checks above.
+	go workers.NewSelfDestructWorker(db, utils.NewMailer(cfg)).Run(context.Background())
+
 	// Setup router
 	r := gin.Default()
 